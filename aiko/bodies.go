@@ -0,0 +1,195 @@
+package aiko
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+// BodyMode decides when request and response bodies are kept on an event.
+type BodyMode string
+
+const (
+	BodyModeAlways  BodyMode = "always"
+	BodyModeNever   BodyMode = "never"
+	BodyModeOnError BodyMode = "on_error"
+	BodyModeOnSlow  BodyMode = "on_slow"
+)
+
+const (
+	defaultBodyErrorStatus = 500
+	defaultBodyMaxBytes    = 1 << 20
+)
+
+// BodyPolicy keeps bodies only for the requests that need them. Bodies are
+// buffered while the handler runs and dropped without being decoded when the
+// policy rejects the finished request.
+type BodyPolicy struct {
+	// Mode defaults to BodyModeAlways.
+	Mode BodyMode
+	// ErrorStatus is the lowest status BodyModeOnError keeps bodies for.
+	// Defaults to 500.
+	ErrorStatus int
+	// SlowThreshold is the duration at or above which BodyModeOnSlow keeps
+	// bodies. It must be set when any mode is BodyModeOnSlow.
+	SlowThreshold time.Duration
+	// MaxBytes bounds each buffered body. Larger bodies are replaced with a
+	// {"truncated": true} marker. Defaults to 1 MiB.
+	MaxBytes int
+	// Routes override the policy for matching requests; the first match wins.
+	Routes []BodyRoute
+}
+
+// BodyRoute overrides BodyPolicy for matching requests. Empty fields match
+// anything, and zero thresholds fall back to the policy's.
+type BodyRoute struct {
+	// Method matches the HTTP method, case-insensitively.
+	Method string
+	// Endpoint is a glob with the same syntax as SamplingRule.Endpoint.
+	Endpoint      string
+	Mode          BodyMode
+	ErrorStatus   int
+	SlowThreshold time.Duration
+}
+
+// bodyRule is the policy in effect for one request.
+type bodyRule struct {
+	mode        BodyMode
+	errorStatus int
+	slow        time.Duration
+}
+
+type bodyRoute struct {
+	method   string
+	endpoint string
+	rule     bodyRule
+}
+
+// bodyPolicy is the compiled form of a BodyPolicy.
+type bodyPolicy struct {
+	rule     bodyRule
+	maxBytes int
+	routes   []bodyRoute
+}
+
+func compileBodyPolicy(p BodyPolicy) (bodyPolicy, error) {
+	out := bodyPolicy{maxBytes: p.MaxBytes}
+	if p.MaxBytes < 0 {
+		return bodyPolicy{}, errors.New("capture.bodies.maxBytes must not be negative")
+	}
+	if out.maxBytes == 0 {
+		out.maxBytes = defaultBodyMaxBytes
+	}
+	var err error
+	if out.rule, err = compileBodyRule(p.Mode, p.ErrorStatus, p.SlowThreshold, bodyRule{mode: BodyModeAlways, errorStatus: defaultBodyErrorStatus}, "capture.bodies"); err != nil {
+		return bodyPolicy{}, err
+	}
+	for i, route := range p.Routes {
+		field := fmt.Sprintf("capture.bodies.routes[%d]", i)
+		if route.Mode == "" {
+			return bodyPolicy{}, fmt.Errorf("%s.mode must be set", field)
+		}
+		endpoint := strings.TrimSpace(route.Endpoint)
+		if _, err := path.Match(strings.TrimSuffix(endpoint, "/**"), ""); err != nil {
+			return bodyPolicy{}, fmt.Errorf("%s.endpoint %q is not a valid pattern", field, route.Endpoint)
+		}
+		rule, err := compileBodyRule(route.Mode, route.ErrorStatus, route.SlowThreshold, out.rule, field)
+		if err != nil {
+			return bodyPolicy{}, err
+		}
+		out.routes = append(out.routes, bodyRoute{
+			method:   strings.ToUpper(strings.TrimSpace(route.Method)),
+			endpoint: endpoint,
+			rule:     rule,
+		})
+	}
+	return out, nil
+}
+
+// compileBodyRule fills zero fields from fallback and checks the result.
+func compileBodyRule(mode BodyMode, errorStatus int, slow time.Duration, fallback bodyRule, field string) (bodyRule, error) {
+	rule := bodyRule{mode: BodyMode(strings.ToLower(strings.TrimSpace(string(mode)))), errorStatus: errorStatus, slow: slow}
+	if rule.mode == "" {
+		rule.mode = fallback.mode
+	}
+	if rule.errorStatus == 0 {
+		rule.errorStatus = fallback.errorStatus
+	}
+	if rule.slow == 0 {
+		rule.slow = fallback.slow
+	}
+	switch rule.mode {
+	case BodyModeAlways, BodyModeNever, BodyModeOnError, BodyModeOnSlow:
+	default:
+		return bodyRule{}, fmt.Errorf("%s.mode must be always, never, on_error or on_slow, got %q", field, mode)
+	}
+	if errorStatus != 0 && (errorStatus < 100 || errorStatus > 599) {
+		return bodyRule{}, fmt.Errorf("%s.errorStatus must be a status code, got %d", field, errorStatus)
+	}
+	if slow < 0 {
+		return bodyRule{}, fmt.Errorf("%s.slowThreshold must not be negative", field)
+	}
+	if rule.mode == BodyModeOnSlow && rule.slow == 0 {
+		return bodyRule{}, fmt.Errorf("%s.slowThreshold must be set for on_slow", field)
+	}
+	return rule, nil
+}
+
+// route returns the rule for a request, before its outcome is known.
+func (p bodyPolicy) route(method, endpoint string) bodyRule {
+	method = strings.ToUpper(method)
+	for _, r := range p.routes {
+		if r.method != "" && r.method != method {
+			continue
+		}
+		if r.endpoint == "" || matchEndpoint(r.endpoint, endpoint) {
+			return r.rule
+		}
+	}
+	return p.rule
+}
+
+// buffers reports whether bodies may be kept, and so must be buffered.
+func (r bodyRule) buffers() bool {
+	return r.mode != BodyModeNever
+}
+
+// keeps reports whether a finished request keeps its bodies.
+func (r bodyRule) keeps(status int, duration time.Duration) bool {
+	switch r.mode {
+	case BodyModeAlways:
+		return true
+	case BodyModeOnError:
+		return status >= r.errorStatus
+	case BodyModeOnSlow:
+		return duration >= r.slow
+	}
+	return false
+}
+
+// truncatedBody stands in for a body larger than BodyPolicy.MaxBytes.
+func truncatedBody(limit int) map[string]any {
+	return map[string]any{"truncated": true, "max_bytes": limit}
+}
+
+// bufferRequestBody reads up to limit bytes of r.Body and leaves r.Body
+// readable from the start. It reports true, and returns no bytes, when the
+// body is larger than limit; the handler still reads all of it.
+func bufferRequestBody(r *http.Request, limit int) ([]byte, bool) {
+	buf, _ := io.ReadAll(io.LimitReader(r.Body, int64(limit)+1))
+	if len(buf) <= limit {
+		_ = r.Body.Close()
+		r.Body = io.NopCloser(bytes.NewReader(buf))
+		return buf, false
+	}
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(buf), r.Body), r.Body}
+	return nil, true
+}
@@ -0,0 +1,200 @@
+package aiko
+
+import (
+	"fmt"
+	"net"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// CaptureConfig limits which requests the middleware captures. A request is
+// captured when Include is empty or one of its filters matches, and none of
+// the Exclude filters match. Other requests are passed straight through.
+type CaptureConfig struct {
+	Include []CaptureFilter
+	Exclude []CaptureFilter
+
+	// When is an Expression evaluated on each captured event in the sender
+	// worker, before processors and redaction; events it rejects are
+	// dropped.
+	When string
+	// BodiesWhen is an Expression evaluated by the middleware once the
+	// handler has returned. Request and response bodies are decoded and kept
+	// only on events it accepts; on the others they are discarded
+	// undecoded.
+	BodiesWhen string
+
+	// Bodies decides from each request's route, status and duration whether
+	// its bodies are kept.
+	Bodies BodyPolicy
+}
+
+// CaptureFilter matches requests. Empty fields match anything; at least one
+// must be set.
+type CaptureFilter struct {
+	// Method matches the HTTP method, case-insensitively.
+	Method string
+	// Host is a glob matched against the request host without its port,
+	// such as "*.internal.example.com".
+	Host string
+	// Path is a glob with the same syntax as SamplingRule.Endpoint, matched
+	// against the path without its query. "*" stays within one segment, so
+	// "/static/*" matches "/static/app.js" but not "/static/css/site.css";
+	// use "/static/**" for everything below a prefix.
+	Path string
+	// Regex is a regular expression that must match the whole path, as if
+	// wrapped in ^(?:...)$; "/debug/.*" matches everything under /debug/. It
+	// cannot be combined with Path.
+	Regex string
+}
+
+type captureFilter struct {
+	method string
+	host   string
+	path   string
+	regex  *regexp.Regexp
+}
+
+// captureFilters is the compiled form of a CaptureConfig.
+type captureFilters struct {
+	include    []captureFilter
+	exclude    []captureFilter
+	when       *Expression
+	bodiesWhen *Expression
+	bodies     bodyPolicy
+}
+
+func validateCapture(cfg CaptureConfig) error {
+	_, err := compileCaptureFilters(cfg)
+	return err
+}
+
+func compileCaptureFilters(cfg CaptureConfig) (captureFilters, error) {
+	var out captureFilters
+	for i, f := range cfg.Include {
+		compiled, err := compileCaptureFilter(f, fmt.Sprintf("capture.include[%d]", i))
+		if err != nil {
+			return captureFilters{}, err
+		}
+		out.include = append(out.include, compiled)
+	}
+	for i, f := range cfg.Exclude {
+		compiled, err := compileCaptureFilter(f, fmt.Sprintf("capture.exclude[%d]", i))
+		if err != nil {
+			return captureFilters{}, err
+		}
+		out.exclude = append(out.exclude, compiled)
+	}
+	var err error
+	if out.when, err = compileOptionalExpression(cfg.When, "capture.when"); err != nil {
+		return captureFilters{}, err
+	}
+	if out.bodiesWhen, err = compileOptionalExpression(cfg.BodiesWhen, "capture.bodiesWhen"); err != nil {
+		return captureFilters{}, err
+	}
+	if out.bodies, err = compileBodyPolicy(cfg.Bodies); err != nil {
+		return captureFilters{}, err
+	}
+	return out, nil
+}
+
+func compileOptionalExpression(src, field string) (*Expression, error) {
+	if strings.TrimSpace(src) == "" {
+		return nil, nil
+	}
+	expr, err := CompileExpression(src)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", field, err)
+	}
+	return expr, nil
+}
+
+func compileCaptureFilter(f CaptureFilter, field string) (captureFilter, error) {
+	out := captureFilter{
+		method: strings.ToUpper(strings.TrimSpace(f.Method)),
+		host:   strings.ToLower(strings.TrimSpace(f.Host)),
+		path:   strings.TrimSpace(f.Path),
+	}
+	if out.method == "" && out.host == "" && out.path == "" && f.Regex == "" {
+		return captureFilter{}, fmt.Errorf("%s must set method, host, path or regex", field)
+	}
+	if out.path != "" && f.Regex != "" {
+		return captureFilter{}, fmt.Errorf("%s cannot set both path and regex", field)
+	}
+	if _, err := path.Match(out.host, ""); err != nil {
+		return captureFilter{}, fmt.Errorf("%s.host %q is not a valid pattern", field, f.Host)
+	}
+	if _, err := path.Match(strings.TrimSuffix(out.path, "/**"), ""); err != nil {
+		return captureFilter{}, fmt.Errorf("%s.path %q is not a valid pattern", field, f.Path)
+	}
+	if f.Regex != "" {
+		re, err := regexp.Compile(`^(?:` + f.Regex + `)$`)
+		if err != nil {
+			return captureFilter{}, fmt.Errorf("%s.regex: %w", field, err)
+		}
+		out.regex = re
+	}
+	return out, nil
+}
+
+// newCaptureFilters compiles cfg, which must already be valid.
+func newCaptureFilters(cfg CaptureConfig) captureFilters {
+	out, _ := compileCaptureFilters(cfg)
+	return out
+}
+
+// apply runs When on a captured event and reports whether it is kept.
+func (c captureFilters) apply(evt Event) (Event, bool) {
+	if c.when != nil && !c.when.Match(evt) {
+		return evt, false
+	}
+	return evt, true
+}
+
+// keepsBodies runs BodiesWhen on an event that has no bodies yet.
+func (c captureFilters) keepsBodies(evt Event) bool {
+	return c.bodiesWhen == nil || c.bodiesWhen.Match(evt)
+}
+
+// allows reports whether a request should be captured.
+func (c captureFilters) allows(method, host, requestPath string) bool {
+	if len(c.include) == 0 && len(c.exclude) == 0 {
+		return true
+	}
+	method = strings.ToUpper(method)
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(host)
+	requestPath, _, _ = strings.Cut(requestPath, "?")
+
+	if len(c.include) > 0 && !anyCaptureFilter(c.include, method, host, requestPath) {
+		return false
+	}
+	return !anyCaptureFilter(c.exclude, method, host, requestPath)
+}
+
+func anyCaptureFilter(filters []captureFilter, method, host, requestPath string) bool {
+	for _, f := range filters {
+		if f.matches(method, host, requestPath) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f captureFilter) matches(method, host, requestPath string) bool {
+	if f.method != "" && f.method != method {
+		return false
+	}
+	if f.host != "" {
+		if ok, _ := path.Match(f.host, host); !ok {
+			return false
+		}
+	}
+	if f.path != "" && !matchEndpoint(f.path, requestPath) {
+		return false
+	}
+	return f.regex == nil || f.regex.MatchString(requestPath)
+}
@@ -0,0 +1,378 @@
+package aiko
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+)
+
+const defaultConfigPollInterval = 5 * time.Second
+
+// fileConfig is the JSON layout read by ConfigFromFile, described by
+// config.schema.json at the repository root. Unknown fields are rejected.
+type fileConfig struct {
+	Schema              string   `json:"$schema"`
+	ProjectKey          string   `json:"project_key"`
+	SecretKey           string   `json:"secret_key"`
+	Endpoint            string   `json:"endpoint"`
+	Endpoints           []string `json:"endpoints"`
+	AllowCustomEndpoint bool     `json:"allow_custom_endpoint"`
+	Enabled             *bool    `json:"enabled"`
+	QueueSize           int      `json:"queue_size"`
+	MaxConcurrentSends  int      `json:"max_concurrent_sends"`
+
+	// Sections below can be reloaded at runtime by WatchConfigFile.
+	Verbose   *bool                `json:"verbose"`
+	Actor     *fileActorConfig     `json:"actor"`
+	Sampling  *fileSamplingConfig  `json:"sampling"`
+	Redaction *fileRedactionConfig `json:"redaction"`
+	Capture   *fileCaptureConfig   `json:"capture"`
+}
+
+type fileActorConfig struct {
+	Provider string `json:"provider"`
+	Header   string `json:"header"`
+	Cookie   string `json:"cookie"`
+	Extract  string `json:"extract"`
+	Claims   struct {
+		ID    string `json:"id"`
+		Email string `json:"email"`
+		OrgID string `json:"org_id"`
+	} `json:"claims"`
+}
+
+type fileSamplingConfig struct {
+	Rate     float64            `json:"rate"`
+	Rules    []fileSamplingRule `json:"rules"`
+	Adaptive *struct {
+		TargetPerSecond float64 `json:"target_per_second"`
+		MaxEndpoints    int     `json:"max_endpoints"`
+	} `json:"adaptive"`
+}
+
+type fileSamplingRule struct {
+	Method   string  `json:"method"`
+	Endpoint string  `json:"endpoint"`
+	Status   string  `json:"status"`
+	Actor    *bool   `json:"actor"`
+	Rate     float64 `json:"rate"`
+}
+
+type fileCaptureConfig struct {
+	Include    []fileCaptureFilter `json:"include"`
+	Exclude    []fileCaptureFilter `json:"exclude"`
+	When       string              `json:"when"`
+	BodiesWhen string              `json:"bodies_when"`
+	Bodies     *fileBodyPolicy     `json:"bodies"`
+}
+
+type fileBodyPolicy struct {
+	Mode        string          `json:"mode"`
+	ErrorStatus int             `json:"error_status"`
+	SlowMS      int64           `json:"slow_ms"`
+	MaxBytes    int             `json:"max_bytes"`
+	Routes      []fileBodyRoute `json:"routes"`
+}
+
+type fileBodyRoute struct {
+	Method      string `json:"method"`
+	Endpoint    string `json:"endpoint"`
+	Mode        string `json:"mode"`
+	ErrorStatus int    `json:"error_status"`
+	SlowMS      int64  `json:"slow_ms"`
+}
+
+type fileCaptureFilter struct {
+	Method string `json:"method"`
+	Host   string `json:"host"`
+	Path   string `json:"path"`
+	Regex  string `json:"regex"`
+}
+
+type fileRedactionConfig struct {
+	Headers  []string `json:"headers"`
+	BodyKeys []string `json:"body_keys"`
+}
+
+// NewFromFile builds a Monitor from ConfigFromFile. Non-zero fields of cfg
+// override the file.
+func NewFromFile(path string, cfg Config) (*Monitor, error) {
+	file, err := ConfigFromFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return New(mergeConfig(file, cfg))
+}
+
+// ConfigFromFile reads a Config from a JSON file.
+func ConfigFromFile(path string) (Config, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, fmt.Errorf("config file: %w", err)
+	}
+	doc, err := parseConfigFile(raw)
+	if err != nil {
+		return Config{}, fmt.Errorf("config file %s: %w", path, err)
+	}
+	return doc.config()
+}
+
+func parseConfigFile(raw []byte) (fileConfig, error) {
+	var doc fileConfig
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&doc); err != nil {
+		return fileConfig{}, err
+	}
+	if decoder.More() {
+		return fileConfig{}, errors.New("unexpected data after the config object")
+	}
+	return doc, nil
+}
+
+func (doc fileConfig) config() (Config, error) {
+	cfg := Config{
+		ProjectKey:          doc.ProjectKey,
+		SecretKey:           doc.SecretKey,
+		Endpoint:            doc.Endpoint,
+		Endpoints:           doc.Endpoints,
+		AllowCustomEndpoint: doc.AllowCustomEndpoint,
+		Enabled:             doc.Enabled,
+		QueueSize:           doc.QueueSize,
+		MaxConcurrentSends:  doc.MaxConcurrentSends,
+	}
+	if doc.Verbose != nil {
+		cfg.Verbose = *doc.Verbose
+	}
+	if doc.Actor != nil {
+		actor, err := doc.Actor.config()
+		if err != nil {
+			return Config{}, err
+		}
+		cfg.Actor = actor
+	}
+	if doc.Sampling != nil {
+		cfg.Sampling = SamplingConfig{Rate: doc.Sampling.Rate}
+		for _, rule := range doc.Sampling.Rules {
+			cfg.Sampling.Rules = append(cfg.Sampling.Rules, SamplingRule(rule))
+		}
+		if adaptive := doc.Sampling.Adaptive; adaptive != nil {
+			cfg.Sampling.Adaptive = AdaptiveSamplingConfig{
+				TargetPerSecond: adaptive.TargetPerSecond,
+				MaxEndpoints:    adaptive.MaxEndpoints,
+			}
+		}
+	}
+	if doc.Redaction != nil {
+		cfg.Redaction = RedactionConfig{Headers: doc.Redaction.Headers, BodyKeys: doc.Redaction.BodyKeys}
+	}
+	if doc.Capture != nil {
+		cfg.Capture.When = doc.Capture.When
+		cfg.Capture.BodiesWhen = doc.Capture.BodiesWhen
+		for _, f := range doc.Capture.Include {
+			cfg.Capture.Include = append(cfg.Capture.Include, CaptureFilter(f))
+		}
+		for _, f := range doc.Capture.Exclude {
+			cfg.Capture.Exclude = append(cfg.Capture.Exclude, CaptureFilter(f))
+		}
+		if bodies := doc.Capture.Bodies; bodies != nil {
+			cfg.Capture.Bodies = BodyPolicy{
+				Mode:          BodyMode(bodies.Mode),
+				ErrorStatus:   bodies.ErrorStatus,
+				SlowThreshold: time.Duration(bodies.SlowMS) * time.Millisecond,
+				MaxBytes:      bodies.MaxBytes,
+			}
+			for _, route := range bodies.Routes {
+				cfg.Capture.Bodies.Routes = append(cfg.Capture.Bodies.Routes, BodyRoute{
+					Method:        route.Method,
+					Endpoint:      route.Endpoint,
+					Mode:          BodyMode(route.Mode),
+					ErrorStatus:   route.ErrorStatus,
+					SlowThreshold: time.Duration(route.SlowMS) * time.Millisecond,
+				})
+			}
+		}
+	}
+	return cfg, nil
+}
+
+func (a fileActorConfig) config() (ActorConfig, error) {
+	extract, err := ParseActorTokenExtract(a.Extract)
+	if err != nil {
+		return ActorConfig{}, fmt.Errorf("actor.extract: %w", err)
+	}
+	cfg := ActorConfig{
+		Provider: ActorProvider(a.Provider),
+		Claims:   ActorClaimsConfig{ID: a.Claims.ID, Email: a.Claims.Email, OrgID: a.Claims.OrgID},
+	}
+	if a.Header != "" {
+		cfg.Token.Header = &ActorHeaderTokenConfig{Name: a.Header, Extract: extract}
+	}
+	if a.Cookie != "" {
+		cfg.Token.Cookie = &ActorCookieTokenConfig{Name: a.Cookie, Extract: extract}
+	}
+	return cfg, nil
+}
+
+// unsafeChanges lists fields that differ between two versions of the file
+// and cannot be applied without restarting.
+func (doc fileConfig) unsafeChanges(next fileConfig) []string {
+	var changed []string
+	check := func(name string, a, b any) {
+		if !reflect.DeepEqual(a, b) {
+			changed = append(changed, name)
+		}
+	}
+	check("project_key", doc.ProjectKey, next.ProjectKey)
+	check("secret_key", doc.SecretKey, next.SecretKey)
+	check("endpoint", doc.Endpoint, next.Endpoint)
+	check("endpoints", doc.Endpoints, next.Endpoints)
+	check("allow_custom_endpoint", doc.AllowCustomEndpoint, next.AllowCustomEndpoint)
+	check("enabled", doc.Enabled, next.Enabled)
+	check("queue_size", doc.QueueSize, next.QueueSize)
+	check("max_concurrent_sends", doc.MaxConcurrentSends, next.MaxConcurrentSends)
+	return changed
+}
+
+func configHash(raw []byte) string {
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:8])
+}
+
+// WatchConfigFile polls path every interval until Shutdown and applies
+// changes to verbose, actor, sampling, redaction and capture atomically. Sections
+// missing from the file keep their running value. A version that changes
+// keys, endpoints, enabled or queue settings is rejected as a whole and
+// logged; those need a restart. The file must be valid when the watch starts.
+func (m *Monitor) WatchConfigFile(path string, interval time.Duration) error {
+	if m == nil {
+		return errors.New("monitor is nil")
+	}
+	if interval <= 0 {
+		interval = defaultConfigPollInterval
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config file: %w", err)
+	}
+	doc, err := parseConfigFile(raw)
+	if err != nil {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("config file: %w", err)
+	}
+	w := &configWatcher{
+		m:       m,
+		path:    path,
+		current: doc,
+		hash:    configHash(raw),
+		modTime: info.ModTime(),
+		size:    info.Size(),
+	}
+	m.log.debug("config watching", "path", path, "hash", w.hash, "interval", interval)
+	go w.run(interval)
+	return nil
+}
+
+type configWatcher struct {
+	m       *Monitor
+	path    string
+	current fileConfig
+	hash    string
+	modTime time.Time
+	size    int64
+	lastErr string
+}
+
+func (w *configWatcher) run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.m.closeCh:
+			return
+		case <-ticker.C:
+			w.poll()
+		}
+	}
+}
+
+func (w *configWatcher) poll() {
+	info, err := os.Stat(w.path)
+	if err != nil {
+		w.fail("", err)
+		return
+	}
+	if info.ModTime().Equal(w.modTime) && info.Size() == w.size {
+		return
+	}
+	raw, err := os.ReadFile(w.path)
+	if err != nil {
+		w.fail("", err)
+		return
+	}
+	w.modTime, w.size = info.ModTime(), info.Size()
+	hash := configHash(raw)
+	if hash == w.hash {
+		return
+	}
+	w.hash = hash
+
+	next, err := parseConfigFile(raw)
+	if err != nil {
+		w.fail(hash, err)
+		return
+	}
+	if changed := w.current.unsafeChanges(next); len(changed) > 0 {
+		w.fail(hash, fmt.Errorf("%s cannot change at runtime; restart to apply", strings.Join(changed, ", ")))
+		return
+	}
+	cfg, err := next.config()
+	if err != nil {
+		w.fail(hash, err)
+		return
+	}
+	err = w.m.updateLive(func(live *DynamicConfig) error {
+		if next.Verbose != nil {
+			live.Verbose = cfg.Verbose
+		}
+		if next.Actor != nil {
+			live.Actor = cfg.Actor
+		}
+		if next.Sampling != nil {
+			live.Sampling = cfg.Sampling
+		}
+		if next.Redaction != nil {
+			live.Redaction = cfg.Redaction
+		}
+		if next.Capture != nil {
+			live.Capture = cfg.Capture
+		}
+		return nil
+	})
+	if err != nil {
+		w.fail(hash, err)
+		return
+	}
+	w.current = next
+	w.lastErr = ""
+	w.m.log.notice("config reloaded", "path", w.path, "hash", hash)
+}
+
+// fail logs a rejected reload once per distinct error.
+func (w *configWatcher) fail(hash string, err error) {
+	if err.Error() == w.lastErr {
+		return
+	}
+	w.lastErr = err.Error()
+	w.m.log.error("config reload rejected", "path", w.path, "hash", hash, "error", err)
+}
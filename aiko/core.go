@@ -135,21 +135,107 @@ func DecodeResponseBody(raw []byte, headers map[string]string) any {
 }
 
 func RedactValue(value any) any {
+	return redactor{}.value(value)
+}
+
+// redactor masks the built-in sensitive keys plus those from a
+// RedactionConfig. The zero value masks only the built-in keys.
+type redactor struct {
+	headers  map[string]struct{}
+	bodyKeys map[string]struct{}
+}
+
+func newRedactor(cfg RedactionConfig) redactor {
+	return redactor{headers: lowerSet(cfg.Headers), bodyKeys: lowerSet(cfg.BodyKeys)}
+}
+
+func lowerSet(values []string) map[string]struct{} {
+	if len(values) == 0 {
+		return nil
+	}
+	set := make(map[string]struct{}, len(values))
+	for _, value := range values {
+		set[strings.ToLower(strings.TrimSpace(value))] = struct{}{}
+	}
+	return set
+}
+
+func (r redactor) sensitive(key string, extra map[string]struct{}) bool {
+	lower := strings.ToLower(key)
+	if _, ok := sensitiveKeys[lower]; ok {
+		return true
+	}
+	_, ok := extra[lower]
+	return ok
+}
+
+func (r redactor) event(evt Event) Event {
+	return Event{
+		ID:              evt.ID,
+		URL:             evt.URL,
+		Endpoint:        evt.Endpoint,
+		Method:          evt.Method,
+		StatusCode:      evt.StatusCode,
+		Actor:           cloneActorContext(evt.Actor),
+		RequestHeaders:  r.headerMap(evt.RequestHeaders),
+		RequestBody:     r.value(evt.RequestBody),
+		ResponseHeaders: r.headerMap(evt.ResponseHeaders),
+		ResponseBody:    r.value(evt.ResponseBody),
+		Timestamp:       evt.Timestamp,
+		DurationMS:      evt.DurationMS,
+		SampleRate:      evt.SampleRate,
+		Tags:            r.tags(evt.Tags),
+		Attributes:      r.attributes(evt.Attributes),
+		clientIP:        evt.clientIP,
+	}
+}
+
+// tags and attributes mask values whose keys match the body keys, as if they
+// were fields of a body.
+func (r redactor) tags(tags map[string]string) map[string]string {
+	if tags == nil {
+		return nil
+	}
+	out := make(map[string]string, len(tags))
+	for key, val := range tags {
+		if r.sensitive(key, r.bodyKeys) {
+			val = redactionMask
+		}
+		out[key] = val
+	}
+	return out
+}
+
+func (r redactor) attributes(attrs map[string]any) map[string]any {
+	if attrs == nil {
+		return nil
+	}
+	out := make(map[string]any, len(attrs))
+	for key, val := range attrs {
+		if r.sensitive(key, r.bodyKeys) {
+			val = redactionMask
+		}
+		out[key] = val
+	}
+	return out
+}
+
+func (r redactor) value(value any) any {
 	switch v := value.(type) {
 	case map[string]any:
 		out := make(map[string]any, len(v))
 		for key, val := range v {
-			if _, ok := sensitiveKeys[strings.ToLower(key)]; ok {
+			if r.sensitive(key, r.bodyKeys) {
 				out[key] = redactionMask
 				continue
 			}
-			out[key] = RedactValue(val)
+			out[key] = r.value(val)
 		}
 		return out
 	case map[string]string:
 		out := make(map[string]any, len(v))
 		for key, val := range v {
-			if _, ok := sensitiveKeys[strings.ToLower(key)]; ok {
+			if r.sensitive(key, r.bodyKeys) {
 				out[key] = redactionMask
 				continue
 			}
@@ -159,7 +245,7 @@ func RedactValue(value any) any {
 	case []any:
 		out := make([]any, len(v))
 		for i, item := range v {
-			out[i] = RedactValue(item)
+			out[i] = r.value(item)
 		}
 		return out
 	case []string:
@@ -176,14 +262,14 @@ func RedactValue(value any) any {
 	}
 }
 
-func redactHeaders(in map[string]string) map[string]string {
+func (r redactor) headerMap(in map[string]string) map[string]string {
 	if len(in) == 0 {
 		return map[string]string{}
 	}
 	out := make(map[string]string, len(in))
 	for k, v := range in {
 		lower := strings.ToLower(k)
-		if _, ok := sensitiveKeys[lower]; ok {
+		if r.sensitive(lower, r.headers) {
 			out[lower] = redactionMask
 			continue
 		}
@@ -246,8 +332,15 @@ func Sign(secret, body []byte) string {
 }
 
 func GzipEvent(evt Event) ([]byte, error) {
+	return gzipEvent(evt, "")
+}
+
+// gzipEvent is GzipEvent with comment set as the gzip header comment; an
+// empty comment yields exactly the GzipEvent bytes.
+func gzipEvent(evt Event, comment string) ([]byte, error) {
 	var buf bytes.Buffer
 	gz := gzip.NewWriter(&buf)
+	gz.Comment = comment
 	enc := json.NewEncoder(gz)
 	if err := enc.Encode(evt); err != nil {
 		if closeErr := gz.Close(); closeErr != nil {
@@ -261,8 +354,24 @@ func GzipEvent(evt Event) ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
+// DecodeGzipEvent reverses GzipEvent, decoding an ingest request body.
+func DecodeGzipEvent(payload []byte) (Event, error) {
+	gr, err := gzip.NewReader(bytes.NewReader(payload))
+	if err != nil {
+		return Event{}, err
+	}
+	defer gr.Close()
+	var evt Event
+	if err := json.NewDecoder(gr).Decode(&evt); err != nil {
+		return Event{}, err
+	}
+	return evt, nil
+}
+
+const sdkVersion = "0.0.6"
+
 func VersionHeaderValue() string {
-	return fmt.Sprintf("go:%s", "0.0.6")
+	return fmt.Sprintf("go:%s", sdkVersion)
 }
 
 func newEventID() string {
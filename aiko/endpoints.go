@@ -0,0 +1,142 @@
+package aiko
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const (
+	defaultFailoverThreshold = 2
+	defaultFailbackInterval  = 30 * time.Second
+
+	// unixRequestURL is the request target used over unix:// endpoints; the
+	// host is ignored by the dialer.
+	unixRequestURL = "http://localhost/api/ingest"
+)
+
+// endpointSet tracks the health of an ordered list of ingest endpoints. Each
+// attempt goes to the first healthy endpoint. An endpoint that fails
+// failoverThreshold times in a row is skipped until failbackInterval has
+// passed, after which a single attempt probes it again.
+type endpointSet struct {
+	threshold int
+	interval  time.Duration
+
+	mu        sync.Mutex
+	endpoints []*endpointHealth
+}
+
+type endpointHealth struct {
+	url      string
+	failures int
+	retryAt  time.Time
+}
+
+func newEndpointSet(urls []string, threshold int, interval time.Duration) *endpointSet {
+	if threshold <= 0 {
+		threshold = defaultFailoverThreshold
+	}
+	if interval <= 0 {
+		interval = defaultFailbackInterval
+	}
+	set := &endpointSet{threshold: threshold, interval: interval}
+	for _, url := range urls {
+		set.endpoints = append(set.endpoints, &endpointHealth{url: url})
+	}
+	return set
+}
+
+func (s *endpointSet) pick(now time.Time) (int, string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fallback := 0
+	for i, ep := range s.endpoints {
+		if ep.failures < s.threshold {
+			return i, ep.url
+		}
+		if !now.Before(ep.retryAt) {
+			ep.retryAt = now.Add(s.interval)
+			return i, ep.url
+		}
+		if ep.retryAt.Before(s.endpoints[fallback].retryAt) {
+			fallback = i
+		}
+	}
+	return fallback, s.endpoints[fallback].url
+}
+
+// report records the outcome of an attempt. It returns the endpoint's new
+// state when it changed, for logging.
+func (s *endpointSet) report(i int, healthy bool, now time.Time) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ep := s.endpoints[i]
+	if healthy {
+		wasDown := ep.failures >= s.threshold
+		ep.failures = 0
+		if wasDown && len(s.endpoints) > 1 {
+			return "recovered"
+		}
+		return ""
+	}
+	ep.failures++
+	if ep.failures == s.threshold {
+		ep.retryAt = now.Add(s.interval)
+		if len(s.endpoints) > 1 {
+			return "unhealthy"
+		}
+	}
+	return ""
+}
+
+func resolveEndpoints(cfg Config) ([]string, error) {
+	if len(cfg.Endpoints) == 0 {
+		if cfg.Endpoint == "" {
+			return []string{DefaultEndpoint}, nil
+		}
+		return []string{cfg.Endpoint}, nil
+	}
+	if cfg.Endpoint != "" {
+		return nil, errors.New("endpoint and endpoints cannot both be set")
+	}
+	seen := make(map[string]bool, len(cfg.Endpoints))
+	out := make([]string, 0, len(cfg.Endpoints))
+	for _, endpoint := range cfg.Endpoints {
+		if seen[endpoint] {
+			return nil, errors.New("endpoints must not contain duplicates")
+		}
+		seen[endpoint] = true
+		out = append(out, endpoint)
+	}
+	return out, nil
+}
+
+// newUnixClients returns a dedicated client per unix:// endpoint. Each dials
+// the socket on demand, so a restarted agent is picked up on the next attempt.
+func newUnixClients(endpoints []string, timeout time.Duration) map[string]*http.Client {
+	clients := map[string]*http.Client{}
+	for _, endpoint := range endpoints {
+		u, err := url.Parse(endpoint)
+		if err != nil || u.Scheme != "unix" {
+			continue
+		}
+		socketPath := u.Path
+		var dialer net.Dialer
+		clients[endpoint] = &http.Client{
+			Timeout: timeout,
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					return dialer.DialContext(ctx, "unix", socketPath)
+				},
+				MaxIdleConnsPerHost: defaultMaxConcurrentSends,
+				IdleConnTimeout:     90 * time.Second,
+			},
+		}
+	}
+	return clients
+}
@@ -0,0 +1,250 @@
+package aiko
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Environment variables read by ConfigFromEnv. List values are
+// comma-separated.
+const (
+	EnvProjectKey            = "AIKO_PROJECT_KEY"
+	EnvSecretKey             = "AIKO_SECRET_KEY"
+	EnvEndpoint              = "AIKO_ENDPOINT"
+	EnvEndpoints             = "AIKO_ENDPOINTS"
+	EnvAllowCustomEndpoint   = "AIKO_ALLOW_CUSTOM_ENDPOINT"
+	EnvEnabled               = "AIKO_ENABLED"
+	EnvVerbose               = "AIKO_VERBOSE"
+	EnvQueueSize             = "AIKO_QUEUE_SIZE"
+	EnvMaxConcurrentSends    = "AIKO_MAX_CONCURRENT_SENDS"
+	EnvActorProvider         = "AIKO_ACTOR_PROVIDER"
+	EnvActorHeader           = "AIKO_ACTOR_HEADER"
+	EnvActorCookie           = "AIKO_ACTOR_COOKIE"
+	EnvActorExtract          = "AIKO_ACTOR_EXTRACT"
+	EnvActorClaimID          = "AIKO_ACTOR_CLAIM_ID"
+	EnvActorClaimEmail       = "AIKO_ACTOR_CLAIM_EMAIL"
+	EnvActorClaimOrgID       = "AIKO_ACTOR_CLAIM_ORG_ID"
+	EnvSampleRate            = "AIKO_SAMPLE_RATE"
+	EnvSampleTargetPerSecond = "AIKO_SAMPLE_TARGET_PER_SECOND"
+	EnvRedactHeaders         = "AIKO_REDACT_HEADERS"
+	EnvRedactBodyKeys        = "AIKO_REDACT_BODY_KEYS"
+)
+
+// NewFromEnv builds a Monitor from ConfigFromEnv. Non-zero fields of cfg
+// override the environment.
+func NewFromEnv(cfg Config) (*Monitor, error) {
+	env, err := ConfigFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	return New(mergeConfig(env, cfg))
+}
+
+// ConfigFromEnv reads a Config from the AIKO_* environment variables. Unset
+// variables leave the zero value, so New applies its usual defaults.
+func ConfigFromEnv() (Config, error) {
+	return configFromEnv(os.Getenv)
+}
+
+func configFromEnv(getenv func(string) string) (Config, error) {
+	get := func(name string) string { return strings.TrimSpace(getenv(name)) }
+	cfg := Config{
+		ProjectKey: get(EnvProjectKey),
+		SecretKey:  get(EnvSecretKey),
+		Endpoint:   get(EnvEndpoint),
+		Endpoints:  splitEnvList(get(EnvEndpoints)),
+		Redaction: RedactionConfig{
+			Headers:  splitEnvList(get(EnvRedactHeaders)),
+			BodyKeys: splitEnvList(get(EnvRedactBodyKeys)),
+		},
+	}
+
+	var err error
+	if cfg.AllowCustomEndpoint, err = envBool(EnvAllowCustomEndpoint, get(EnvAllowCustomEndpoint)); err != nil {
+		return Config{}, err
+	}
+	if value := get(EnvEnabled); value != "" {
+		enabled, err := envBool(EnvEnabled, value)
+		if err != nil {
+			return Config{}, err
+		}
+		cfg.Enabled = &enabled
+	}
+	if cfg.Verbose, err = envBool(EnvVerbose, get(EnvVerbose)); err != nil {
+		return Config{}, err
+	}
+	if cfg.QueueSize, err = envInt(EnvQueueSize, get(EnvQueueSize)); err != nil {
+		return Config{}, err
+	}
+	if cfg.MaxConcurrentSends, err = envInt(EnvMaxConcurrentSends, get(EnvMaxConcurrentSends)); err != nil {
+		return Config{}, err
+	}
+	if value := get(EnvSampleRate); value != "" {
+		rate, err := strconv.ParseFloat(value, 64)
+		if err != nil || rate < 0 || rate > 1 {
+			return Config{}, fmt.Errorf("%s must be a number between 0 and 1, got %q", EnvSampleRate, value)
+		}
+		cfg.Sampling.Rate = rate
+	}
+	if value := get(EnvSampleTargetPerSecond); value != "" {
+		target, err := strconv.ParseFloat(value, 64)
+		if err != nil || target < 0 {
+			return Config{}, fmt.Errorf("%s must be a non-negative number, got %q", EnvSampleTargetPerSecond, value)
+		}
+		cfg.Sampling.Adaptive.TargetPerSecond = target
+	}
+	if cfg.Actor, err = actorConfigFromEnv(get); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+func actorConfigFromEnv(get func(string) string) (ActorConfig, error) {
+	extract, err := ParseActorTokenExtract(get(EnvActorExtract))
+	if err != nil {
+		return ActorConfig{}, fmt.Errorf("%s: %w", EnvActorExtract, err)
+	}
+	cfg := ActorConfig{
+		Provider: ActorProvider(get(EnvActorProvider)),
+		Claims: ActorClaimsConfig{
+			ID:    get(EnvActorClaimID),
+			Email: get(EnvActorClaimEmail),
+			OrgID: get(EnvActorClaimOrgID),
+		},
+	}
+	header, cookie := get(EnvActorHeader), get(EnvActorCookie)
+	if header != "" && cookie != "" {
+		return ActorConfig{}, fmt.Errorf("%s and %s cannot both be set", EnvActorHeader, EnvActorCookie)
+	}
+	if header != "" {
+		cfg.Token.Header = &ActorHeaderTokenConfig{Name: header, Extract: extract}
+	}
+	if cookie != "" {
+		cfg.Token.Cookie = &ActorCookieTokenConfig{Name: cookie, Extract: extract}
+	}
+	return cfg, nil
+}
+
+// ParseActorTokenExtract reads an extractor in the "bearer", "raw" or
+// "json:<path>" form AIKO_ACTOR_EXTRACT uses. An empty value returns the zero
+// config.
+func ParseActorTokenExtract(value string) (ActorTokenExtractConfig, error) {
+	switch {
+	case value == "":
+		return ActorTokenExtractConfig{}, nil
+	case strings.EqualFold(value, "bearer"):
+		return ActorTokenExtractBearer(), nil
+	case strings.EqualFold(value, "raw"):
+		return ActorTokenExtractRaw(), nil
+	case strings.HasPrefix(strings.ToLower(value), "json:"):
+		path := strings.TrimSpace(value[len("json:"):])
+		if path == "" {
+			return ActorTokenExtractConfig{}, fmt.Errorf("json extractor needs a path, as in json:access_token")
+		}
+		return ActorTokenExtractJSON(path), nil
+	}
+	return ActorTokenExtractConfig{}, fmt.Errorf("must be bearer, raw or json:<path>, got %q", value)
+}
+
+func envBool(name, value string) (bool, error) {
+	if value == "" {
+		return false, nil
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("%s must be true or false, got %q", name, value)
+	}
+	return parsed, nil
+}
+
+func envInt(name, value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil || parsed < 0 {
+		return 0, fmt.Errorf("%s must be a non-negative integer, got %q", name, value)
+	}
+	return parsed, nil
+}
+
+func splitEnvList(value string) []string {
+	var out []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// mergeConfig overlays the non-zero fields of explicit onto env. Actor is
+// replaced as a whole when explicit configures any part of it.
+func mergeConfig(env, explicit Config) Config {
+	out := env
+	if explicit.ProjectKey != "" {
+		out.ProjectKey = explicit.ProjectKey
+	}
+	if explicit.SecretKey != "" || explicit.SecretProvider != nil {
+		out.SecretKey = explicit.SecretKey
+		out.SecretProvider = explicit.SecretProvider
+	}
+	if explicit.Endpoint != "" || len(explicit.Endpoints) > 0 {
+		out.Endpoint = explicit.Endpoint
+		out.Endpoints = explicit.Endpoints
+	}
+	if explicit.Enabled != nil {
+		out.Enabled = explicit.Enabled
+	}
+	if explicit.Verbose {
+		out.Verbose = true
+	}
+	if explicit.AllowCustomEndpoint {
+		out.AllowCustomEndpoint = true
+	}
+	if explicit.Actor.Provider != "" || actorTokenConfigured(explicit.Actor.Token) ||
+		actorClaimsConfigured(explicit.Actor.Claims) || explicit.Actor.Resolve != nil {
+		out.Actor = explicit.Actor
+	}
+	if explicit.MaxConcurrentSends != 0 {
+		out.MaxConcurrentSends = explicit.MaxConcurrentSends
+	}
+	if explicit.QueueSize != 0 {
+		out.QueueSize = explicit.QueueSize
+	}
+	// Rate and Adaptive exclude each other, so an explicit one also replaces
+	// whichever of the two came from the environment.
+	if explicit.Sampling.Rate != 0 || explicit.Sampling.Adaptive != (AdaptiveSamplingConfig{}) {
+		out.Sampling.Rate = explicit.Sampling.Rate
+		out.Sampling.Adaptive = explicit.Sampling.Adaptive
+	}
+	if explicit.Sampling.Rules != nil {
+		out.Sampling.Rules = explicit.Sampling.Rules
+	}
+	if explicit.Capture.Include != nil || explicit.Capture.Exclude != nil ||
+		explicit.Capture.When != "" || explicit.Capture.BodiesWhen != "" ||
+		explicit.Capture.Bodies.Mode != "" || explicit.Capture.Bodies.Routes != nil ||
+		explicit.Capture.Bodies.MaxBytes != 0 {
+		out.Capture = explicit.Capture
+	}
+	if explicit.Redaction.Headers != nil {
+		out.Redaction.Headers = explicit.Redaction.Headers
+	}
+	if explicit.Redaction.BodyKeys != nil {
+		out.Redaction.BodyKeys = explicit.Redaction.BodyKeys
+	}
+
+	out.HTTPClient = explicit.HTTPClient
+	out.Transport = explicit.Transport
+	out.Logger = explicit.Logger
+	out.SlogHandler = explicit.SlogHandler
+	out.FailoverThreshold = explicit.FailoverThreshold
+	out.FailbackInterval = explicit.FailbackInterval
+	out.OnUndelivered = explicit.OnUndelivered
+	out.OnExportFailed = explicit.OnExportFailed
+	out.Exporters = explicit.Exporters
+	out.Processors = explicit.Processors
+	return out
+}
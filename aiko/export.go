@@ -0,0 +1,306 @@
+package aiko
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+)
+
+// Exporter delivers captured events to a sink. Each exporter configured on a
+// Monitor gets its own queue, concurrency limit and retry loop, so a slow or
+// failing exporter does not hold back the others. Events reach exporters
+// already redacted.
+//
+// Export is called once per attempt; returning an error that reports
+// Retryable() true, or one accepted by IsRetryableError, schedules a retry with
+// backoff. Exporters may also implement Name() string for log output and
+// MaxBatchSize() int to receive more than one event per call.
+type Exporter interface {
+	Export(ctx context.Context, events []Event) error
+	Flush(ctx context.Context) error
+	Shutdown(ctx context.Context) error
+}
+
+type exportAttemptKey struct{}
+
+func withExportAttempt(ctx context.Context, attempt int) context.Context {
+	return context.WithValue(ctx, exportAttemptKey{}, attempt)
+}
+
+func exportAttempt(ctx context.Context) int {
+	if attempt, ok := ctx.Value(exportAttemptKey{}).(int); ok {
+		return attempt
+	}
+	return 1
+}
+
+func exporterName(exporter Exporter) string {
+	if named, ok := exporter.(interface{ Name() string }); ok {
+		if name := strings.TrimSpace(named.Name()); name != "" {
+			return name
+		}
+	}
+	return fmt.Sprintf("%T", exporter)
+}
+
+func exporterBatchSize(exporter Exporter) int {
+	if batcher, ok := exporter.(interface{ MaxBatchSize() int }); ok && batcher.MaxBatchSize() > 1 {
+		return batcher.MaxBatchSize()
+	}
+	return 1
+}
+
+func isRetryableExportError(err error) bool {
+	var retryable interface{ Retryable() bool }
+	if errors.As(err, &retryable) {
+		return retryable.Retryable()
+	}
+	return IsRetryableError(err)
+}
+
+type exportPipeline struct {
+	monitor   *Monitor
+	exporter  Exporter
+	name      string
+	batchSize int
+	queue     chan Event
+	sem       chan struct{}
+}
+
+func newExportPipeline(m *Monitor, exporter Exporter) *exportPipeline {
+	return &exportPipeline{
+		monitor:   m,
+		exporter:  exporter,
+		name:      exporterName(exporter),
+		batchSize: exporterBatchSize(exporter),
+		queue:     make(chan Event, m.cfg.QueueSize),
+		sem:       make(chan struct{}, m.cfg.MaxConcurrentSends),
+	}
+}
+
+func (p *exportPipeline) enqueue(evt Event) {
+	select {
+	case p.queue <- evt:
+	default:
+		p.monitor.log.warn("event dropped", "event_id", evt.ID, "exporter", p.name, "reason", "exporter_queue_full")
+	}
+}
+
+func (p *exportPipeline) run() {
+	m := p.monitor
+	defer m.wg.Done()
+	for evt := range p.queue {
+		batch := p.collect(evt)
+		if m.ctx.Err() != nil {
+			m.recordUndelivered(batch...)
+			continue
+		}
+		select {
+		case p.sem <- struct{}{}:
+		case <-m.ctx.Done():
+			m.recordUndelivered(batch...)
+			continue
+		}
+		m.wg.Add(1)
+		seq := m.trackInFlight(batch)
+		go func(events []Event) {
+			defer m.wg.Done()
+			defer func() { <-p.sem }()
+			defer m.untrackInFlight(seq)
+			if !p.export(m.ctx, events) && m.ctx.Err() != nil {
+				m.recordUndelivered(events...)
+			}
+		}(batch)
+	}
+}
+
+func (p *exportPipeline) collect(first Event) []Event {
+	batch := []Event{first}
+	for len(batch) < p.batchSize {
+		select {
+		case evt, ok := <-p.queue:
+			if !ok {
+				return batch
+			}
+			batch = append(batch, evt)
+		default:
+			return batch
+		}
+	}
+	return batch
+}
+
+func (p *exportPipeline) export(ctx context.Context, events []Event) bool {
+	m := p.monitor
+	backoff := baseBackoff
+
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		err := p.exportOnce(withExportAttempt(ctx, attempt), events)
+		if err == nil {
+			return true
+		}
+		if ctx.Err() != nil || !isRetryableExportError(err) || attempt == maxAttempts {
+			m.log.warn("export failed", "exporter", p.name, "events", len(events), "attempt", attempt, "error", err)
+			if ctx.Err() == nil && m.cfg.OnExportFailed != nil {
+				m.cfg.OnExportFailed(p.name, events, err)
+			}
+			return false
+		}
+
+		delay := m.jitter(backoff)
+		m.log.warn("export retry", "exporter", p.name, "events", len(events), "attempt", attempt, "backoff_ms", delay.Milliseconds(), "error", err)
+		if !sleepContext(ctx, delay) {
+			return false
+		}
+		if backoff < maxBackoff {
+			backoff *= 2
+			if backoff > maxBackoff {
+				backoff = maxBackoff
+			}
+		}
+	}
+	return false
+}
+
+func (p *exportPipeline) exportOnce(ctx context.Context, events []Event) (err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			err = fmt.Errorf("exporter %s panicked: %s", p.name, Stringify(rec))
+		}
+	}()
+	return p.exporter.Export(ctx, events)
+}
+
+func (m *Monitor) exporterNames() string {
+	names := make([]string, len(m.pipelines))
+	for i, p := range m.pipelines {
+		names[i] = p.name
+	}
+	return strings.Join(names, ",")
+}
+
+type WriterExporter struct {
+	mu  sync.Mutex
+	w   io.Writer
+	enc *json.Encoder
+}
+
+func NewWriterExporter(w io.Writer) *WriterExporter {
+	return &WriterExporter{w: w, enc: json.NewEncoder(w)}
+}
+
+func (e *WriterExporter) Name() string {
+	return "writer"
+}
+
+func (e *WriterExporter) MaxBatchSize() int {
+	return 100
+}
+
+func (e *WriterExporter) Export(_ context.Context, events []Event) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, evt := range events {
+		if err := e.enc.Encode(evt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *WriterExporter) Flush(context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	switch w := e.w.(type) {
+	case interface{ Flush() error }:
+		return w.Flush()
+	case interface{ Sync() error }:
+		return w.Sync()
+	}
+	return nil
+}
+
+func (e *WriterExporter) Shutdown(ctx context.Context) error {
+	return e.Flush(ctx)
+}
+
+type SlogExporter struct {
+	logger *slog.Logger
+	level  slog.Level
+}
+
+func NewSlogExporter(logger *slog.Logger, level slog.Level) *SlogExporter {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &SlogExporter{logger: logger, level: level}
+}
+
+func (e *SlogExporter) Name() string {
+	return "slog"
+}
+
+func (e *SlogExporter) MaxBatchSize() int {
+	return 100
+}
+
+func (e *SlogExporter) Export(ctx context.Context, events []Event) error {
+	for _, evt := range events {
+		attrs := []slog.Attr{
+			slog.String("event_id", evt.ID),
+			slog.String("method", evt.Method),
+			slog.String("endpoint", evt.Endpoint),
+			slog.String("url", evt.URL),
+			slog.Int("status_code", evt.StatusCode),
+			slog.Int64("duration_ms", evt.DurationMS),
+			slog.String("timestamp", evt.Timestamp),
+		}
+		if evt.SampleRate > 0 {
+			attrs = append(attrs, slog.Float64("sample_rate", evt.SampleRate))
+		}
+		if clientIP := evt.ClientIP(); clientIP != "" {
+			attrs = append(attrs, slog.String("client_ip", clientIP))
+		}
+		if evt.Actor != nil {
+			attrs = append(attrs, slog.Group("actor",
+				slog.String("provider", string(evt.Actor.Provider)),
+				slog.String("id", evt.Actor.ID),
+				slog.String("email", evt.Actor.Email),
+				slog.String("org_id", evt.Actor.OrgID),
+			))
+		}
+		if len(evt.Tags) > 0 {
+			attrs = append(attrs, slog.Any("tags", evt.Tags))
+		}
+		if len(evt.Attributes) > 0 {
+			attrs = append(attrs, slog.Any("attributes", evt.Attributes))
+		}
+		attrs = append(attrs,
+			slog.Any("request_headers", evt.RequestHeaders),
+			slog.Any("request_body", evt.RequestBody),
+			slog.Any("response_headers", evt.ResponseHeaders),
+			slog.Any("response_body", evt.ResponseBody),
+		)
+		e.logger.LogAttrs(ctx, e.level, "aiko event", attrs...)
+	}
+	return nil
+}
+
+func (e *SlogExporter) Flush(context.Context) error {
+	return nil
+}
+
+func (e *SlogExporter) Shutdown(context.Context) error {
+	return nil
+}
+
+var (
+	_ Exporter = (*IngestExporter)(nil)
+	_ Exporter = (*WriterExporter)(nil)
+	_ Exporter = (*SlogExporter)(nil)
+)
@@ -0,0 +1,705 @@
+package aiko
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Expression is a compiled predicate over an Event, such as
+//
+//	status >= 500 || duration > 2s || actor.org_id == "acme"
+//
+// Fields: id, method, url, endpoint, path, status, duration (milliseconds),
+// has_actor, actor.id, actor.email, actor.org_id, actor.provider,
+// request.headers["name"] and response.headers["name"]. Missing strings are
+// "". Operators: == != < <= > >= && || ! (also and, or, not), in and not in
+// against a [list], and matches for the globs used by SamplingRule.Endpoint.
+// Functions: lower, upper, trim, len, contains, starts_with, ends_with.
+// Number literals accept the duration suffixes ms, s, m and h.
+//
+// Expressions are type-checked when compiled, so evaluating one never fails.
+// They cannot loop, allocate unboundedly or reach anything but the event.
+type Expression struct {
+	src  string
+	eval func(*Event) any
+}
+
+const (
+	maxExpressionLength = 4096
+	maxExpressionDepth  = 64
+)
+
+// CompileExpression parses and type-checks src, which must be a boolean
+// expression.
+func CompileExpression(src string) (*Expression, error) {
+	if len(src) > maxExpressionLength {
+		return nil, fmt.Errorf("expression is longer than %d characters", maxExpressionLength)
+	}
+	tokens, err := lexExpression(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &exprParser{tokens: tokens}
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, tok.errorf("unexpected %s", tok)
+	}
+	if node.typ != typeBool {
+		return nil, fmt.Errorf("expression must be a boolean, got %s", node.typ)
+	}
+	return &Expression{src: src, eval: node.eval}, nil
+}
+
+// Match evaluates the expression against evt.
+func (e *Expression) Match(evt Event) bool {
+	if e == nil {
+		return true
+	}
+	return e.eval(&evt).(bool)
+}
+
+func (e *Expression) String() string {
+	if e == nil {
+		return ""
+	}
+	return e.src
+}
+
+type exprType int
+
+const (
+	typeBool exprType = iota
+	typeNumber
+	typeString
+	typeList
+)
+
+func (t exprType) String() string {
+	switch t {
+	case typeBool:
+		return "boolean"
+	case typeNumber:
+		return "number"
+	case typeString:
+		return "string"
+	default:
+		return "list"
+	}
+}
+
+type exprNode struct {
+	typ  exprType
+	elem exprType // element type of a list
+	// literal is set for string constants; matches patterns must be one
+	literal *string
+	eval    func(*Event) any
+}
+
+var exprFields = map[string]exprNode{
+	"id":       stringField(func(e *Event) string { return e.ID }),
+	"method":   stringField(func(e *Event) string { return e.Method }),
+	"url":      stringField(func(e *Event) string { return e.URL }),
+	"endpoint": stringField(func(e *Event) string { return e.Endpoint }),
+	"path": stringField(func(e *Event) string {
+		p, _, _ := strings.Cut(e.Endpoint, "?")
+		return p
+	}),
+	"status":         {typ: typeNumber, eval: func(e *Event) any { return float64(e.StatusCode) }},
+	"duration":       {typ: typeNumber, eval: func(e *Event) any { return float64(e.DurationMS) }},
+	"has_actor":      {typ: typeBool, eval: func(e *Event) any { return e.Actor != nil }},
+	"actor.id":       actorField(func(a *ActorContext) string { return a.ID }),
+	"actor.email":    actorField(func(a *ActorContext) string { return a.Email }),
+	"actor.org_id":   actorField(func(a *ActorContext) string { return a.OrgID }),
+	"actor.provider": actorField(func(a *ActorContext) string { return string(a.Provider) }),
+}
+
+var exprHeaderFields = map[string]func(*Event) map[string]string{
+	"request.headers":  func(e *Event) map[string]string { return e.RequestHeaders },
+	"response.headers": func(e *Event) map[string]string { return e.ResponseHeaders },
+}
+
+type exprFunc struct {
+	args []exprType
+	ret  exprType
+	call func(args []any) any
+}
+
+var exprFuncs = map[string]exprFunc{
+	"lower": {[]exprType{typeString}, typeString, func(a []any) any { return strings.ToLower(a[0].(string)) }},
+	"upper": {[]exprType{typeString}, typeString, func(a []any) any { return strings.ToUpper(a[0].(string)) }},
+	"trim":  {[]exprType{typeString}, typeString, func(a []any) any { return strings.TrimSpace(a[0].(string)) }},
+	"len":   {[]exprType{typeString}, typeNumber, func(a []any) any { return float64(len(a[0].(string))) }},
+	"contains": {[]exprType{typeString, typeString}, typeBool, func(a []any) any {
+		return strings.Contains(a[0].(string), a[1].(string))
+	}},
+	"starts_with": {[]exprType{typeString, typeString}, typeBool, func(a []any) any {
+		return strings.HasPrefix(a[0].(string), a[1].(string))
+	}},
+	"ends_with": {[]exprType{typeString, typeString}, typeBool, func(a []any) any {
+		return strings.HasSuffix(a[0].(string), a[1].(string))
+	}},
+}
+
+func stringField(get func(*Event) string) exprNode {
+	return exprNode{typ: typeString, eval: func(e *Event) any { return get(e) }}
+}
+
+func actorField(get func(*ActorContext) string) exprNode {
+	return stringField(func(e *Event) string {
+		if e.Actor == nil {
+			return ""
+		}
+		return get(e.Actor)
+	})
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokNumber
+	tokString
+	tokOp
+)
+
+type exprToken struct {
+	kind tokenKind
+	text string
+	num  float64
+	str  string
+	col  int
+}
+
+func (t exprToken) String() string {
+	switch t.kind {
+	case tokEOF:
+		return "end of expression"
+	case tokString:
+		return strconv.Quote(t.str)
+	default:
+		return fmt.Sprintf("%q", t.text)
+	}
+}
+
+func (t exprToken) errorf(format string, args ...any) error {
+	return fmt.Errorf("column %d: %s", t.col, fmt.Sprintf(format, args...))
+}
+
+var exprOperators = map[string]bool{
+	"==": true, "!=": true, "<=": true, ">=": true, "&&": true, "||": true,
+	"<": true, ">": true, "!": true, "(": true, ")": true, "[": true, "]": true, ",": true,
+}
+
+var durationSuffixes = map[string]float64{"ms": 1, "s": 1000, "m": 60 * 1000, "h": 60 * 60 * 1000}
+
+func lexExpression(src string) ([]exprToken, error) {
+	var tokens []exprToken
+	runes := []rune(src)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		col := i + 1
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case unicode.IsLetter(r) || r == '_':
+			start := i
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == '_' || runes[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, exprToken{kind: tokIdent, text: string(runes[start:i]), col: col})
+		case unicode.IsDigit(r):
+			start := i
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.') {
+				i++
+			}
+			num, err := strconv.ParseFloat(string(runes[start:i]), 64)
+			if err != nil {
+				return nil, fmt.Errorf("column %d: invalid number %q", col, string(runes[start:i]))
+			}
+			unitStart := i
+			for i < len(runes) && unicode.IsLetter(runes[i]) {
+				i++
+			}
+			if unit := string(runes[unitStart:i]); unit != "" {
+				scale, ok := durationSuffixes[unit]
+				if !ok {
+					return nil, fmt.Errorf("column %d: unknown duration unit %q; use ms, s, m or h", unitStart+1, unit)
+				}
+				num *= scale
+			}
+			tokens = append(tokens, exprToken{kind: tokNumber, text: string(runes[start:i]), num: num, col: col})
+		case r == '"' || r == '\'':
+			var b strings.Builder
+			i++
+			for {
+				if i >= len(runes) {
+					return nil, fmt.Errorf("column %d: unterminated string", col)
+				}
+				c := runes[i]
+				if c == r {
+					i++
+					break
+				}
+				if c == '\\' && i+1 < len(runes) {
+					i++
+					switch runes[i] {
+					case 'n':
+						c = '\n'
+					case 't':
+						c = '\t'
+					default:
+						c = runes[i]
+					}
+				}
+				b.WriteRune(c)
+				i++
+			}
+			tokens = append(tokens, exprToken{kind: tokString, str: b.String(), text: string(runes[col-1 : i]), col: col})
+		default:
+			op := string(r)
+			if i+1 < len(runes) && exprOperators[string(runes[i:i+2])] {
+				op = string(runes[i : i+2])
+			}
+			if !exprOperators[op] {
+				return nil, fmt.Errorf("column %d: unexpected character %q", col, op)
+			}
+			i += len([]rune(op))
+			tokens = append(tokens, exprToken{kind: tokOp, text: op, col: col})
+		}
+	}
+	return append(tokens, exprToken{kind: tokEOF, col: len(runes) + 1}), nil
+}
+
+type exprParser struct {
+	tokens []exprToken
+	pos    int
+	depth  int
+}
+
+func (p *exprParser) peek() exprToken {
+	return p.tokens[p.pos]
+}
+
+func (p *exprParser) next() exprToken {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *exprParser) accept(texts ...string) (exprToken, bool) {
+	tok := p.peek()
+	if tok.kind == tokOp || tok.kind == tokIdent {
+		for _, text := range texts {
+			if tok.text == text {
+				p.pos++
+				return tok, true
+			}
+		}
+	}
+	return tok, false
+}
+
+func (p *exprParser) expect(text string) error {
+	if tok, ok := p.accept(text); !ok {
+		return tok.errorf("expected %q, got %s", text, tok)
+	}
+	return nil
+}
+
+func (p *exprParser) enter() error {
+	p.depth++
+	if p.depth > maxExpressionDepth {
+		return p.peek().errorf("expression is nested more than %d levels deep", maxExpressionDepth)
+	}
+	return nil
+}
+
+func (p *exprParser) parseOr() (exprNode, error) {
+	if err := p.enter(); err != nil {
+		return exprNode{}, err
+	}
+	defer func() { p.depth-- }()
+	left, err := p.parseAnd()
+	if err != nil {
+		return exprNode{}, err
+	}
+	for {
+		tok, ok := p.accept("||", "or")
+		if !ok {
+			return left, nil
+		}
+		right, err := p.parseAnd()
+		if err != nil {
+			return exprNode{}, err
+		}
+		if err := checkBool(tok, left, right); err != nil {
+			return exprNode{}, err
+		}
+		l, r := left.eval, right.eval
+		left = exprNode{typ: typeBool, eval: func(e *Event) any { return l(e).(bool) || r(e).(bool) }}
+	}
+}
+
+func (p *exprParser) parseAnd() (exprNode, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return exprNode{}, err
+	}
+	for {
+		tok, ok := p.accept("&&", "and")
+		if !ok {
+			return left, nil
+		}
+		right, err := p.parseNot()
+		if err != nil {
+			return exprNode{}, err
+		}
+		if err := checkBool(tok, left, right); err != nil {
+			return exprNode{}, err
+		}
+		l, r := left.eval, right.eval
+		left = exprNode{typ: typeBool, eval: func(e *Event) any { return l(e).(bool) && r(e).(bool) }}
+	}
+}
+
+func (p *exprParser) parseNot() (exprNode, error) {
+	tok, ok := p.accept("!", "not")
+	if !ok {
+		return p.parseComparison()
+	}
+	if err := p.enter(); err != nil {
+		return exprNode{}, err
+	}
+	defer func() { p.depth-- }()
+	operand, err := p.parseNot()
+	if err != nil {
+		return exprNode{}, err
+	}
+	if err := checkBool(tok, operand); err != nil {
+		return exprNode{}, err
+	}
+	eval := operand.eval
+	return exprNode{typ: typeBool, eval: func(e *Event) any { return !eval(e).(bool) }}, nil
+}
+
+func checkBool(op exprToken, operands ...exprNode) error {
+	for _, operand := range operands {
+		if operand.typ != typeBool {
+			return op.errorf("%s needs boolean operands, got %s", op, operand.typ)
+		}
+	}
+	return nil
+}
+
+func (p *exprParser) parseComparison() (exprNode, error) {
+	left, err := p.parsePrimary()
+	if err != nil {
+		return exprNode{}, err
+	}
+	tok := p.peek()
+	if tok.kind == tokIdent && tok.text == "not" && p.tokens[p.pos+1].text == "in" {
+		p.pos += 2
+		in, err := p.parseIn(tok, left)
+		if err != nil {
+			return exprNode{}, err
+		}
+		eval := in.eval
+		return exprNode{typ: typeBool, eval: func(e *Event) any { return !eval(e).(bool) }}, nil
+	}
+	if _, ok := p.accept("in"); ok {
+		return p.parseIn(tok, left)
+	}
+	if _, ok := p.accept("matches"); ok {
+		return p.parseMatches(tok, left)
+	}
+	op, ok := p.accept("==", "!=", "<", "<=", ">", ">=")
+	if !ok {
+		return left, nil
+	}
+	right, err := p.parsePrimary()
+	if err != nil {
+		return exprNode{}, err
+	}
+	if left.typ != right.typ {
+		return exprNode{}, op.errorf("cannot compare %s with %s", left.typ, right.typ)
+	}
+	if left.typ == typeList || (left.typ == typeBool && op.text != "==" && op.text != "!=") {
+		return exprNode{}, op.errorf("%s cannot compare %s values", op, left.typ)
+	}
+	l, r := left.eval, right.eval
+	return exprNode{typ: typeBool, eval: func(e *Event) any {
+		return compareValues(op.text, l(e), r(e))
+	}}, nil
+}
+
+func compareValues(op string, a, b any) bool {
+	var c int
+	switch a := a.(type) {
+	case float64:
+		c = cmpOrdered(a, b.(float64))
+	case string:
+		c = strings.Compare(a, b.(string))
+	case bool:
+		if a != b.(bool) {
+			c = 1
+		}
+	}
+	switch op {
+	case "==":
+		return c == 0
+	case "!=":
+		return c != 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	default:
+		return c >= 0
+	}
+}
+
+func cmpOrdered(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func (p *exprParser) parseIn(op exprToken, left exprNode) (exprNode, error) {
+	right, err := p.parsePrimary()
+	if err != nil {
+		return exprNode{}, err
+	}
+	if right.typ != typeList {
+		return exprNode{}, op.errorf("in needs a [list] on the right, got %s", right.typ)
+	}
+	if left.typ != right.elem {
+		return exprNode{}, op.errorf("cannot look for a %s in a list of %s", left.typ, right.elem)
+	}
+	l, r := left.eval, right.eval
+	return exprNode{typ: typeBool, eval: func(e *Event) any {
+		value := l(e)
+		for _, item := range r(e).([]any) {
+			if item == value {
+				return true
+			}
+		}
+		return false
+	}}, nil
+}
+
+func (p *exprParser) parseMatches(op exprToken, left exprNode) (exprNode, error) {
+	patternTok := p.peek()
+	right, err := p.parsePrimary()
+	if err != nil {
+		return exprNode{}, err
+	}
+	if left.typ != typeString || right.literal == nil {
+		return exprNode{}, op.errorf("matches needs a string on the left and a string literal pattern on the right")
+	}
+	pattern := *right.literal
+	if _, err := path.Match(strings.TrimSuffix(pattern, "/**"), ""); err != nil {
+		return exprNode{}, patternTok.errorf("invalid pattern %q", pattern)
+	}
+	l := left.eval
+	return exprNode{typ: typeBool, eval: func(e *Event) any { return globMatch(pattern, l(e).(string)) }}, nil
+}
+
+func (p *exprParser) parsePrimary() (exprNode, error) {
+	tok := p.next()
+	switch tok.kind {
+	case tokNumber:
+		num := tok.num
+		return exprNode{typ: typeNumber, eval: func(*Event) any { return num }}, nil
+	case tokString:
+		str := tok.str
+		return exprNode{typ: typeString, literal: &str, eval: func(*Event) any { return str }}, nil
+	case tokOp:
+		switch tok.text {
+		case "(":
+			node, err := p.parseOr()
+			if err != nil {
+				return exprNode{}, err
+			}
+			return node, p.expect(")")
+		case "[":
+			return p.parseList(tok)
+		}
+	case tokIdent:
+		switch tok.text {
+		case "true", "false":
+			value := tok.text == "true"
+			return exprNode{typ: typeBool, eval: func(*Event) any { return value }}, nil
+		}
+		if _, ok := p.accept("("); ok {
+			return p.parseCall(tok)
+		}
+		if get, ok := exprHeaderFields[tok.text]; ok {
+			return p.parseHeader(tok, get)
+		}
+		if field, ok := exprFields[tok.text]; ok {
+			return field, nil
+		}
+		return exprNode{}, tok.errorf("unknown field %q%s", tok.text, suggest(tok.text, exprNames()))
+	}
+	return exprNode{}, tok.errorf("unexpected %s", tok)
+}
+
+func (p *exprParser) parseList(open exprToken) (exprNode, error) {
+	var items []exprNode
+	for {
+		if _, ok := p.accept("]"); ok {
+			break
+		}
+		if len(items) > 0 {
+			if err := p.expect(","); err != nil {
+				return exprNode{}, err
+			}
+		}
+		item, err := p.parsePrimary()
+		if err != nil {
+			return exprNode{}, err
+		}
+		if item.typ == typeList {
+			return exprNode{}, open.errorf("lists cannot be nested")
+		}
+		if len(items) > 0 && item.typ != items[0].typ {
+			return exprNode{}, open.errorf("list mixes %s and %s", items[0].typ, item.typ)
+		}
+		items = append(items, item)
+	}
+	if len(items) == 0 {
+		return exprNode{}, open.errorf("list is empty")
+	}
+	return exprNode{typ: typeList, elem: items[0].typ, eval: func(e *Event) any {
+		out := make([]any, len(items))
+		for i, item := range items {
+			out[i] = item.eval(e)
+		}
+		return out
+	}}, nil
+}
+
+func (p *exprParser) parseHeader(tok exprToken, get func(*Event) map[string]string) (exprNode, error) {
+	if err := p.expect("["); err != nil {
+		return exprNode{}, err
+	}
+	name := p.next()
+	if name.kind != tokString {
+		return exprNode{}, name.errorf("%s needs a quoted header name, got %s", tok.text, name)
+	}
+	if err := p.expect("]"); err != nil {
+		return exprNode{}, err
+	}
+	key := strings.ToLower(name.str)
+	return stringField(func(e *Event) string { return get(e)[key] }), nil
+}
+
+func (p *exprParser) parseCall(name exprToken) (exprNode, error) {
+	fn, ok := exprFuncs[name.text]
+	if !ok {
+		return exprNode{}, name.errorf("unknown function %q%s", name.text, suggest(name.text, exprFuncNames()))
+	}
+	var args []exprNode
+	for {
+		if _, ok := p.accept(")"); ok {
+			break
+		}
+		if len(args) > 0 {
+			if err := p.expect(","); err != nil {
+				return exprNode{}, err
+			}
+		}
+		arg, err := p.parseOr()
+		if err != nil {
+			return exprNode{}, err
+		}
+		args = append(args, arg)
+	}
+	if len(args) != len(fn.args) {
+		return exprNode{}, name.errorf("%s takes %d argument(s), got %d", name.text, len(fn.args), len(args))
+	}
+	for i, arg := range args {
+		if arg.typ != fn.args[i] {
+			return exprNode{}, name.errorf("argument %d of %s must be a %s, got %s", i+1, name.text, fn.args[i], arg.typ)
+		}
+	}
+	return exprNode{typ: fn.ret, eval: func(e *Event) any {
+		values := make([]any, len(args))
+		for i, arg := range args {
+			values[i] = arg.eval(e)
+		}
+		return fn.call(values)
+	}}, nil
+}
+
+func exprNames() []string {
+	names := make([]string, 0, len(exprFields)+len(exprHeaderFields))
+	for name := range exprFields {
+		names = append(names, name)
+	}
+	for name := range exprHeaderFields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func exprFuncNames() []string {
+	names := make([]string, 0, len(exprFuncs))
+	for name := range exprFuncs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// suggest returns a "did you mean" hint for the closest of names, if any is
+// close enough to be a typo.
+func suggest(got string, names []string) string {
+	best, bestDistance := "", 3
+	for _, name := range names {
+		if d := editDistance(got, name); d < bestDistance {
+			best, bestDistance = name, d
+		}
+	}
+	if best == "" {
+		return ""
+	}
+	return fmt.Sprintf("; did you mean %q?", best)
+}
+
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
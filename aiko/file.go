@@ -0,0 +1,435 @@
+package aiko
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultFilePrefix    = "aiko-events"
+	defaultMaxFileBytes  = 64 << 20
+	defaultMaxFileAge    = time.Hour
+	activeFileSuffix     = ".tmp"
+	fileTimestampLayout  = "20060102T150405.000000000Z"
+	ndjsonFileExtension  = ".ndjson"
+	gzipFileExtension    = ".ndjson.gz"
+	minFileRotationCheck = time.Second
+	clientIPComment      = "client_ip="
+)
+
+type FileExporterConfig struct {
+	Dir    string
+	Prefix string
+	Gzip   bool
+
+	MaxFileBytes  int64
+	MaxFileAge    time.Duration
+	MaxFiles      int
+	MaxTotalBytes int64
+}
+
+// FileExporter writes events as NDJSON into Dir. The active file carries a
+// .tmp suffix and is renamed once rotated, so shippers only see closed files;
+// .tmp files left by a crash are trimmed to their last complete event and
+// renamed when the next exporter opens Dir. With Gzip enabled every event is
+// written as its own gzip member whose content is exactly what GzipEvent
+// compresses, so files can be replayed to ingest. The client IP is kept as a
+// client_ip field on NDJSON lines and in the gzip member header comment;
+// ReadEventFile restores it. A Dir and Prefix pair must belong to one
+// exporter at a time.
+type FileExporter struct {
+	cfg FileExporterConfig
+
+	mu       sync.Mutex
+	file     *os.File
+	path     string
+	size     int64
+	openedAt time.Time
+	seq      int
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+func NewFileExporter(cfg FileExporterConfig) (*FileExporter, error) {
+	cfg.Dir = strings.TrimSpace(cfg.Dir)
+	if cfg.Dir == "" {
+		return nil, errors.New("file exporter dir is required")
+	}
+	cfg.Prefix = strings.TrimSpace(cfg.Prefix)
+	if cfg.Prefix == "" {
+		cfg.Prefix = defaultFilePrefix
+	}
+	if strings.ContainsAny(cfg.Prefix, `/\`) {
+		return nil, errors.New("file exporter prefix must not contain path separators")
+	}
+	if cfg.MaxFileBytes <= 0 {
+		cfg.MaxFileBytes = defaultMaxFileBytes
+	}
+	if cfg.MaxFileAge <= 0 {
+		cfg.MaxFileAge = defaultMaxFileAge
+	}
+	if cfg.MaxFiles < 0 || cfg.MaxTotalBytes < 0 {
+		return nil, errors.New("file exporter retention limits must not be negative")
+	}
+	if err := os.MkdirAll(cfg.Dir, 0o700); err != nil {
+		return nil, fmt.Errorf("create file exporter dir: %w", err)
+	}
+
+	e := &FileExporter{
+		cfg:  cfg,
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	if err := e.recoverActiveFiles(); err != nil {
+		return nil, err
+	}
+	go e.rotateLoop()
+	return e, nil
+}
+
+func (e *FileExporter) Name() string {
+	return "file"
+}
+
+func (e *FileExporter) MaxBatchSize() int {
+	return 100
+}
+
+// fileRecord is an event as written to an NDJSON file: the event's own
+// fields plus the client IP, which is not part of the event JSON.
+type fileRecord struct {
+	Event
+	ClientIP string `json:"client_ip,omitempty"`
+}
+
+func (e *FileExporter) Export(_ context.Context, events []Event) error {
+	var buf bytes.Buffer
+	for _, evt := range events {
+		if e.cfg.Gzip {
+			comment := ""
+			if clientIP := evt.ClientIP(); clientIP != "" {
+				comment = clientIPComment + clientIP
+			}
+			payload, err := gzipEvent(evt, comment)
+			if err != nil {
+				return err
+			}
+			buf.Write(payload)
+			continue
+		}
+		if err := json.NewEncoder(&buf).Encode(fileRecord{Event: evt, ClientIP: evt.ClientIP()}); err != nil {
+			return err
+		}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.file != nil && e.size > 0 && e.size+int64(buf.Len()) > e.cfg.MaxFileBytes {
+		if err := e.rotateLocked(); err != nil {
+			return err
+		}
+	}
+	if e.file == nil {
+		if err := e.openLocked(); err != nil {
+			return err
+		}
+	}
+	n, err := e.file.Write(buf.Bytes())
+	if err != nil {
+		if n > 0 {
+			return errors.Join(err, e.discardPartialLocked())
+		}
+		return err
+	}
+	e.size += int64(n)
+	if e.size >= e.cfg.MaxFileBytes {
+		return e.rotateLocked()
+	}
+	return nil
+}
+
+func (e *FileExporter) Flush(context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.file == nil {
+		return nil
+	}
+	return e.file.Sync()
+}
+
+func (e *FileExporter) Shutdown(context.Context) error {
+	e.stopOnce.Do(func() {
+		close(e.stop)
+	})
+	<-e.done
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.rotateLocked()
+}
+
+func (e *FileExporter) rotateLoop() {
+	defer close(e.done)
+	interval := e.cfg.MaxFileAge / 4
+	if interval < minFileRotationCheck {
+		interval = minFileRotationCheck
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-e.stop:
+			return
+		case <-ticker.C:
+			e.mu.Lock()
+			if e.file != nil && time.Since(e.openedAt) >= e.cfg.MaxFileAge {
+				_ = e.rotateLocked()
+			}
+			e.mu.Unlock()
+		}
+	}
+}
+
+func (e *FileExporter) extension() string {
+	if e.cfg.Gzip {
+		return gzipFileExtension
+	}
+	return ndjsonFileExtension
+}
+
+func (e *FileExporter) openLocked() error {
+	now := time.Now().UTC()
+	e.seq++
+	name := fmt.Sprintf("%s-%s-%06d%s", e.cfg.Prefix, now.Format(fileTimestampLayout), e.seq, e.extension())
+	path := filepath.Join(e.cfg.Dir, name)
+	file, err := os.OpenFile(path+activeFileSuffix, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0o600)
+	if err != nil {
+		return fmt.Errorf("open event file: %w", err)
+	}
+	e.file = file
+	e.path = path
+	e.size = 0
+	e.openedAt = now
+	return nil
+}
+
+func (e *FileExporter) rotateLocked() error {
+	if e.file == nil {
+		return nil
+	}
+	file, path, size := e.file, e.path, e.size
+	e.file, e.path, e.size = nil, "", 0
+
+	syncErr := file.Sync()
+	closeErr := file.Close()
+	if size == 0 {
+		return errors.Join(syncErr, closeErr, os.Remove(path+activeFileSuffix))
+	}
+	if err := errors.Join(syncErr, closeErr); err != nil {
+		return err
+	}
+	if err := os.Rename(path+activeFileSuffix, path); err != nil {
+		return fmt.Errorf("finalize event file: %w", err)
+	}
+	return e.enforceRetention()
+}
+
+// discardPartialLocked cuts a short write back off the active file so the
+// next record does not land after a torn one. If that fails the file is
+// closed as is and left for recoverActiveFiles to trim.
+func (e *FileExporter) discardPartialLocked() error {
+	err := e.file.Truncate(e.size)
+	if err == nil {
+		_, err = e.file.Seek(e.size, io.SeekStart)
+	}
+	if err == nil {
+		return nil
+	}
+	closeErr := e.file.Close()
+	e.file, e.path, e.size = nil, "", 0
+	return errors.Join(err, closeErr)
+}
+
+// recoverActiveFiles finalizes .tmp files a crashed process left in Dir. A
+// write cut short by the crash is dropped so the file ends on a complete
+// event; files with no complete event are removed.
+func (e *FileExporter) recoverActiveFiles() error {
+	matches, err := filepath.Glob(filepath.Join(e.cfg.Dir, e.cfg.Prefix+"-*"+e.extension()+activeFileSuffix))
+	if err != nil {
+		return err
+	}
+	for _, tmp := range matches {
+		if !e.ownsFile(filepath.Base(tmp), e.extension()+activeFileSuffix) {
+			continue
+		}
+		raw, err := os.ReadFile(tmp)
+		if err != nil {
+			return fmt.Errorf("recover event file: %w", err)
+		}
+		_, valid := decodeEventFile(raw, e.cfg.Gzip)
+		if valid == 0 {
+			if err := os.Remove(tmp); err != nil {
+				return fmt.Errorf("recover event file: %w", err)
+			}
+			continue
+		}
+		if valid < len(raw) {
+			if err := os.Truncate(tmp, int64(valid)); err != nil {
+				return fmt.Errorf("recover event file: %w", err)
+			}
+		}
+		if err := os.Rename(tmp, strings.TrimSuffix(tmp, activeFileSuffix)); err != nil {
+			return fmt.Errorf("recover event file: %w", err)
+		}
+	}
+	if len(matches) == 0 {
+		return nil
+	}
+	return e.enforceRetention()
+}
+
+func (e *FileExporter) enforceRetention() error {
+	if e.cfg.MaxFiles == 0 && e.cfg.MaxTotalBytes == 0 {
+		return nil
+	}
+	files, err := e.ClosedFiles()
+	if err != nil {
+		return err
+	}
+
+	sizes := make([]int64, len(files))
+	var total int64
+	for i, path := range files {
+		if info, err := os.Stat(path); err == nil {
+			sizes[i] = info.Size()
+			total += sizes[i]
+		}
+	}
+
+	var errs []error
+	for i := 0; i < len(files); i++ {
+		overCount := e.cfg.MaxFiles > 0 && len(files)-i > e.cfg.MaxFiles
+		overBytes := e.cfg.MaxTotalBytes > 0 && total > e.cfg.MaxTotalBytes
+		if !overCount && !overBytes {
+			break
+		}
+		if err := os.Remove(files[i]); err != nil && !errors.Is(err, os.ErrNotExist) {
+			errs = append(errs, err)
+		}
+		total -= sizes[i]
+	}
+	return errors.Join(errs...)
+}
+
+// ClosedFiles lists finalized event files, oldest first.
+func (e *FileExporter) ClosedFiles() ([]string, error) {
+	entries, err := os.ReadDir(e.cfg.Dir)
+	if err != nil {
+		return nil, err
+	}
+	var out []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !e.ownsFile(name, e.extension()) {
+			continue
+		}
+		out = append(out, filepath.Join(e.cfg.Dir, name))
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+// ownsFile reports whether name is one this exporter generates: its prefix,
+// a timestamp and sequence number, then suffix. Matching the whole pattern
+// keeps an exporter with prefix "aiko" away from the files of one with
+// prefix "aiko-events" in the same directory.
+func (e *FileExporter) ownsFile(name, suffix string) bool {
+	rest, ok := strings.CutPrefix(name, e.cfg.Prefix+"-")
+	if !ok {
+		return false
+	}
+	if rest, ok = strings.CutSuffix(rest, suffix); !ok {
+		return false
+	}
+	stamp, seq, ok := strings.Cut(rest, "-")
+	if !ok || len(seq) < 6 || strings.Trim(seq, "0123456789") != "" {
+		return false
+	}
+	_, err := time.Parse(fileTimestampLayout, stamp)
+	return err == nil
+}
+
+// ReadEventFile decodes a file written by FileExporter, NDJSON or gzip by
+// its extension, restoring each event's client IP. It fails if the file
+// ends in a partial event.
+func ReadEventFile(path string) ([]Event, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	gz := strings.HasSuffix(strings.TrimSuffix(path, activeFileSuffix), gzipFileExtension)
+	events, valid := decodeEventFile(raw, gz)
+	if valid < len(raw) {
+		return events, fmt.Errorf("event file %s is truncated after %d events", path, len(events))
+	}
+	return events, nil
+}
+
+// decodeEventFile decodes the complete events at the start of raw and
+// returns how many bytes they take up.
+func decodeEventFile(raw []byte, gz bool) ([]Event, int) {
+	var events []Event
+	if !gz {
+		valid := 0
+		for valid < len(raw) {
+			end := bytes.IndexByte(raw[valid:], '\n')
+			if end < 0 {
+				break
+			}
+			var record fileRecord
+			if err := json.Unmarshal(raw[valid:valid+end], &record); err != nil {
+				break
+			}
+			events = append(events, record.Event.WithClientIP(record.ClientIP))
+			valid += end + 1
+		}
+		return events, valid
+	}
+
+	// bytes.Reader is an io.ByteReader, so gzip reads exactly one member at
+	// a time and the reader's position marks where the next one starts
+	r := bytes.NewReader(raw)
+	valid := 0
+	for r.Len() > 0 {
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			break
+		}
+		zr.Multistream(false)
+		var evt Event
+		if err := json.NewDecoder(zr).Decode(&evt); err != nil {
+			break
+		}
+		if _, err := io.Copy(io.Discard, zr); err != nil {
+			break
+		}
+		events = append(events, evt.WithClientIP(strings.TrimPrefix(zr.Comment, clientIPComment)))
+		valid = len(raw) - r.Len()
+	}
+	return events, valid
+}
+
+var _ Exporter = (*FileExporter)(nil)
@@ -14,32 +14,32 @@ import (
 	"github.com/valyala/fasthttp"
 )
 
-func (m *Monitor) actorFromHTTPRequest(r *http.Request) *ActorContext {
-	if m == nil || r == nil || !actorConfigured(m.cfg.Actor) {
+func (m *Monitor) actorFromHTTPRequest(cfg ActorConfig, r *http.Request) *ActorContext {
+	if m == nil || r == nil || !actorConfigured(cfg) {
 		return nil
 	}
 	headers := CanonicalHeaders(r.Header)
-	return m.resolveActor(ActorResolveContext{
+	return m.resolveActor(cfg, ActorResolveContext{
 		Headers:     headers,
 		Cookies:     cookiesFromHTTPRequest(r),
 		HTTPRequest: r,
 	})
 }
 
-func (m *Monitor) actorFromFastHTTP(ctx *fasthttp.RequestCtx) *ActorContext {
-	if m == nil || ctx == nil || !actorConfigured(m.cfg.Actor) {
+func (m *Monitor) actorFromFastHTTP(cfg ActorConfig, ctx *fasthttp.RequestCtx) *ActorContext {
+	if m == nil || ctx == nil || !actorConfigured(cfg) {
 		return nil
 	}
 	headers := CanonicalFastHTTPHeaders(ctx.Request.Header.All())
-	return m.resolveActor(ActorResolveContext{
+	return m.resolveActor(cfg, ActorResolveContext{
 		Headers:            headers,
 		Cookies:            cookiesFromFastHTTPRequest(ctx),
 		FastHTTPRequestCtx: ctx,
 	})
 }
 
-func (m *Monitor) resolveActor(ctx ActorResolveContext) *ActorContext {
-	cfg := normalizeActorConfig(m.cfg.Actor)
+func (m *Monitor) resolveActor(cfg ActorConfig, ctx ActorResolveContext) *ActorContext {
+	cfg = normalizeActorConfig(cfg)
 	if cfg.Provider == ActorProviderCustom {
 		return m.resolveCustomActor(cfg, ctx)
 	}
@@ -48,25 +48,25 @@ func (m *Monitor) resolveActor(ctx ActorResolveContext) *ActorContext {
 
 func (m *Monitor) resolveCustomActor(cfg ActorConfig, ctx ActorResolveContext) *ActorContext {
 	if cfg.Resolve == nil {
-		m.verbosef("actor omitted provider=custom reason=missing_resolver")
+		m.log.debug("actor omitted", "provider", ActorProviderCustom, "reason", "missing_resolver")
 		return nil
 	}
 	actor, err := cfg.Resolve(ctx)
 	if err != nil {
-		m.verbosef("actor omitted provider=custom reason=resolver_error error=%s", err)
+		m.log.debug("actor omitted", "provider", ActorProviderCustom, "reason", "resolver_error", "error", err)
 		return nil
 	}
 	actor = normalizeCustomActor(actor)
 	if actor == nil {
-		m.verbosef("actor omitted provider=custom reason=resolver_empty")
+		m.log.debug("actor omitted", "provider", ActorProviderCustom, "reason", "resolver_empty")
 		return nil
 	}
-	m.verbosef(
-		"actor resolved provider=%s id=%s email=%s org_id=%s",
-		actor.Provider,
-		present(actor.ID != ""),
-		present(actor.Email != ""),
-		present(actor.OrgID != ""),
+	m.log.debug(
+		"actor resolved",
+		"provider", actor.Provider,
+		"id", present(actor.ID != ""),
+		"email", present(actor.Email != ""),
+		"org_id", present(actor.OrgID != ""),
 	)
 	return actor
 }
@@ -74,26 +74,26 @@ func (m *Monitor) resolveCustomActor(cfg ActorConfig, ctx ActorResolveContext) *
 func (m *Monitor) resolveTokenActor(cfg ActorConfig, ctx ActorResolveContext) *ActorContext {
 	carrierType, carrierName, carrierValue := actorCarrierValue(cfg, ctx)
 	extractorType := actorExtractorType(cfg)
-	m.verbosef(
-		"actor configured provider=%s carrier=%s carrier_name=%s extractor=%s claim_id=%s claim_email=%s claim_org_id=%s",
-		cfg.Provider,
-		carrierType,
-		carrierName,
-		extractorType,
-		cfg.Claims.ID,
-		cfg.Claims.Email,
-		cfg.Claims.OrgID,
+	m.log.debug(
+		"actor configured",
+		"provider", cfg.Provider,
+		"carrier", carrierType,
+		"carrier_name", carrierName,
+		"extractor", extractorType,
+		"claim_id", cfg.Claims.ID,
+		"claim_email", cfg.Claims.Email,
+		"claim_org_id", cfg.Claims.OrgID,
 	)
 
 	token := tokenFromActorCarrier(cfg, carrierValue)
 	if token == "" {
-		m.verbosef("actor omitted provider=%s reason=missing_token carrier=%s carrier_name=%s", cfg.Provider, carrierType, carrierName)
+		m.log.debug("actor omitted", "provider", cfg.Provider, "reason", "missing_token", "carrier", carrierType, "carrier_name", carrierName)
 		return nil
 	}
 
 	claims, ok := decodeJWTClaims(token)
 	if !ok {
-		m.verbosef("actor omitted provider=%s reason=invalid_jwt carrier=%s carrier_name=%s", cfg.Provider, carrierType, carrierName)
+		m.log.debug("actor omitted", "provider", cfg.Provider, "reason", "invalid_jwt", "carrier", carrierType, "carrier_name", carrierName)
 		return nil
 	}
 
@@ -104,19 +104,106 @@ func (m *Monitor) resolveTokenActor(cfg ActorConfig, ctx ActorResolveContext) *A
 		OrgID:    stringAtPath(claims, cfg.Claims.OrgID),
 	}
 	if actor.ID == "" && actor.Email == "" && actor.OrgID == "" {
-		m.verbosef("actor omitted provider=%s reason=claims_unresolved", cfg.Provider)
+		m.log.debug("actor omitted", "provider", cfg.Provider, "reason", "claims_unresolved")
 		return nil
 	}
-	m.verbosef(
-		"actor resolved provider=%s id=%s email=%s org_id=%s",
-		actor.Provider,
-		present(actor.ID != ""),
-		present(actor.Email != ""),
-		present(actor.OrgID != ""),
+	m.log.debug(
+		"actor resolved",
+		"provider", actor.Provider,
+		"id", present(actor.ID != ""),
+		"email", present(actor.Email != ""),
+		"org_id", present(actor.OrgID != ""),
 	)
 	return actor
 }
 
+// ActorExplanation describes how an actor config treats one sample value.
+type ActorExplanation struct {
+	Provider    ActorProvider
+	Carrier     string
+	CarrierName string
+	Extractor   string
+	TokenFound  bool
+	ValidJWT    bool
+	Claims      []ActorClaimResolution
+	// ClaimNames lists the top-level claims present in the token.
+	ClaimNames []string
+	Actor      *ActorContext
+	// Reason is why no actor resolved: missing_token, invalid_jwt,
+	// claims_unresolved or custom_resolver. It is empty on success.
+	Reason string
+}
+
+type ActorClaimResolution struct {
+	Field    string
+	Path     string
+	Value    string
+	Resolved bool
+}
+
+// ExplainActor runs token extraction and claim mapping for cfg against sample,
+// the raw value of the configured header or cookie. Custom resolvers cannot
+// be explained without a request.
+func ExplainActor(cfg ActorConfig, sample string) ActorExplanation {
+	cfg = normalizeActorConfig(cfg)
+	carrier, carrierName, _ := actorCarrierValue(cfg, ActorResolveContext{})
+	out := ActorExplanation{
+		Provider:    cfg.Provider,
+		Carrier:     carrier,
+		CarrierName: carrierName,
+		Extractor:   actorExtractorType(cfg),
+	}
+	if cfg.Provider == ActorProviderCustom {
+		out.Reason = "custom_resolver"
+		return out
+	}
+
+	token := tokenFromActorCarrier(cfg, sample)
+	if token == "" {
+		out.Reason = "missing_token"
+		return out
+	}
+	out.TokenFound = true
+	claims, ok := decodeJWTClaims(token)
+	if !ok {
+		out.Reason = "invalid_jwt"
+		return out
+	}
+	out.ValidJWT = true
+	for name := range claims {
+		out.ClaimNames = append(out.ClaimNames, name)
+	}
+	sort.Strings(out.ClaimNames)
+
+	actor := &ActorContext{Provider: cfg.Provider}
+	for _, claim := range []struct {
+		field string
+		path  string
+		dst   *string
+	}{
+		{"id", cfg.Claims.ID, &actor.ID},
+		{"email", cfg.Claims.Email, &actor.Email},
+		{"org_id", cfg.Claims.OrgID, &actor.OrgID},
+	} {
+		if claim.path == "" {
+			continue
+		}
+		*claim.dst = stringAtPath(claims, claim.path)
+		out.Claims = append(out.Claims, ActorClaimResolution{
+			Field:    claim.field,
+			Path:     claim.path,
+			Value:    *claim.dst,
+			Resolved: *claim.dst != "",
+		})
+	}
+	if actor.ID == "" && actor.Email == "" && actor.OrgID == "" {
+		out.Reason = "claims_unresolved"
+		return out
+	}
+	out.Actor = actor
+	return out
+}
+
 func redactActorCarrierHeaders(headers map[string]string, cfg ActorConfig) {
 	cfg = normalizeActorConfig(cfg)
 	if cfg.Token.Header != nil {
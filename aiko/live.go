@@ -0,0 +1,127 @@
+package aiko
+
+import "errors"
+
+// DynamicConfig is the part of the configuration that can change on a running
+// Monitor through Update or WatchConfigFile.
+type DynamicConfig struct {
+	// Enabled false pauses capture: the middleware passes requests straight
+	// through and AddEvent drops events. Queued events are still delivered.
+	Enabled bool
+	Verbose bool
+	// CaptureBodies false captures metadata only; request and response
+	// bodies are neither buffered nor sent.
+	CaptureBodies bool
+	Actor         ActorConfig
+	Sampling      SamplingConfig
+	Redaction     RedactionConfig
+	Capture       CaptureConfig
+}
+
+// liveSettings is a DynamicConfig snapshot with the values derived from it.
+// A snapshot is never mutated once stored, so the middleware loads it once
+// per request and sees consistent values without locking.
+type liveSettings struct {
+	DynamicConfig
+	redactor redactor
+	sampler  sampler
+	capture  captureFilters
+}
+
+func newLiveSettings(cfg Config, enabled bool) *liveSettings {
+	return &liveSettings{
+		DynamicConfig: DynamicConfig{
+			Enabled:       enabled,
+			Verbose:       cfg.Verbose,
+			CaptureBodies: true,
+			Actor:         normalizeActorConfig(cfg.Actor),
+			Sampling:      cfg.Sampling,
+			Redaction:     cfg.Redaction,
+			Capture:       cfg.Capture,
+		},
+		redactor: newRedactor(cfg.Redaction),
+		sampler:  newSampler(cfg.Sampling),
+		capture:  newCaptureFilters(cfg.Capture),
+	}
+}
+
+func (m *Monitor) live() *liveSettings {
+	if s := m.settings.Load(); s != nil {
+		return s
+	}
+	return &liveSettings{}
+}
+
+// DynamicConfig returns the settings currently in effect.
+func (m *Monitor) DynamicConfig() DynamicConfig {
+	if m == nil {
+		return DynamicConfig{}
+	}
+	// the copy shares no pointers or slices with the stored snapshot, so an
+	// Update callback can edit it freely
+	cfg := m.live().DynamicConfig
+	cfg.Actor.Token = normalizeActorTokenConfig(cfg.Actor.Token)
+	cfg.Sampling.Rules = append([]SamplingRule(nil), cfg.Sampling.Rules...)
+	for i, rule := range cfg.Sampling.Rules {
+		if rule.Actor != nil {
+			actor := *rule.Actor
+			cfg.Sampling.Rules[i].Actor = &actor
+		}
+	}
+	cfg.Capture.Include = append([]CaptureFilter(nil), cfg.Capture.Include...)
+	cfg.Capture.Exclude = append([]CaptureFilter(nil), cfg.Capture.Exclude...)
+	cfg.Capture.Bodies.Routes = append([]BodyRoute(nil), cfg.Capture.Bodies.Routes...)
+	cfg.Redaction = RedactionConfig{
+		Headers:  append([]string(nil), cfg.Redaction.Headers...),
+		BodyKeys: append([]string(nil), cfg.Redaction.BodyKeys...),
+	}
+	return cfg
+}
+
+// Update changes settings on a running monitor. update receives a copy of
+// the current DynamicConfig; the result is validated and published as a
+// whole, so concurrent requests see either the old or the new settings.
+// Updates are serialized.
+func (m *Monitor) Update(update func(*DynamicConfig)) error {
+	if m == nil {
+		return errors.New("monitor is nil")
+	}
+	return m.updateLive(func(cfg *DynamicConfig) error {
+		update(cfg)
+		return nil
+	})
+}
+
+func (m *Monitor) updateLive(update func(*DynamicConfig) error) error {
+	m.liveMu.Lock()
+	defer m.liveMu.Unlock()
+	next := m.DynamicConfig()
+	if err := update(&next); err != nil {
+		return err
+	}
+	if next.Enabled && !m.enabled {
+		return errors.New("monitor was created disabled and cannot be enabled")
+	}
+	if err := validateActorConfig(next.Actor); err != nil {
+		return err
+	}
+	if err := validateCaptureConfig(Config{Sampling: next.Sampling, Redaction: next.Redaction, Capture: next.Capture}); err != nil {
+		return err
+	}
+	next.Actor = normalizeActorConfig(next.Actor)
+	m.settings.Store(&liveSettings{
+		DynamicConfig: next,
+		redactor:      newRedactor(next.Redaction),
+		sampler:       newSampler(next.Sampling),
+		capture:       newCaptureFilters(next.Capture),
+	})
+	m.log.verbose.Store(next.Verbose)
+	m.log.info(
+		"config updated",
+		"enabled", next.Enabled,
+		"capture_bodies", next.CaptureBodies,
+		"sample_rate", next.Sampling.Rate,
+		"actor_provider", next.Actor.Provider,
+	)
+	return nil
+}
@@ -0,0 +1,79 @@
+package aiko
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"unicode"
+)
+
+// sdkLogger writes SDK diagnostics as structured records to Config.SlogHandler
+// or, as a fallback, as "message key=value" lines to a *log.Logger.
+//
+// Debug and info records are verbose detail and are dropped unless Verbose is
+// on; warnings, errors and notices are always written.
+type sdkLogger struct {
+	slog    *slog.Logger
+	text    *log.Logger
+	verbose atomic.Bool
+}
+
+func newSDKLogger(cfg Config) *sdkLogger {
+	l := &sdkLogger{}
+	if cfg.SlogHandler != nil {
+		l.slog = slog.New(cfg.SlogHandler).With("component", "aiko")
+	} else {
+		l.text = resolveLogger(cfg)
+	}
+	l.verbose.Store(cfg.Verbose)
+	return l
+}
+
+func (l *sdkLogger) debug(msg string, args ...any) { l.emit(slog.LevelDebug, true, msg, args) }
+
+func (l *sdkLogger) info(msg string, args ...any) { l.emit(slog.LevelInfo, true, msg, args) }
+
+func (l *sdkLogger) warn(msg string, args ...any) { l.emit(slog.LevelWarn, false, msg, args) }
+
+func (l *sdkLogger) error(msg string, args ...any) { l.emit(slog.LevelError, false, msg, args) }
+
+// notice logs at info level even when Verbose is off.
+func (l *sdkLogger) notice(msg string, args ...any) { l.emit(slog.LevelInfo, false, msg, args) }
+
+func (l *sdkLogger) emit(level slog.Level, verboseOnly bool, msg string, args []any) {
+	if l == nil || (verboseOnly && !l.verbose.Load()) {
+		return
+	}
+	if l.slog != nil {
+		l.slog.Log(context.Background(), level, msg, args...)
+		return
+	}
+	if l.text == nil {
+		return
+	}
+	var b strings.Builder
+	if verboseOnly {
+		b.WriteString("verbose ")
+	} else {
+		b.WriteString("aiko ")
+	}
+	b.WriteString(msg)
+	for i := 0; i+1 < len(args); i += 2 {
+		fmt.Fprintf(&b, " %v=%s", args[i], textValue(args[i+1]))
+	}
+	l.text.Print(b.String())
+}
+
+// textValue formats v for the text log, quoting it when spaces, "=", quotes
+// or control characters would otherwise make the key=value pairs ambiguous.
+func textValue(v any) string {
+	s := fmt.Sprint(v)
+	if strings.ContainsAny(s, " =\"") || strings.ContainsFunc(s, func(r rune) bool { return !unicode.IsPrint(r) }) {
+		return strconv.Quote(s)
+	}
+	return s
+}
@@ -3,8 +3,8 @@ package aiko
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"fmt"
-	"io"
 	"net"
 	"net/http"
 	"strings"
@@ -28,18 +28,30 @@ func NewNoop() *Monitor {
 
 func NetHTTPMiddleware(monitor *Monitor) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
-		if monitor == nil || !monitor.Enabled() {
+		if monitor == nil || !monitor.enabled {
 			return next
 		}
 
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			live := monitor.live()
+			if !live.Enabled || !live.capture.allows(r.Method, r.Host, r.URL.Path) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			roll := monitor.roll(live.sampler)
+			if roll >= live.sampler.maxRate(r.Method, r.URL.Path) {
+				next.ServeHTTP(w, r)
+				return
+			}
 			start := time.Now()
 
+			bodies := live.capture.bodies
+			rule := bodies.route(r.Method, r.URL.Path)
+			buffer := live.CaptureBodies && rule.buffers()
 			var reqBodyBuf []byte
-			if r.Body != nil {
-				reqBodyBuf, _ = io.ReadAll(r.Body)
-				_ = r.Body.Close()
-				r.Body = io.NopCloser(bytes.NewReader(reqBodyBuf))
+			var reqTruncated bool
+			if buffer && r.Body != nil {
+				reqBodyBuf, reqTruncated = bufferRequestBody(r, bodies.maxBytes)
 			}
 
 			reqHeaders := CanonicalHeaders(r.Header)
@@ -48,9 +60,13 @@ func NetHTTPMiddleware(monitor *Monitor) func(http.Handler) http.Handler {
 			if validIP(peerIP) {
 				reqHeaders["x-aiko-peer-ip"] = normalizeIP(peerIP)
 			}
-			requestBody := ParseJSONBody(reqBodyBuf)
+
+			scope := &captureScope{}
+			r = r.WithContext(context.WithValue(r.Context(), captureScopeKey{}, scope))
 
 			capture := NewResponseCapture(w)
+			capture.discardBody = !buffer
+			capture.maxBody = bodies.maxBytes
 			var recovered any
 
 			func() {
@@ -67,24 +83,9 @@ func NetHTTPMiddleware(monitor *Monitor) func(http.Handler) http.Handler {
 			resHeaders := CanonicalHeaders(capture.Header())
 			rawRes := capture.body.Bytes()
 			statusCode := capture.StatusCode()
-
-			var responseBody any
-			switch {
-			case recovered != nil:
-				responseBody = map[string]string{"error": fmt.Sprint(recovered)}
-			case len(rawRes) == 0 && statusCode >= 500:
-				text := http.StatusText(statusCode)
-				if text == "" {
-					text = "Internal Server Error"
-				}
-				responseBody = map[string]string{"error": text}
-			default:
-				responseBody = DecodeResponseBody(rawRes, resHeaders)
-			}
-
 			requestURI := r.URL.RequestURI()
-			actor := monitor.actorFromHTTPRequest(r)
-			redactActorCarrierHeaders(reqHeaders, monitor.cfg.Actor)
+			actor := monitor.actorFromHTTPRequest(live.Actor, r)
+			redactActorCarrierHeaders(reqHeaders, live.Actor)
 
 			evt := Event{
 				URL:             requestURI,
@@ -93,22 +94,50 @@ func NetHTTPMiddleware(monitor *Monitor) func(http.Handler) http.Handler {
 				StatusCode:      statusCode,
 				Actor:           actor,
 				RequestHeaders:  reqHeaders,
-				RequestBody:     requestBody,
 				ResponseHeaders: resHeaders,
-				ResponseBody:    responseBody,
 				DurationMS:      duration.Milliseconds(),
 			}
 
+			skip := scope.finish(&evt)
 			evt = normalizeEvent(evt)
-			monitor.verbosef(
-				"captured event_id=%s method=%s endpoint=%s status=%d duration_ms=%d",
-				evt.ID,
-				evt.Method,
-				evt.Endpoint,
-				evt.StatusCode,
-				evt.DurationMS,
-			)
-			monitor.addEvent(evt)
+			if skip {
+				monitor.log.debug("event dropped", "event_id", evt.ID, "reason", "skip_capture")
+			} else if rate, keep := monitor.sample(live.sampler, roll, evt.Method, r.URL.Path, statusCode, actor != nil); keep {
+				evt.SampleRate = rate
+				// bodies are decoded only once the event is kept and both
+				// the body policy and BodiesWhen accept it
+				if buffer && rule.keeps(statusCode, duration) && live.capture.keepsBodies(evt) {
+					if reqTruncated {
+						evt.RequestBody = truncatedBody(bodies.maxBytes)
+					} else {
+						evt.RequestBody = ParseJSONBody(reqBodyBuf)
+					}
+
+					switch {
+					case recovered != nil:
+						evt.ResponseBody = map[string]string{"error": fmt.Sprint(recovered)}
+					case capture.truncated:
+						evt.ResponseBody = truncatedBody(bodies.maxBytes)
+					case len(rawRes) == 0 && statusCode >= 500:
+						text := http.StatusText(statusCode)
+						if text == "" {
+							text = "Internal Server Error"
+						}
+						evt.ResponseBody = map[string]string{"error": text}
+					default:
+						evt.ResponseBody = DecodeResponseBody(rawRes, resHeaders)
+					}
+				}
+				monitor.log.debug(
+					"captured",
+					"event_id", evt.ID,
+					"method", evt.Method,
+					"endpoint", evt.Endpoint,
+					"status", evt.StatusCode,
+					"duration_ms", evt.DurationMS,
+				)
+				monitor.addEvent(evt)
+			}
 
 			if recovered != nil {
 				panic(recovered)
@@ -118,11 +147,21 @@ func NetHTTPMiddleware(monitor *Monitor) func(http.Handler) http.Handler {
 }
 
 func FastHTTPMiddleware(monitor *Monitor, next fasthttp.RequestHandler) fasthttp.RequestHandler {
-	if monitor == nil || !monitor.Enabled() {
+	if monitor == nil || !monitor.enabled {
 		return next
 	}
 
 	return func(ctx *fasthttp.RequestCtx) {
+		live := monitor.live()
+		if !live.Enabled || !live.capture.allows(string(ctx.Method()), string(ctx.Host()), string(ctx.Path())) {
+			next(ctx)
+			return
+		}
+		roll := monitor.roll(live.sampler)
+		if roll >= live.sampler.maxRate(string(ctx.Method()), string(ctx.Path())) {
+			next(ctx)
+			return
+		}
 		start := time.Now()
 
 		reqHeaders := CanonicalFastHTTPHeaders(ctx.Request.Header.All())
@@ -132,8 +171,23 @@ func FastHTTPMiddleware(monitor *Monitor, next fasthttp.RequestHandler) fasthttp
 			reqHeaders["x-aiko-peer-ip"] = normalizeIP(peerIP)
 		}
 
-		reqBody := append([]byte(nil), ctx.PostBody()...)
-		requestBody := ParseJSONBody(reqBody)
+		bodies := live.capture.bodies
+		rule := bodies.route(string(ctx.Method()), string(ctx.Path()))
+		buffer := live.CaptureBodies && rule.buffers()
+		// the request body is taken before the handler runs, which may reset
+		// or replace it; decoding waits until the event is kept
+		var reqBody []byte
+		var reqTruncated bool
+		if buffer {
+			if raw := ctx.PostBody(); len(raw) > bodies.maxBytes {
+				reqTruncated = true
+			} else {
+				reqBody = append([]byte(nil), raw...)
+			}
+		}
+
+		scope := &captureScope{}
+		ctx.SetUserValue(captureScopeKey{}, scope)
 
 		var recovered any
 
@@ -148,27 +202,12 @@ func FastHTTPMiddleware(monitor *Monitor, next fasthttp.RequestHandler) fasthttp
 			next(ctx)
 		}()
 
+		duration := time.Since(start)
 		status := ctx.Response.StatusCode()
 		resHeaders := CanonicalFastHTTPHeaders(ctx.Response.Header.All())
-		rawRes := append([]byte(nil), ctx.Response.Body()...)
-
-		var responseBody any
-		switch {
-		case recovered != nil:
-			responseBody = map[string]string{"error": Stringify(recovered)}
-		case len(rawRes) == 0 && status >= 500:
-			msg := fasthttp.StatusMessage(status)
-			if msg == "" {
-				msg = "Internal Server Error"
-			}
-			responseBody = map[string]string{"error": msg}
-		default:
-			responseBody = DecodeResponseBody(rawRes, resHeaders)
-		}
-
 		url := string(ctx.URI().RequestURI())
-		actor := monitor.actorFromFastHTTP(ctx)
-		redactActorCarrierHeaders(reqHeaders, monitor.cfg.Actor)
+		actor := monitor.actorFromFastHTTP(live.Actor, ctx)
+		redactActorCarrierHeaders(reqHeaders, live.Actor)
 
 		evt := Event{
 			URL:             url,
@@ -177,22 +216,51 @@ func FastHTTPMiddleware(monitor *Monitor, next fasthttp.RequestHandler) fasthttp
 			StatusCode:      status,
 			Actor:           actor,
 			RequestHeaders:  reqHeaders,
-			RequestBody:     requestBody,
 			ResponseHeaders: resHeaders,
-			ResponseBody:    responseBody,
-			DurationMS:      time.Since(start).Milliseconds(),
+			DurationMS:      duration.Milliseconds(),
 		}
 
+		skip := scope.finish(&evt)
 		evt = normalizeEvent(evt)
-		monitor.verbosef(
-			"captured event_id=%s method=%s endpoint=%s status=%d duration_ms=%d",
-			evt.ID,
-			evt.Method,
-			evt.Endpoint,
-			evt.StatusCode,
-			evt.DurationMS,
-		)
-		monitor.addEvent(evt)
+		if skip {
+			monitor.log.debug("event dropped", "event_id", evt.ID, "reason", "skip_capture")
+		} else if rate, keep := monitor.sample(live.sampler, roll, evt.Method, string(ctx.Path()), status, actor != nil); keep {
+			evt.SampleRate = rate
+			// bodies are decoded only once the event is kept and both the
+			// body policy and BodiesWhen accept it
+			if buffer && rule.keeps(status, duration) && live.capture.keepsBodies(evt) {
+				if reqTruncated {
+					evt.RequestBody = truncatedBody(bodies.maxBytes)
+				} else {
+					evt.RequestBody = ParseJSONBody(reqBody)
+				}
+
+				rawRes := ctx.Response.Body()
+				switch {
+				case recovered != nil:
+					evt.ResponseBody = map[string]string{"error": Stringify(recovered)}
+				case len(rawRes) == 0 && status >= 500:
+					msg := fasthttp.StatusMessage(status)
+					if msg == "" {
+						msg = "Internal Server Error"
+					}
+					evt.ResponseBody = map[string]string{"error": msg}
+				case len(rawRes) > bodies.maxBytes:
+					evt.ResponseBody = truncatedBody(bodies.maxBytes)
+				default:
+					evt.ResponseBody = DecodeResponseBody(append([]byte(nil), rawRes...), resHeaders)
+				}
+			}
+			monitor.log.debug(
+				"captured",
+				"event_id", evt.ID,
+				"method", evt.Method,
+				"endpoint", evt.Endpoint,
+				"status", evt.StatusCode,
+				"duration_ms", evt.DurationMS,
+			)
+			monitor.addEvent(evt)
+		}
 
 		if recovered != nil {
 			panic(recovered)
@@ -202,8 +270,13 @@ func FastHTTPMiddleware(monitor *Monitor, next fasthttp.RequestHandler) fasthttp
 
 type ResponseCapture struct {
 	http.ResponseWriter
-	status int
-	body   bytes.Buffer
+	status      int
+	body        bytes.Buffer
+	discardBody bool
+	// maxBody bounds body when set; truncated records that it was exceeded
+	// and the buffer dropped.
+	maxBody   int
+	truncated bool
 }
 
 func NewResponseCapture(w http.ResponseWriter) *ResponseCapture {
@@ -216,8 +289,13 @@ func (rw *ResponseCapture) WriteHeader(code int) {
 }
 
 func (rw *ResponseCapture) Write(b []byte) (int, error) {
-	if len(b) > 0 {
-		rw.body.Write(b)
+	if len(b) > 0 && !rw.discardBody && !rw.truncated {
+		if rw.maxBody > 0 && rw.body.Len()+len(b) > rw.maxBody {
+			rw.truncated = true
+			rw.body = bytes.Buffer{}
+		} else {
+			rw.body.Write(b)
+		}
 	}
 	return rw.ResponseWriter.Write(b)
 }
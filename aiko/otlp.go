@@ -0,0 +1,352 @@
+package aiko
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	otlpTracesPath     = "/v1/traces"
+	otlpScopeName      = "github.com/aikocorp/aiko-monitor-go/aiko"
+	otlpSpanKindServer = 2
+	otlpStatusError    = 2
+)
+
+type OTLPExporterConfig struct {
+	Endpoint    string
+	Headers     map[string]string
+	ServiceName string
+	HTTPClient  *http.Client
+}
+
+type OTLPExporter struct {
+	endpoint    string
+	headers     map[string]string
+	serviceName string
+	client      *http.Client
+}
+
+func NewOTLPExporter(cfg OTLPExporterConfig) (*OTLPExporter, error) {
+	parsed, err := url.Parse(strings.TrimSpace(cfg.Endpoint))
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return nil, errors.New("otlp endpoint must be an http or https collector URL")
+	}
+	if parsed.Path == "" || parsed.Path == "/" {
+		parsed.Path = otlpTracesPath
+	}
+	serviceName := strings.TrimSpace(cfg.ServiceName)
+	if serviceName == "" {
+		serviceName = "unknown_service:go"
+	}
+	client := cfg.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: defaultHTTPTimeout}
+	}
+	headers := make(map[string]string, len(cfg.Headers))
+	for key, value := range cfg.Headers {
+		headers[key] = value
+	}
+	return &OTLPExporter{
+		endpoint:    parsed.String(),
+		headers:     headers,
+		serviceName: serviceName,
+		client:      client,
+	}, nil
+}
+
+func (e *OTLPExporter) Name() string {
+	return "otlp"
+}
+
+func (e *OTLPExporter) MaxBatchSize() int {
+	return 100
+}
+
+func (e *OTLPExporter) Export(ctx context.Context, events []Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+	body, err := json.Marshal(e.traceRequest(events))
+	if err != nil {
+		return err
+	}
+
+	attemptCtx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(attemptCtx, http.MethodPost, e.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range e.headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return &StatusError{StatusCode: resp.StatusCode, RequestID: responseRequestID(resp.Header)}
+	}
+	return nil
+}
+
+func (e *OTLPExporter) Flush(context.Context) error {
+	return nil
+}
+
+func (e *OTLPExporter) Shutdown(context.Context) error {
+	e.client.CloseIdleConnections()
+	return nil
+}
+
+type otlpTraceRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes"`
+	Events            []otlpEvent    `json:"events,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpEvent struct {
+	TimeUnixNano string         `json:"timeUnixNano"`
+	Name         string         `json:"name"`
+	Attributes   []otlpKeyValue `json:"attributes"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpAnyValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+func otlpString(key, value string) otlpKeyValue {
+	return otlpKeyValue{Key: key, Value: otlpAnyValue{StringValue: &value}}
+}
+
+func otlpInt(key string, value int64) otlpKeyValue {
+	encoded := strconv.FormatInt(value, 10)
+	return otlpKeyValue{Key: key, Value: otlpAnyValue{IntValue: &encoded}}
+}
+
+func otlpDouble(key string, value float64) otlpKeyValue {
+	return otlpKeyValue{Key: key, Value: otlpAnyValue{DoubleValue: &value}}
+}
+
+// otlpAttribute encodes a value set through SetAttribute.
+func otlpAttribute(key string, value any) otlpKeyValue {
+	switch v := value.(type) {
+	case bool:
+		return otlpKeyValue{Key: key, Value: otlpAnyValue{BoolValue: &v}}
+	case int64:
+		return otlpInt(key, v)
+	case float64:
+		return otlpDouble(key, v)
+	default:
+		return otlpString(key, Stringify(v))
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (e *OTLPExporter) traceRequest(events []Event) otlpTraceRequest {
+	spans := make([]otlpSpan, 0, len(events))
+	for _, evt := range events {
+		spans = append(spans, otlpSpanFromEvent(evt))
+	}
+	return otlpTraceRequest{
+		ResourceSpans: []otlpResourceSpans{{
+			Resource: otlpResource{Attributes: []otlpKeyValue{
+				otlpString("service.name", e.serviceName),
+				otlpString("telemetry.sdk.name", "aiko-monitor-go"),
+				otlpString("telemetry.sdk.language", "go"),
+				otlpString("telemetry.sdk.version", sdkVersion),
+			}},
+			ScopeSpans: []otlpScopeSpans{{
+				Scope: otlpScope{Name: otlpScopeName, Version: sdkVersion},
+				Spans: spans,
+			}},
+		}},
+	}
+}
+
+func otlpSpanFromEvent(evt Event) otlpSpan {
+	end, err := time.Parse(time.RFC3339Nano, evt.Timestamp)
+	if err != nil {
+		end = time.Now().UTC()
+	}
+	start := end.Add(-time.Duration(evt.DurationMS) * time.Millisecond)
+
+	traceID, parentSpanID := traceparentIDs(evt.RequestHeaders["traceparent"])
+	if traceID == "" {
+		traceID = randomHex(16)
+	}
+
+	// events carry the request target, not the route template the handler
+	// was registered under, so http.route is left out and the span is named
+	// by method alone as the semantic conventions require
+	path, query, _ := strings.Cut(evt.Endpoint, "?")
+	attrs := []otlpKeyValue{
+		otlpString("http.request.method", evt.Method),
+		otlpString("url.path", path),
+		otlpInt("http.response.status_code", int64(evt.StatusCode)),
+		otlpInt("aiko.duration_ms", evt.DurationMS),
+		otlpString("aiko.event_id", evt.ID),
+	}
+	if query != "" {
+		attrs = append(attrs, otlpString("url.query", query))
+	}
+	if evt.SampleRate > 0 {
+		attrs = append(attrs, otlpDouble("aiko.sample_rate", evt.SampleRate))
+	}
+	for _, key := range sortedKeys(evt.Tags) {
+		attrs = append(attrs, otlpString("aiko.tag."+key, evt.Tags[key]))
+	}
+	for _, key := range sortedKeys(evt.Attributes) {
+		attrs = append(attrs, otlpAttribute("aiko.attribute."+key, evt.Attributes[key]))
+	}
+	if clientIP := evt.ClientIP(); clientIP != "" {
+		attrs = append(attrs, otlpString("client.address", clientIP))
+	}
+	if ua := evt.RequestHeaders["user-agent"]; ua != "" {
+		attrs = append(attrs, otlpString("user_agent.original", ua))
+	}
+	if evt.Actor != nil {
+		for _, kv := range [][2]string{
+			{"enduser.id", evt.Actor.ID},
+			{"enduser.email", evt.Actor.Email},
+			{"enduser.org_id", evt.Actor.OrgID},
+			{"enduser.provider", string(evt.Actor.Provider)},
+		} {
+			if kv[1] != "" {
+				attrs = append(attrs, otlpString(kv[0], kv[1]))
+			}
+		}
+	}
+
+	endNanos := strconv.FormatInt(end.UnixNano(), 10)
+	span := otlpSpan{
+		TraceID:           traceID,
+		SpanID:            randomHex(8),
+		ParentSpanID:      parentSpanID,
+		Name:              evt.Method,
+		Kind:              otlpSpanKindServer,
+		StartTimeUnixNano: strconv.FormatInt(start.UnixNano(), 10),
+		EndTimeUnixNano:   endNanos,
+		Attributes:        attrs,
+		Events: []otlpEvent{
+			{TimeUnixNano: strconv.FormatInt(start.UnixNano(), 10), Name: "aiko.request", Attributes: otlpMessageAttributes("http.request.header.", evt.RequestHeaders, "aiko.request.body", evt.RequestBody)},
+			{TimeUnixNano: endNanos, Name: "aiko.response", Attributes: otlpMessageAttributes("http.response.header.", evt.ResponseHeaders, "aiko.response.body", evt.ResponseBody)},
+		},
+	}
+	if evt.StatusCode >= 500 {
+		span.Status = otlpStatus{Code: otlpStatusError, Message: http.StatusText(evt.StatusCode)}
+	}
+	return span
+}
+
+func otlpMessageAttributes(headerPrefix string, headers map[string]string, bodyKey string, body any) []otlpKeyValue {
+	keys := make([]string, 0, len(headers))
+	for key := range headers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	attrs := make([]otlpKeyValue, 0, len(keys)+1)
+	for _, key := range keys {
+		attrs = append(attrs, otlpString(headerPrefix+key, headers[key]))
+	}
+	if body != nil {
+		if encoded, err := json.Marshal(body); err == nil {
+			attrs = append(attrs, otlpString(bodyKey, string(encoded)))
+		} else {
+			attrs = append(attrs, otlpString(bodyKey, fmt.Sprint(body)))
+		}
+	}
+	return attrs
+}
+
+func traceparentIDs(value string) (string, string) {
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) != 4 || len(parts[1]) != 32 || len(parts[2]) != 16 {
+		return "", ""
+	}
+	if _, err := hex.DecodeString(parts[1]); err != nil || strings.Trim(parts[1], "0") == "" {
+		return "", ""
+	}
+	if _, err := hex.DecodeString(parts[2]); err != nil || strings.Trim(parts[2], "0") == "" {
+		return "", ""
+	}
+	return strings.ToLower(parts[1]), strings.ToLower(parts[2])
+}
+
+func randomHex(n int) string {
+	raw := make([]byte, n)
+	if _, err := io.ReadFull(rand.Reader, raw); err != nil {
+		return fmt.Sprintf("%0*x", n*2, time.Now().UnixNano())
+	}
+	return hex.EncodeToString(raw)
+}
+
+var _ Exporter = (*OTLPExporter)(nil)
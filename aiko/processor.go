@@ -0,0 +1,159 @@
+package aiko
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// EventProcessor runs in the sender worker before an event is redacted and
+// exported. Process returns the event to keep, which may be evt changed in
+// place or a different value, and false to drop it.
+//
+// Process receives its own copy of the event's headers, bodies, tags and
+// attributes, so a processor that panics is skipped for that event even if
+// it had already changed them in place: the event continues down the chain
+// as it was before the processor ran.
+type EventProcessor struct {
+	Name    string
+	Process func(evt Event) (Event, bool)
+}
+
+// ProcessorStats counts what one EventProcessor did since the monitor started.
+type ProcessorStats struct {
+	Name      string
+	Processed uint64
+	Dropped   uint64
+	Panics    uint64
+	// Duration is the total time spent in Process.
+	Duration time.Duration
+}
+
+type processorState struct {
+	EventProcessor
+	processed atomic.Uint64
+	dropped   atomic.Uint64
+	panics    atomic.Uint64
+	nanos     atomic.Int64
+}
+
+func validateProcessors(processors []EventProcessor) error {
+	seen := make(map[string]struct{}, len(processors))
+	for i, p := range processors {
+		name := strings.TrimSpace(p.Name)
+		if name == "" {
+			return fmt.Errorf("processors[%d].name must not be empty", i)
+		}
+		if p.Process == nil {
+			return fmt.Errorf("processors[%d].process must not be nil", i)
+		}
+		if _, ok := seen[name]; ok {
+			return fmt.Errorf("processors[%d].name %q is already used", i, name)
+		}
+		seen[name] = struct{}{}
+	}
+	return nil
+}
+
+func newProcessorChain(processors []EventProcessor) []*processorState {
+	chain := make([]*processorState, len(processors))
+	for i, p := range processors {
+		p.Name = strings.TrimSpace(p.Name)
+		chain[i] = &processorState{EventProcessor: p}
+	}
+	return chain
+}
+
+// process runs evt through the processor chain and reports whether it should
+// still be exported.
+func (m *Monitor) process(evt Event) (Event, bool) {
+	for _, p := range m.processors {
+		start := time.Now()
+		next, keep, panicked := p.run(evt)
+		elapsed := time.Since(start)
+		p.processed.Add(1)
+		p.nanos.Add(int64(elapsed))
+		if panicked != nil {
+			p.panics.Add(1)
+			m.log.error("event processor panicked", "processor", p.Name, "event_id", evt.ID, "panic", fmt.Sprint(panicked))
+			continue
+		}
+		if !keep {
+			p.dropped.Add(1)
+			m.log.debug("event dropped", "event_id", evt.ID, "reason", "processor", "processor", p.Name, "duration_us", elapsed.Microseconds())
+			return Event{}, false
+		}
+		evt = next
+	}
+	return evt, true
+}
+
+func (p *processorState) run(evt Event) (next Event, keep bool, panicked any) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			panicked = rec
+		}
+	}()
+	next, keep = p.Process(cloneEvent(evt))
+	return next, keep, nil
+}
+
+// cloneEvent copies everything in evt a processor could change in place.
+func cloneEvent(evt Event) Event {
+	evt.Actor = cloneActorContext(evt.Actor)
+	evt.RequestHeaders = maps.Clone(evt.RequestHeaders)
+	evt.ResponseHeaders = maps.Clone(evt.ResponseHeaders)
+	evt.RequestBody = cloneValue(evt.RequestBody)
+	evt.ResponseBody = cloneValue(evt.ResponseBody)
+	evt.Tags = maps.Clone(evt.Tags)
+	evt.Attributes = maps.Clone(evt.Attributes)
+	return evt
+}
+
+// cloneValue deep-copies the maps and slices a decoded body is made of.
+func cloneValue(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for key, val := range v {
+			out[key] = cloneValue(val)
+		}
+		return out
+	case []any:
+		out := make([]any, len(v))
+		for i, item := range v {
+			out[i] = cloneValue(item)
+		}
+		return out
+	case map[string]string:
+		return maps.Clone(v)
+	case []string:
+		return slices.Clone(v)
+	case []byte:
+		return slices.Clone(v)
+	default:
+		return value
+	}
+}
+
+// ProcessorStats returns counters for each configured EventProcessor, in
+// chain order.
+func (m *Monitor) ProcessorStats() []ProcessorStats {
+	if m == nil {
+		return nil
+	}
+	stats := make([]ProcessorStats, len(m.processors))
+	for i, p := range m.processors {
+		stats[i] = ProcessorStats{
+			Name:      p.Name,
+			Processed: p.processed.Load(),
+			Dropped:   p.dropped.Load(),
+			Panics:    p.panics.Load(),
+			Duration:  time.Duration(p.nanos.Load()),
+		}
+	}
+	return stats
+}
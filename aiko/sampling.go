@@ -0,0 +1,361 @@
+package aiko
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SamplingRule sets the keep rate for the requests it matches. Empty fields
+// match anything.
+type SamplingRule struct {
+	// Method matches the HTTP method, case-insensitively.
+	Method string
+	// Endpoint matches the request path without its query. "*" matches
+	// within one segment and a trailing "/**" matches any number of them,
+	// so "/api/**" covers "/api" and everything below it.
+	Endpoint string
+	// Status is an exact code such as "404" or a class such as "5xx".
+	Status string
+	// Actor matches requests with (true) or without (false) a resolved actor.
+	Actor *bool
+	// Rate is the fraction of matching requests kept, between 0 and 1.
+	// Unlike SamplingConfig.Rate, 0 drops every match.
+	Rate float64
+}
+
+type samplingRule struct {
+	method   string
+	endpoint string
+	statusLo int
+	statusHi int
+	actor    *bool
+	rate     float64
+}
+
+// sampler is the compiled form of a SamplingConfig.
+type sampler struct {
+	active   bool
+	rate     float64
+	rules    []samplingRule
+	adaptive AdaptiveSamplingConfig
+}
+
+func validateSamplingConfig(cfg SamplingConfig) error {
+	if cfg.Rate < 0 || cfg.Rate > 1 {
+		return errors.New("sampling.rate must be between 0 and 1")
+	}
+	if cfg.Adaptive.TargetPerSecond < 0 {
+		return errors.New("sampling.adaptive.targetPerSecond must not be negative")
+	}
+	if cfg.Adaptive.MaxEndpoints < 0 {
+		return errors.New("sampling.adaptive.maxEndpoints must not be negative")
+	}
+	if cfg.Rate > 0 && cfg.Adaptive.TargetPerSecond > 0 {
+		return errors.New("sampling.rate and sampling.adaptive cannot both be set")
+	}
+	for i, rule := range cfg.Rules {
+		if rule.Rate < 0 || rule.Rate > 1 {
+			return fmt.Errorf("sampling.rules[%d].rate must be between 0 and 1", i)
+		}
+		if _, err := path.Match(strings.TrimSuffix(rule.Endpoint, "/**"), ""); err != nil {
+			return fmt.Errorf("sampling.rules[%d].endpoint %q is not a valid pattern", i, rule.Endpoint)
+		}
+		if _, _, err := parseStatusMatch(rule.Status); err != nil {
+			return fmt.Errorf("sampling.rules[%d].status %w", i, err)
+		}
+	}
+	return nil
+}
+
+func parseStatusMatch(value string) (int, int, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if value == "" {
+		return 0, 0, nil
+	}
+	if len(value) == 3 && strings.HasSuffix(value, "xx") && value[0] >= '1' && value[0] <= '5' {
+		class := int(value[0]-'0') * 100
+		return class, class + 99, nil
+	}
+	code, err := strconv.Atoi(value)
+	if err != nil || code < 100 || code > 599 {
+		return 0, 0, fmt.Errorf("must be a status code or a class like 5xx, got %q", value)
+	}
+	return code, code, nil
+}
+
+// newSampler compiles cfg, which must already be valid.
+func newSampler(cfg SamplingConfig) sampler {
+	s := sampler{rate: cfg.Rate, adaptive: cfg.Adaptive}
+	if s.rate <= 0 || s.rate > 1 {
+		s.rate = 1
+	}
+	for _, rule := range cfg.Rules {
+		lo, hi, _ := parseStatusMatch(rule.Status)
+		s.rules = append(s.rules, samplingRule{
+			method:   strings.ToUpper(strings.TrimSpace(rule.Method)),
+			endpoint: strings.TrimSpace(rule.Endpoint),
+			statusLo: lo,
+			statusHi: hi,
+			actor:    rule.Actor,
+			rate:     rule.Rate,
+		})
+	}
+	s.active = s.rate < 1 || len(s.rules) > 0 || s.adaptive.TargetPerSecond > 0
+	return s
+}
+
+// maxRate is the highest keep rate a request can end up with once its status
+// and actor are known. A request whose roll is at or above it is dropped
+// before anything is buffered.
+func (s sampler) maxRate(method, endpoint string) float64 {
+	if !s.active {
+		return 1
+	}
+	best := 0.0
+	for _, rule := range s.rules {
+		if !rule.matchesRequest(method, endpoint) {
+			continue
+		}
+		best = max(best, rule.rate)
+		if rule.statusLo == 0 && rule.actor == nil {
+			return best
+		}
+	}
+	if s.adaptive.TargetPerSecond > 0 {
+		// errors are always kept, and the status is not known yet
+		return 1
+	}
+	return max(best, s.rate)
+}
+
+// keepRate returns the keep rate of the first rule matching the request.
+// It reports false when no rule matches and the default rate applies.
+func (s sampler) keepRate(method, endpoint string, status int, hasActor bool) (float64, bool) {
+	for _, rule := range s.rules {
+		if !rule.matchesRequest(method, endpoint) {
+			continue
+		}
+		if rule.statusLo != 0 && (status < rule.statusLo || status > rule.statusHi) {
+			continue
+		}
+		if rule.actor != nil && *rule.actor != hasActor {
+			continue
+		}
+		return rule.rate, true
+	}
+	return s.rate, false
+}
+
+// sample reports whether a request with the given roll is kept, and the
+// rate to record on its event; the rate is 0 when sampling is off.
+func (m *Monitor) sample(s sampler, roll float64, method, endpoint string, status int, hasActor bool) (float64, bool) {
+	if !s.active {
+		return 0, true
+	}
+	rate, matched := s.keepRate(method, endpoint, status, hasActor)
+	if !matched && s.adaptive.TargetPerSecond > 0 && m.adaptive != nil {
+		path, _, _ := strings.Cut(endpoint, "?")
+		rate = m.adaptive.rate(s.adaptive, strings.ToUpper(method)+" "+routeTemplate(path), time.Now())
+		if status >= 500 {
+			rate = 1
+		}
+	}
+	return rate, roll < rate
+}
+
+func (r samplingRule) matchesRequest(method, endpoint string) bool {
+	if r.method != "" && r.method != strings.ToUpper(method) {
+		return false
+	}
+	return r.endpoint == "" || matchEndpoint(r.endpoint, endpoint)
+}
+
+func matchEndpoint(pattern, endpoint string) bool {
+	endpoint, _, _ = strings.Cut(endpoint, "?")
+	return globMatch(pattern, endpoint)
+}
+
+// globMatch matches value against a path.Match pattern whose trailing "/**"
+// also matches any number of further segments.
+func globMatch(pattern, value string) bool {
+	if prefix, ok := strings.CutSuffix(pattern, "/**"); ok {
+		if prefix == "" {
+			return true
+		}
+		for p := value; ; {
+			if ok, _ := path.Match(prefix, p); ok {
+				return true
+			}
+			i := strings.LastIndexByte(p, '/')
+			if i <= 0 {
+				return false
+			}
+			p = p[:i]
+		}
+	}
+	ok, _ := path.Match(pattern, value)
+	return ok
+}
+
+// roll draws the number a request's keep rate is compared against. It is
+// drawn once per request so the early and final decisions agree.
+func (m *Monitor) roll(s sampler) float64 {
+	if !s.active {
+		return 0
+	}
+	m.rndMu.Lock()
+	defer m.rndMu.Unlock()
+	return m.rnd.Float64()
+}
+
+// routeTemplate replaces path segments that look like identifiers with
+// "{id}", so "/users/123" and "/users/456" share one adaptive budget.
+func routeTemplate(p string) string {
+	segments := strings.Split(p, "/")
+	changed := false
+	for i, seg := range segments {
+		if isIDSegment(seg) {
+			segments[i] = "{id}"
+			changed = true
+		}
+	}
+	if !changed {
+		return p
+	}
+	return strings.Join(segments, "/")
+}
+
+// isIDSegment reports whether seg is a number, a UUID, or a long token
+// containing digits such as a hex object ID.
+func isIDSegment(seg string) bool {
+	if seg == "" {
+		return false
+	}
+	digits, alnum := 0, 0
+	for _, c := range seg {
+		switch {
+		case c >= '0' && c <= '9':
+			digits++
+			alnum++
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+			alnum++
+		case c == '-' || c == '_':
+		default:
+			return false
+		}
+	}
+	if digits == len(seg) {
+		return true
+	}
+	return digits > 0 && alnum >= 16
+}
+
+const (
+	adaptiveWindow       = time.Second
+	adaptiveIdle         = time.Minute
+	defaultMaxEndpoints  = 500
+	adaptiveMinPressure  = 0.05
+	adaptiveOverflowName = "other"
+)
+
+// adaptiveSampler tracks request rates per endpoint for
+// AdaptiveSamplingConfig. It lives on the Monitor so rates survive updates.
+type adaptiveSampler struct {
+	mu        sync.Mutex
+	endpoints map[string]*endpointRate
+	// pressure reports how full the fullest event queue is, from 0 to 1.
+	pressure func() float64
+}
+
+type endpointRate struct {
+	windowStart time.Time
+	lastSeen    time.Time
+	count       float64
+	perSecond   float64
+}
+
+func newAdaptiveSampler(pressure func() float64) *adaptiveSampler {
+	return &adaptiveSampler{endpoints: make(map[string]*endpointRate), pressure: pressure}
+}
+
+// rate counts one request to key and returns the keep rate that holds the
+// endpoint near cfg.TargetPerSecond. Endpoints at or below the target are
+// always kept; busier ones are scaled down further while the queue is more
+// than half full.
+func (a *adaptiveSampler) rate(cfg AdaptiveSamplingConfig, key string, now time.Time) float64 {
+	a.mu.Lock()
+	e := a.endpoint(cfg, key, now)
+	if elapsed := now.Sub(e.windowStart); elapsed >= adaptiveWindow {
+		observed := e.count / elapsed.Seconds()
+		if e.perSecond == 0 {
+			e.perSecond = observed
+		} else {
+			e.perSecond = (e.perSecond + observed) / 2
+		}
+		e.windowStart, e.count = now, 0
+	}
+	e.count++
+	e.lastSeen = now
+	// the current window's count is a lower bound on the rate, so bursts
+	// are throttled before the window closes
+	perSecond := max(e.perSecond, e.count/adaptiveWindow.Seconds())
+	a.mu.Unlock()
+
+	if perSecond <= cfg.TargetPerSecond {
+		return 1
+	}
+	rate := cfg.TargetPerSecond / perSecond
+	if fill := a.pressure(); fill > 0.5 {
+		rate *= max(2*(1-fill), adaptiveMinPressure)
+	}
+	return rate
+}
+
+func (a *adaptiveSampler) endpoint(cfg AdaptiveSamplingConfig, key string, now time.Time) *endpointRate {
+	if e, ok := a.endpoints[key]; ok {
+		return e
+	}
+	limit := cfg.MaxEndpoints
+	if limit <= 0 {
+		limit = defaultMaxEndpoints
+	}
+	if len(a.endpoints) >= limit {
+		key = adaptiveOverflowName
+		if e, ok := a.endpoints[key]; ok {
+			return e
+		}
+	}
+	e := &endpointRate{windowStart: now, lastSeen: now}
+	a.endpoints[key] = e
+	return e
+}
+
+// evictLoop forgets endpoints idle for adaptiveIdle, freeing their slots
+// for new ones, until stop is closed.
+func (a *adaptiveSampler) evictLoop(stop <-chan struct{}) {
+	ticker := time.NewTicker(adaptiveIdle)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			a.evict(now)
+		}
+	}
+}
+
+func (a *adaptiveSampler) evict(now time.Time) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for k, e := range a.endpoints {
+		if now.Sub(e.lastSeen) > adaptiveIdle {
+			delete(a.endpoints, k)
+		}
+	}
+}
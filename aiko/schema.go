@@ -2,8 +2,12 @@ package aiko
 
 import (
 	"errors"
+	"fmt"
 	"log"
+	"log/slog"
+	"net"
 	"net/http"
+	"net/url"
 	"regexp"
 	"strings"
 	"time"
@@ -12,7 +16,9 @@ import (
 )
 
 const (
-	defaultEndpoint           = "https://monitor.aikocorp.ai/api/ingest"
+	// DefaultEndpoint is the AIKO cloud ingest, used when Config.Endpoint
+	// and Config.Endpoints are empty.
+	DefaultEndpoint           = "https://monitor.aikocorp.ai/api/ingest"
 	stagingEndpoint           = "https://staging.aikocorp.ai/api/monitor/ingest"
 	defaultMaxConcurrentSends = 5
 	defaultQueueSize          = 5000
@@ -35,7 +41,86 @@ type Config struct {
 	MaxConcurrentSends int
 	QueueSize          int
 	HTTPClient         *http.Client
+	Transport          TransportConfig
 	Logger             *log.Logger
+
+	// SlogHandler receives SDK logs as structured records and takes
+	// precedence over Logger. Debug and info records are only emitted when
+	// Verbose is set; warnings and errors always are.
+	SlogHandler slog.Handler
+
+	// AllowCustomEndpoint permits an Endpoint outside the AIKO-hosted ones,
+	// such as a regional relay or sidecar. It must use https unless the host
+	// is loopback or the endpoint is a unix:// socket path.
+	AllowCustomEndpoint bool
+
+	// Endpoints is an ordered list of ingest URLs used instead of Endpoint.
+	// Events go to the first healthy one; after FailoverThreshold consecutive
+	// failures (transport errors and 5xx responses, not 408 or 429) an
+	// endpoint is skipped and re-probed every FailbackInterval.
+	Endpoints         []string
+	FailoverThreshold int
+	FailbackInterval  time.Duration
+
+	// SecretProvider replaces SecretKey when keys are rotated without restarts.
+	SecretProvider SecretProvider
+
+	// OnUndelivered receives events that were still queued or in flight when
+	// Shutdown gave up waiting, so they can be spooled instead of lost.
+	OnUndelivered func([]Event)
+
+	// OnExportFailed receives batches an exporter gave up on after retries or
+	// a non-retryable error.
+	OnExportFailed func(exporter string, events []Event, err error)
+
+	// Exporters receive every captured event alongside the AIKO ingest
+	// exporter. When Exporters is set and both keys are empty, ingest is skipped.
+	Exporters []Exporter
+
+	// Processors run in order on every captured event before redaction and
+	// export. Each may change, replace or drop the event.
+	Processors []EventProcessor
+
+	Sampling  SamplingConfig
+	Redaction RedactionConfig
+	Capture   CaptureConfig
+}
+
+// SamplingConfig keeps a fraction of captured requests. Kept events record
+// their keep rate in Event.SampleRate.
+type SamplingConfig struct {
+	// Rate is the fraction of requests kept, between 0 and 1. Zero keeps
+	// every request; use Enabled to capture nothing.
+	Rate float64
+	// Rules are checked in order and the first match sets the keep rate;
+	// requests no rule matches use Rate. Requests that cannot be kept under
+	// any rule are dropped before their bodies are buffered.
+	Rules []SamplingRule
+	// Adaptive replaces Rate for requests no rule matches.
+	Adaptive AdaptiveSamplingConfig
+}
+
+// AdaptiveSamplingConfig adjusts keep rates from observed traffic so each
+// endpoint sends about TargetPerSecond events per second. An endpoint is the
+// method and the path with ID-like segments, such as numbers and UUIDs,
+// replaced by "{id}".
+// Endpoints below the target and responses with a 5xx status are always
+// kept. Rates drop further while the event queue is more than half full.
+type AdaptiveSamplingConfig struct {
+	// TargetPerSecond is the per-endpoint budget. Zero turns adaptive
+	// sampling off.
+	TargetPerSecond float64
+	// MaxEndpoints bounds how many endpoints get their own budget; the
+	// rest share one. Endpoints idle for a minute give up their slot.
+	// Defaults to 500.
+	MaxEndpoints int
+}
+
+// RedactionConfig masks header names and body keys in addition to the
+// built-in sensitive keys. Matching is case-insensitive.
+type RedactionConfig struct {
+	Headers  []string
+	BodyKeys []string
 }
 
 type ActorProvider string
@@ -128,36 +213,158 @@ type Event struct {
 	ResponseBody    any               `json:"response_body"`
 	Timestamp       string            `json:"timestamp,omitempty"`
 	DurationMS      int64             `json:"duration_ms"`
+	// SampleRate is the keep rate the event was sampled at, so counts can be
+	// extrapolated. It is omitted when sampling is off.
+	SampleRate float64 `json:"sample_rate,omitempty"`
+	// Tags and Attributes are set by handlers through SetTag and
+	// SetAttribute. Attribute values are strings, bools, int64s or float64s.
+	Tags       map[string]string `json:"tags,omitempty"`
+	Attributes map[string]any    `json:"attributes,omitempty"`
+
+	clientIP string
+}
+
+func (e Event) ClientIP() string {
+	return e.clientIP
+}
+
+// WithClientIP returns a copy of e carrying ip as its client IP, for events
+// decoded from another process such as a forwarding agent.
+func (e Event) WithClientIP(ip string) Event {
+	if validIP(ip) {
+		e.clientIP = normalizeIP(ip)
+	}
+	return e
 }
 
 func ValidateConfig(projectKey, secretKey, endpoint string) error {
+	if err := validateProjectKey(projectKey); err != nil {
+		return err
+	}
+	if err := validateSecretKey(secretKey); err != nil {
+		return err
+	}
+	return validateEndpoint(endpoint)
+}
+
+func validateCaptureConfig(cfg Config) error {
+	if err := validateSamplingConfig(cfg.Sampling); err != nil {
+		return err
+	}
+	if err := validateCapture(cfg.Capture); err != nil {
+		return err
+	}
+	for i, name := range cfg.Redaction.Headers {
+		if strings.TrimSpace(name) == "" {
+			return fmt.Errorf("redaction.headers[%d] must not be empty", i)
+		}
+	}
+	for i, key := range cfg.Redaction.BodyKeys {
+		if strings.TrimSpace(key) == "" {
+			return fmt.Errorf("redaction.bodyKeys[%d] must not be empty", i)
+		}
+	}
+	return nil
+}
+
+func validateIngestConfig(cfg Config, endpoints []string) error {
+	if err := validateProjectKey(cfg.ProjectKey); err != nil {
+		return err
+	}
+	if cfg.SecretProvider != nil {
+		if cfg.SecretKey != "" {
+			return errors.New("secretKey and secretProvider cannot both be set")
+		}
+	} else if err := validateSecretKey(cfg.SecretKey); err != nil {
+		return err
+	}
+	for i, endpoint := range endpoints {
+		err := validateIngestEndpoint(endpoint, cfg.AllowCustomEndpoint)
+		if err != nil && len(endpoints) > 1 {
+			return fmt.Errorf("endpoints[%d]: %w", i, err)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateIngestEndpoint(endpoint string, allowCustom bool) error {
+	if allowCustom {
+		return validateCustomEndpoint(endpoint)
+	}
+	if err := validateEndpoint(endpoint); err != nil {
+		return fmt.Errorf("%w; set AllowCustomEndpoint to use a self-hosted endpoint", err)
+	}
+	return nil
+}
+
+func validateProjectKey(projectKey string) error {
 	if !projectKeyPattern.MatchString(projectKey) {
 		return errors.New("projectKey must start with 'pk_' followed by 22 base64url characters")
 	}
+	return nil
+}
+
+func validateSecretKey(secretKey string) error {
 	if len(secretKey) != 43 {
 		return errors.New("secretKey must be exactly 43 base64url characters")
 	}
-	if endpoint != defaultEndpoint && endpoint != stagingEndpoint && !localEndpointPattern.MatchString(endpoint) {
+	return nil
+}
+
+func validateEndpoint(endpoint string) error {
+	if endpoint != DefaultEndpoint && endpoint != stagingEndpoint && !localEndpointPattern.MatchString(endpoint) {
 		return errors.New("endpoint must match http://localhost:PORT/api/ingest or be 'https://monitor.aikocorp.ai/api/ingest' or 'https://staging.aikocorp.ai/api/monitor/ingest'")
 	}
 	return nil
 }
 
-func RedactEvent(evt Event) Event {
-	return Event{
-		ID:              evt.ID,
-		URL:             evt.URL,
-		Endpoint:        evt.Endpoint,
-		Method:          evt.Method,
-		StatusCode:      evt.StatusCode,
-		Actor:           cloneActorContext(evt.Actor),
-		RequestHeaders:  redactHeaders(evt.RequestHeaders),
-		RequestBody:     RedactValue(evt.RequestBody),
-		ResponseHeaders: redactHeaders(evt.ResponseHeaders),
-		ResponseBody:    RedactValue(evt.ResponseBody),
-		Timestamp:       evt.Timestamp,
-		DurationMS:      evt.DurationMS,
+func isAIKOEndpoint(endpoint string) bool {
+	return endpoint == DefaultEndpoint || endpoint == stagingEndpoint || localEndpointPattern.MatchString(endpoint)
+}
+
+func validateCustomEndpoint(endpoint string) error {
+	if isAIKOEndpoint(endpoint) {
+		return nil
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return fmt.Errorf("endpoint is not a valid URL: %w", err)
+	}
+	if u.User != nil {
+		return errors.New("endpoint must not embed credentials")
 	}
+	switch u.Scheme {
+	case "https":
+		if u.Hostname() == "" {
+			return errors.New("endpoint must include a host")
+		}
+	case "http":
+		if !isLoopbackHost(u.Hostname()) {
+			return fmt.Errorf("endpoint %q must use https unless the host is loopback", endpoint)
+		}
+	case "unix":
+		if u.Host != "" || !strings.HasPrefix(u.Path, "/") {
+			return errors.New("unix endpoint must be an absolute socket path such as unix:///var/run/aiko.sock")
+		}
+	default:
+		return fmt.Errorf("endpoint scheme %q is not supported; use https, http on a loopback host, or unix", u.Scheme)
+	}
+	return nil
+}
+
+func isLoopbackHost(host string) bool {
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func RedactEvent(evt Event) Event {
+	return redactor{}.event(evt)
 }
 
 func cloneActorContext(actor *ActorContext) *ActorContext {
@@ -168,6 +375,11 @@ func cloneActorContext(actor *ActorContext) *ActorContext {
 	return &out
 }
 
+// ValidateActorConfig reports the actor configuration errors New would.
+func ValidateActorConfig(cfg ActorConfig) error {
+	return validateActorConfig(cfg)
+}
+
 func validateActorConfig(cfg ActorConfig) error {
 	hasProvider := strings.TrimSpace(string(cfg.Provider)) != ""
 	hasFields := actorTokenConfigured(cfg.Token) || actorClaimsConfigured(cfg.Claims) || cfg.Resolve != nil
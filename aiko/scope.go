@@ -0,0 +1,121 @@
+package aiko
+
+import (
+	"context"
+	"maps"
+	"math"
+	"strconv"
+	"sync"
+)
+
+// maxScopeEntries bounds the tags and the attributes a single request can
+// add; further keys are ignored.
+const maxScopeEntries = 64
+
+// AttributeValue lists the types SetAttribute accepts.
+type AttributeValue interface {
+	string | bool | int | int64 | float64
+}
+
+// captureScope collects what a handler adds to the event the middleware is
+// building. The middlewares store it in r.Context() and in fasthttp user
+// values.
+type captureScope struct {
+	mu         sync.Mutex
+	tags       map[string]string
+	attributes map[string]any
+	skip       bool
+	// closed is set once the event is built; later calls, e.g. from
+	// goroutines the handler left running, do nothing.
+	closed bool
+}
+
+type captureScopeKey struct{}
+
+func scopeFrom(ctx context.Context) *captureScope {
+	if ctx == nil {
+		return nil
+	}
+	scope, _ := ctx.Value(captureScopeKey{}).(*captureScope)
+	return scope
+}
+
+// SetTag adds a string tag to the event captured for the request ctx belongs
+// to. ctx is r.Context() under NetHTTPMiddleware, or the *fasthttp.RequestCtx
+// under FastHTTPMiddleware. It does nothing for requests that are not being
+// captured, or once the handler has returned.
+func SetTag(ctx context.Context, key, value string) {
+	scope := scopeFrom(ctx)
+	if scope == nil || key == "" {
+		return
+	}
+	scope.mu.Lock()
+	defer scope.mu.Unlock()
+	if scope.closed {
+		return
+	}
+	if _, ok := scope.tags[key]; !ok && len(scope.tags) >= maxScopeEntries {
+		return
+	}
+	if scope.tags == nil {
+		scope.tags = make(map[string]string)
+	}
+	scope.tags[key] = value
+}
+
+// SetAttribute adds a typed attribute to the event captured for the request
+// ctx belongs to, like SetTag. Integers are recorded as int64. NaN and
+// infinite floats cannot be encoded as JSON and are recorded as strings such
+// as "NaN" and "+Inf".
+func SetAttribute[T AttributeValue](ctx context.Context, key string, value T) {
+	scope := scopeFrom(ctx)
+	if scope == nil || key == "" {
+		return
+	}
+	var v any = value
+	switch x := v.(type) {
+	case int:
+		v = int64(x)
+	case float64:
+		if math.IsNaN(x) || math.IsInf(x, 0) {
+			v = strconv.FormatFloat(x, 'g', -1, 64)
+		}
+	}
+	scope.mu.Lock()
+	defer scope.mu.Unlock()
+	if scope.closed {
+		return
+	}
+	if _, ok := scope.attributes[key]; !ok && len(scope.attributes) >= maxScopeEntries {
+		return
+	}
+	if scope.attributes == nil {
+		scope.attributes = make(map[string]any)
+	}
+	scope.attributes[key] = v
+}
+
+// SkipCapture drops the event for the request ctx belongs to. The response
+// is not affected.
+func SkipCapture(ctx context.Context) {
+	scope := scopeFrom(ctx)
+	if scope == nil {
+		return
+	}
+	scope.mu.Lock()
+	if !scope.closed {
+		scope.skip = true
+	}
+	scope.mu.Unlock()
+}
+
+// finish copies the tags and attributes onto evt, closes the scope and
+// reports whether the handler asked for the event to be skipped.
+func (s *captureScope) finish(evt *Event) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	evt.Tags = maps.Clone(s.tags)
+	evt.Attributes = maps.Clone(s.attributes)
+	return s.skip
+}
@@ -0,0 +1,205 @@
+package aiko
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultSecretPollInterval = 10 * time.Second
+
+// SecretProvider supplies the key used to sign each ingest request. It is
+// queried per attempt, so rotating the underlying key needs no restart.
+type SecretProvider interface {
+	SigningKey(ctx context.Context) (SigningKey, error)
+}
+
+type SigningKey struct {
+	ID     string
+	Secret []byte
+}
+
+// SigningSecret is a configured secret key. During a rotation window two
+// secrets can be active: the one with the latest NotBefore that has already
+// passed is used for signing, while receivers accept both key IDs.
+type SigningSecret struct {
+	ID        string    `json:"id,omitempty"`
+	Secret    string    `json:"secret"`
+	NotBefore time.Time `json:"not_before,omitempty"`
+}
+
+type staticSecretProvider struct {
+	keys []signingCandidate
+}
+
+type signingCandidate struct {
+	key       SigningKey
+	notBefore time.Time
+}
+
+func NewStaticSecretProvider(secrets ...SigningSecret) (SecretProvider, error) {
+	keys, err := signingCandidates(secrets)
+	if err != nil {
+		return nil, err
+	}
+	return &staticSecretProvider{keys: keys}, nil
+}
+
+func (p *staticSecretProvider) SigningKey(context.Context) (SigningKey, error) {
+	return activeSigningKey(p.keys, time.Now())
+}
+
+func signingCandidates(secrets []SigningSecret) ([]signingCandidate, error) {
+	if len(secrets) == 0 {
+		return nil, errors.New("at least one secret key is required")
+	}
+	out := make([]signingCandidate, 0, len(secrets))
+	for i, s := range secrets {
+		key, err := decodeSigningSecret(s)
+		if err != nil {
+			return nil, fmt.Errorf("secrets[%d]: %w", i, err)
+		}
+		out = append(out, signingCandidate{key: key, notBefore: s.NotBefore})
+	}
+	return out, nil
+}
+
+func decodeSigningSecret(s SigningSecret) (SigningKey, error) {
+	value := strings.TrimSpace(s.Secret)
+	if len(value) != 43 {
+		return SigningKey{}, errors.New("secretKey must be exactly 43 base64url characters")
+	}
+	secret, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return SigningKey{}, fmt.Errorf("decode secret key: %w", err)
+	}
+	id := strings.TrimSpace(s.ID)
+	if id == "" {
+		id = SecretKeyID(secret)
+	}
+	return SigningKey{ID: id, Secret: secret}, nil
+}
+
+func activeSigningKey(keys []signingCandidate, now time.Time) (SigningKey, error) {
+	var (
+		best  SigningKey
+		since time.Time
+		found bool
+	)
+	for _, candidate := range keys {
+		if candidate.notBefore.After(now) {
+			continue
+		}
+		if !found || candidate.notBefore.After(since) {
+			best, since, found = candidate.key, candidate.notBefore, true
+		}
+	}
+	if !found {
+		return SigningKey{}, errors.New("no secret key is active yet")
+	}
+	return best, nil
+}
+
+// FileSecretProvider reads secrets from a file and reloads it when its size
+// or modification time changes. The file holds either a bare 43-character
+// secret key or a JSON document of the form {"keys":[{"id":..., "secret":...,
+// "not_before":...}]}. A file that fails to parse keeps the last good keys.
+type FileSecretProvider struct {
+	path     string
+	interval time.Duration
+
+	mu        sync.Mutex
+	keys      []signingCandidate
+	modTime   time.Time
+	size      int64
+	checkedAt time.Time
+	lastErr   error
+}
+
+func NewFileSecretProvider(path string, pollInterval time.Duration) (*FileSecretProvider, error) {
+	if strings.TrimSpace(path) == "" {
+		return nil, errors.New("secret file path is required")
+	}
+	if pollInterval <= 0 {
+		pollInterval = defaultSecretPollInterval
+	}
+	p := &FileSecretProvider{path: path, interval: pollInterval}
+	if err := p.reload(time.Now()); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *FileSecretProvider) SigningKey(context.Context) (SigningKey, error) {
+	now := time.Now()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if now.Sub(p.checkedAt) >= p.interval {
+		p.lastErr = p.reloadLocked(now)
+	}
+	return activeSigningKey(p.keys, now)
+}
+
+// Err reports the last reload failure, if any.
+func (p *FileSecretProvider) Err() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.lastErr
+}
+
+func (p *FileSecretProvider) reload(now time.Time) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.reloadLocked(now)
+}
+
+func (p *FileSecretProvider) reloadLocked(now time.Time) error {
+	p.checkedAt = now
+	info, err := os.Stat(p.path)
+	if err != nil {
+		return fmt.Errorf("stat secret file: %w", err)
+	}
+	if p.keys != nil && info.ModTime().Equal(p.modTime) && info.Size() == p.size {
+		return nil
+	}
+	raw, err := os.ReadFile(p.path)
+	if err != nil {
+		return fmt.Errorf("read secret file: %w", err)
+	}
+	keys, err := parseSecretFile(raw)
+	if err != nil {
+		return fmt.Errorf("parse secret file: %w", err)
+	}
+	p.keys = keys
+	p.modTime = info.ModTime()
+	p.size = info.Size()
+	return nil
+}
+
+func parseSecretFile(raw []byte) ([]signingCandidate, error) {
+	trimmed := bytes.TrimSpace(raw)
+	if len(trimmed) > 0 && trimmed[0] == '{' {
+		var doc struct {
+			Keys []SigningSecret `json:"keys"`
+		}
+		decoder := json.NewDecoder(bytes.NewReader(trimmed))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&doc); err != nil {
+			return nil, err
+		}
+		return signingCandidates(doc.Keys)
+	}
+	return signingCandidates([]SigningSecret{{Secret: string(trimmed)}})
+}
+
+var (
+	_ SecretProvider = (*staticSecretProvider)(nil)
+	_ SecretProvider = (*FileSecretProvider)(nil)
+)
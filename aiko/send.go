@@ -3,7 +3,6 @@ package aiko
 import (
 	"bytes"
 	"context"
-	"encoding/base64"
 	"errors"
 	"fmt"
 	"io"
@@ -14,24 +13,73 @@ import (
 	"os"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 )
 
 type Monitor struct {
-	cfg          Config
-	secret       []byte
-	client       *http.Client
-	logger       *log.Logger
-	events       chan Event
-	sem          chan struct{}
-	wg           sync.WaitGroup
-	once         sync.Once
-	closeCh      chan struct{}
-	enabled      bool
-	rnd          *rand.Rand
-	rndMu        sync.Mutex
-	verifiedOnce sync.Once
+	cfg        Config
+	log        *sdkLogger
+	events     chan Event
+	pipelines  []*exportPipeline
+	processors []*processorState
+	adaptive   *adaptiveSampler
+	wg         sync.WaitGroup
+	once       sync.Once
+	closeCh    chan struct{}
+	enabled    bool
+	rnd        *rand.Rand
+	rndMu      sync.Mutex
+	settings   atomic.Pointer[liveSettings]
+	liveMu     sync.Mutex
+	// sendMu lets Shutdown close events once no enqueue is in progress.
+	sendMu sync.RWMutex
+
+	ctx           context.Context
+	cancel        context.CancelFunc
+	undeliveredMu sync.Mutex
+	undelivered   []Event
+	// inFlight holds the batches exporters are working on, keyed by a
+	// sequence number, so Shutdown can name them if an exporter hangs.
+	inFlight    map[uint64][]Event
+	inFlightSeq uint64
+}
+
+type ShutdownError struct {
+	EventIDs []string
+	// UnknownEventIDs are events an exporter was still working on when
+	// Shutdown returned. They may or may not have been delivered, so they
+	// are not passed to OnUndelivered.
+	UnknownEventIDs []string
+	Err             error
+}
+
+func (e *ShutdownError) Error() string {
+	if len(e.UnknownEventIDs) > 0 {
+		return fmt.Sprintf("aiko shutdown: %d undelivered events, %d in flight: %v", len(e.EventIDs), len(e.UnknownEventIDs), e.Err)
+	}
+	return fmt.Sprintf("aiko shutdown: %d undelivered events: %v", len(e.EventIDs), e.Err)
+}
+
+func (e *ShutdownError) Unwrap() error {
+	return e.Err
+}
+
+type StatusError struct {
+	StatusCode int
+	RequestID  string
+}
+
+func (e *StatusError) Error() string {
+	if e.RequestID != "" {
+		return fmt.Sprintf("export rejected: status=%d request_id=%s", e.StatusCode, e.RequestID)
+	}
+	return fmt.Sprintf("export rejected: status=%d", e.StatusCode)
+}
+
+func (e *StatusError) Retryable() bool {
+	return isRetryableStatus(e.StatusCode)
 }
 
 const (
@@ -39,30 +87,83 @@ const (
 	baseBackoff    = 250 * time.Millisecond
 	maxBackoff     = 2 * time.Second
 	requestTimeout = 10 * time.Second
+	// shutdownGrace bounds how long Shutdown waits past its deadline for
+	// workers and exporters to notice the cancellation.
+	shutdownGrace = 100 * time.Millisecond
+)
+
+var (
+	ErrQueueFull       = errors.New("event queue is full")
+	ErrMonitorClosed   = errors.New("monitor is shut down")
+	ErrMonitorDisabled = errors.New("monitor is disabled")
 )
 
 // kept for backward comptibility
 func (m *Monitor) AddEvent(evt Event) {
-	if m == nil || !m.enabled {
+	if m == nil || !m.enabled || !m.live().Enabled {
 		return
 	}
 
 	m.addEvent(evt)
 }
 
+// TryAddEvent queues evt like AddEvent, but reports ErrQueueFull,
+// ErrMonitorClosed or ErrMonitorDisabled when the event was not accepted.
+func (m *Monitor) TryAddEvent(evt Event) error {
+	if m == nil || !m.enabled || !m.live().Enabled {
+		return ErrMonitorDisabled
+	}
+	return m.enqueue(context.Background(), normalizeEvent(evt), false)
+}
+
+// AddEventContext queues evt, waiting for room in the queue until ctx is
+// done. It returns ctx.Err() if the event was not accepted in time.
+func (m *Monitor) AddEventContext(ctx context.Context, evt Event) error {
+	if m == nil || !m.enabled || !m.live().Enabled {
+		return ErrMonitorDisabled
+	}
+	return m.enqueue(ctx, normalizeEvent(evt), true)
+}
+
 func (m *Monitor) addEvent(evt Event) {
 	if m == nil || !m.enabled {
 		return
 	}
 
 	evt = normalizeEvent(evt)
+	if err := m.enqueue(context.Background(), evt, false); errors.Is(err, ErrQueueFull) {
+		m.log.warn("event dropped", "event_id", evt.ID, "reason", "queue_full")
+	}
+}
+
+// enqueue returns ErrQueueFull when the queue has no room, unless wait is
+// set, in which case it waits for room until ctx is done.
+func (m *Monitor) enqueue(ctx context.Context, evt Event, wait bool) error {
+	m.sendMu.RLock()
+	defer m.sendMu.RUnlock()
 	select {
-	case m.events <- evt:
-		m.verbosef("queued event_id=%s queue_depth=%d queue_size=%d", evt.ID, len(m.events), cap(m.events))
 	case <-m.closeCh:
+		return ErrMonitorClosed
 	default:
-		m.logger.Printf("aiko monitor queue is full; dropping event")
-	} // shouldn't drop
+	}
+
+	if !wait {
+		select {
+		case m.events <- evt:
+		default:
+			return ErrQueueFull
+		}
+	} else {
+		select {
+		case m.events <- evt:
+		case <-m.closeCh:
+			return ErrMonitorClosed
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	m.log.debug("queued", "event_id", evt.ID, "queue_depth", len(m.events), "queue_size", cap(m.events))
+	return nil
 }
 
 func normalizeEvent(evt Event) Event {
@@ -78,6 +179,21 @@ func normalizeEvent(evt Event) Event {
 	return evt
 }
 
+func prepareEvent(evt Event, r redactor) Event {
+	evt = normalizeEvent(evt)
+	peerIP := evt.RequestHeaders["x-aiko-peer-ip"]
+	if peerIP != "" {
+		delete(evt.RequestHeaders, "x-aiko-peer-ip")
+	}
+	clientIP := extractClientIP(evt.RequestHeaders, peerIP)
+	if clientIP == "" {
+		clientIP = evt.clientIP
+	}
+	sanitized := r.event(evt)
+	sanitized.clientIP = clientIP
+	return sanitized
+}
+
 func (m *Monitor) Shutdown(ctx context.Context) error {
 	if m == nil {
 		return nil
@@ -86,7 +202,9 @@ func (m *Monitor) Shutdown(ctx context.Context) error {
 	m.once.Do(func() {
 		close(m.closeCh)
 		if m.enabled {
+			m.sendMu.Lock()
 			close(m.events)
+			m.sendMu.Unlock()
 		}
 	})
 
@@ -102,36 +220,180 @@ func (m *Monitor) Shutdown(ctx context.Context) error {
 
 	select {
 	case <-done:
-		return nil
+		// workers are finished; release the monitor context for anything
+		// still waiting on it
+		m.cancel()
+		return m.shutdownExporters(ctx)
 	case <-ctx.Done():
-		return ctx.Err()
 	}
+
+	// stop retries and in-flight attempts, then collect whatever did not
+	// make it. An exporter that ignores ctx must not hold Shutdown past its
+	// deadline, so workers get a short grace period and the batches still
+	// running after it are reported as unknown.
+	m.cancel()
+	grace := time.NewTimer(shutdownGrace)
+	defer grace.Stop()
+	select {
+	case <-done:
+	case <-grace.C:
+	}
+
+	leftovers := m.takeUndelivered()
+	ids := make([]string, len(leftovers))
+	for i, evt := range leftovers {
+		ids[i] = evt.ID
+	}
+	unknown := m.inFlightIDs(ids)
+	m.log.error("shutdown deadline exceeded", "undelivered", len(leftovers), "in_flight", len(unknown))
+	if len(leftovers) > 0 && m.cfg.OnUndelivered != nil {
+		m.cfg.OnUndelivered(leftovers)
+	}
+	exported := make(chan error, 1)
+	go func() { exported <- m.shutdownExporters(ctx) }()
+	select {
+	case err := <-exported:
+		if err != nil {
+			m.log.error("shutdown exporters failed", "error", err)
+		}
+	case <-grace.C:
+		m.log.error("shutdown exporters failed", "error", "exporters did not return after the deadline")
+	}
+	return &ShutdownError{EventIDs: ids, UnknownEventIDs: unknown, Err: ctx.Err()}
+}
+
+func (m *Monitor) shutdownExporters(ctx context.Context) error {
+	var errs []error
+	for _, p := range m.pipelines {
+		if err := p.exporter.Flush(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("flush exporter %s: %w", p.name, err))
+		}
+		if err := p.exporter.Shutdown(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("shutdown exporter %s: %w", p.name, err))
+		}
+	}
+	return errors.Join(errs...)
 }
 
 func (m *Monitor) Close() error {
 	return m.Shutdown(context.Background())
 }
 
+// Enabled reports whether the monitor captures events right now. It turns
+// false while capture is paused through Update.
 func (m *Monitor) Enabled() bool {
 	if m == nil {
 		return false
 	}
-	return m.enabled
+	return m.enabled && m.live().Enabled
 }
 
 func (m *Monitor) run() {
 	defer m.wg.Done()
+	defer func() {
+		for _, p := range m.pipelines {
+			close(p.queue)
+		}
+	}()
 	for evt := range m.events {
-		m.sem <- struct{}{}
-		m.wg.Add(1)
-		go func(e Event) {
-			defer m.wg.Done()
-			defer func() { <-m.sem }()
-			m.send(e)
-		}(evt)
+		if m.ctx.Err() != nil {
+			m.recordUndelivered(evt)
+			continue
+		}
+		live := m.live()
+		evt, keep := live.capture.apply(evt)
+		if !keep {
+			m.log.debug("event dropped", "event_id", evt.ID, "reason", "capture_when")
+			continue
+		}
+		if evt, keep = m.process(evt); !keep {
+			continue
+		}
+		evt = prepareEvent(evt, live.redactor)
+		for _, p := range m.pipelines {
+			p.enqueue(evt)
+		}
 	}
 }
 
+func (m *Monitor) recordUndelivered(events ...Event) {
+	m.undeliveredMu.Lock()
+	m.undelivered = append(m.undelivered, events...)
+	m.undeliveredMu.Unlock()
+}
+
+func (m *Monitor) trackInFlight(events []Event) uint64 {
+	m.undeliveredMu.Lock()
+	defer m.undeliveredMu.Unlock()
+	m.inFlightSeq++
+	m.inFlight[m.inFlightSeq] = events
+	return m.inFlightSeq
+}
+
+func (m *Monitor) untrackInFlight(seq uint64) {
+	m.undeliveredMu.Lock()
+	delete(m.inFlight, seq)
+	m.undeliveredMu.Unlock()
+}
+
+// inFlightIDs lists the IDs of batches exporters are still working on,
+// skipping those already reported as undelivered.
+func (m *Monitor) inFlightIDs(undelivered []string) []string {
+	m.undeliveredMu.Lock()
+	defer m.undeliveredMu.Unlock()
+	seen := make(map[string]struct{}, len(undelivered))
+	for _, id := range undelivered {
+		seen[id] = struct{}{}
+	}
+	var out []string
+	for _, events := range m.inFlight {
+		for _, evt := range events {
+			if _, ok := seen[evt.ID]; ok {
+				continue
+			}
+			seen[evt.ID] = struct{}{}
+			out = append(out, evt.ID)
+		}
+	}
+	return out
+}
+
+func (m *Monitor) takeUndelivered() []Event {
+	m.undeliveredMu.Lock()
+	defer m.undeliveredMu.Unlock()
+	seen := make(map[string]struct{}, len(m.undelivered))
+	out := make([]Event, 0, len(m.undelivered))
+	for _, evt := range m.undelivered {
+		if _, ok := seen[evt.ID]; ok {
+			continue
+		}
+		seen[evt.ID] = struct{}{}
+		out = append(out, evt)
+	}
+	m.undelivered = nil
+	return out
+}
+
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// queuePressure reports how full the fullest event queue is, from 0 to 1.
+func (m *Monitor) queuePressure() float64 {
+	fill := float64(len(m.events)) / float64(max(cap(m.events), 1))
+	for _, p := range m.pipelines {
+		fill = max(fill, float64(len(p.queue))/float64(max(cap(p.queue), 1)))
+	}
+	return fill
+}
+
 func (m *Monitor) jitter(base time.Duration) time.Duration {
 	if m.rnd == nil {
 		return base
@@ -142,92 +404,173 @@ func (m *Monitor) jitter(base time.Duration) time.Duration {
 	return time.Duration(float64(base) * factor)
 }
 
-func (m *Monitor) send(evt Event) {
-	evt = normalizeEvent(evt)
-	peerIP := evt.RequestHeaders["x-aiko-peer-ip"]
-	if peerIP != "" {
-		delete(evt.RequestHeaders, "x-aiko-peer-ip")
+type IngestExporter struct {
+	projectKey   string
+	endpoints    *endpointSet
+	secrets      SecretProvider
+	client       *http.Client
+	unixClients  map[string]*http.Client
+	log          *sdkLogger
+	verifiedOnce sync.Once
+}
+
+func NewIngestExporter(cfg Config) (*IngestExporter, error) {
+	return newIngestExporter(cfg, newSDKLogger(cfg))
+}
+
+func newIngestExporter(cfg Config, logger *sdkLogger) (*IngestExporter, error) {
+	endpoints, err := resolveEndpoints(cfg)
+	if err != nil {
+		return nil, err
 	}
-	clientIP := extractClientIP(evt.RequestHeaders, peerIP)
-	sanitized := RedactEvent(evt)
-	payload, err := GzipEvent(sanitized)
+	if err := validateIngestConfig(cfg, endpoints); err != nil {
+		return nil, err
+	}
+	secrets := cfg.SecretProvider
+	if secrets == nil {
+		static, err := NewStaticSecretProvider(SigningSecret{Secret: cfg.SecretKey})
+		if err != nil {
+			return nil, err
+		}
+		secrets = static
+	}
+	client, _, err := ingestHTTPClient(cfg)
 	if err != nil {
-		return
+		return nil, err
 	}
+	return &IngestExporter{
+		projectKey:  cfg.ProjectKey,
+		endpoints:   newEndpointSet(endpoints, cfg.FailoverThreshold, cfg.FailbackInterval),
+		secrets:     secrets,
+		client:      client,
+		unixClients: newUnixClients(endpoints, client.Timeout),
+		log:         logger,
+	}, nil
+}
 
-	signature := Sign(m.secret, payload)
-	backoff := baseBackoff
+func (e *IngestExporter) Name() string {
+	return "ingest"
+}
 
-	for attempt := 0; attempt < maxAttempts; attempt++ {
-		attemptNumber := attempt + 1
-		attemptCtx, cancel := context.WithTimeout(context.Background(), requestTimeout)
-		req, err := http.NewRequestWithContext(attemptCtx, http.MethodPost, m.cfg.Endpoint, bytes.NewReader(payload))
-		if err != nil {
-			cancel()
-			return
+func (e *IngestExporter) Export(ctx context.Context, events []Event) error {
+	var errs []error
+	for _, evt := range events {
+		if err := e.send(ctx, evt); err != nil {
+			errs = append(errs, err)
 		}
+	}
+	return errors.Join(errs...)
+}
 
-		req.Header.Set("Content-Type", "application/json")
-		req.Header.Set("Content-Encoding", "gzip")
-		req.Header.Set("X-Project-Key", m.cfg.ProjectKey)
-		req.Header.Set("X-Signature", signature)
-		if clientIP != "" {
-			req.Header.Set("X-Client-IP", clientIP)
-		}
+func (e *IngestExporter) Flush(context.Context) error {
+	return nil
+}
 
-		start := time.Now()
-		m.verbosef(
-			"send attempt event_id=%s attempt=%d max_attempts=%d method=%s endpoint=%s payload_bytes=%d",
-			evt.ID,
-			attemptNumber,
-			maxAttempts,
-			evt.Method,
-			evt.Endpoint,
-			len(payload),
-		)
-		resp, err := m.client.Do(req)
-		latencyMS := time.Since(start).Milliseconds()
-		nextDelay := m.jitter(backoff)
-
-		if err == nil {
-			if _, copyErr := io.Copy(io.Discard, resp.Body); copyErr != nil && m.logger != nil {
-				m.logger.Printf("aiko: drain response body: %v", copyErr)
-			}
-			if closeErr := resp.Body.Close(); closeErr != nil && m.logger != nil {
-				m.logger.Printf("aiko: close response body: %v", closeErr)
-			}
-			cancel()
-			if resp.StatusCode >= 200 && resp.StatusCode < 300 {
-				requestID := responseRequestID(resp.Header)
-				m.verbosef(
-					"send accepted event_id=%s status=%d request_id=%s latency_ms=%d",
-					evt.ID,
-					resp.StatusCode,
-					requestID,
-					latencyMS,
-				)
-				m.verifiedOnce.Do(func() {
-					m.verbosef("install verified: monitor accepted first event")
-				})
-				return
-			}
-			if !isRetryableStatus(resp.StatusCode) || attempt == maxAttempts-1 {
-				return
-			}
-		} else {
-			cancel()
-			if !IsRetryableError(err) || attempt == maxAttempts-1 {
-				return
-			}
-		}
+func (e *IngestExporter) Shutdown(context.Context) error {
+	e.client.CloseIdleConnections()
+	for _, client := range e.unixClients {
+		client.CloseIdleConnections()
+	}
+	return nil
+}
 
-		time.Sleep(nextDelay)
-		if backoff < maxBackoff {
-			backoff *= 2
-			if backoff > maxBackoff {
-				backoff = maxBackoff
-			}
+func (e *IngestExporter) send(ctx context.Context, evt Event) error {
+	key, err := e.secrets.SigningKey(ctx)
+	if err != nil {
+		return fmt.Errorf("resolve signing key: %w", err)
+	}
+
+	attemptCtx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+	endpointIndex, endpoint := e.endpoints.pick(time.Now())
+	target, client := endpoint, e.client
+	if unixClient, ok := e.unixClients[endpoint]; ok {
+		target, client = unixRequestURL, unixClient
+	}
+	req, err := NewIngestRequest(attemptCtx, target, e.projectKey, key, evt)
+	if err != nil {
+		return err
+	}
+
+	start := time.Now()
+	e.log.debug(
+		"send attempt",
+		"event_id", evt.ID,
+		"attempt", exportAttempt(ctx),
+		"max_attempts", maxAttempts,
+		"method", evt.Method,
+		"endpoint", evt.Endpoint,
+		"payload_bytes", req.ContentLength,
+	)
+	resp, err := client.Do(req)
+	latencyMS := time.Since(start).Milliseconds()
+	if err != nil {
+		if ctx.Err() == nil {
+			e.reportEndpoint(endpointIndex, endpoint, false)
 		}
+		return err
+	}
+
+	if _, copyErr := io.Copy(io.Discard, resp.Body); copyErr != nil {
+		e.log.warn("drain response body failed", "event_id", evt.ID, "error", copyErr)
+	}
+	if closeErr := resp.Body.Close(); closeErr != nil {
+		e.log.warn("close response body failed", "event_id", evt.ID, "error", closeErr)
+	}
+	requestID := responseRequestID(resp.Header)
+	// 408 and 429 mean the endpoint is up but wants the client to back off;
+	// only server errors count toward failover
+	e.reportEndpoint(endpointIndex, endpoint, resp.StatusCode < 500)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return &StatusError{StatusCode: resp.StatusCode, RequestID: requestID}
+	}
+
+	e.log.debug(
+		"send accepted",
+		"event_id", evt.ID,
+		"status", resp.StatusCode,
+		"request_id", requestID,
+		"latency_ms", latencyMS,
+		"ingest_endpoint", endpoint,
+	)
+	e.verifiedOnce.Do(func() {
+		e.log.info("install verified: monitor accepted first event", "event_id", evt.ID)
+	})
+	return nil
+}
+
+// NewIngestRequest builds the signed, gzip-encoded request the ingest
+// exporter sends for evt. The event ID doubles as the Idempotency-Key, which
+// lets net/http resend the request itself when a keep-alive connection the
+// server had closed fails under it.
+func NewIngestRequest(ctx context.Context, endpoint, projectKey string, key SigningKey, evt Event) (*http.Request, error) {
+	payload, err := GzipEvent(evt)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Encoding", "gzip")
+	req.Header.Set(HeaderProjectKey, projectKey)
+	if evt.ID != "" {
+		req.Header.Set(HeaderIdempotencyKey, evt.ID)
+	}
+	SignRequest(key.Secret, key.ID, projectKey, payload, time.Now()).Apply(req.Header)
+	if clientIP := evt.ClientIP(); clientIP != "" {
+		req.Header.Set("X-Client-IP", clientIP)
+	}
+	return req, nil
+}
+
+func (e *IngestExporter) reportEndpoint(i int, endpoint string, healthy bool) {
+	switch e.endpoints.report(i, healthy, time.Now()) {
+	case "unhealthy":
+		e.log.warn("ingest endpoint unhealthy", "endpoint", endpoint)
+	case "recovered":
+		e.log.info("ingest endpoint recovered", "endpoint", endpoint)
 	}
 }
 
@@ -280,13 +623,6 @@ func IsRetryableError(err error) bool {
 	return false
 }
 
-func (m *Monitor) verbosef(format string, args ...any) {
-	if m == nil || !m.cfg.Verbose || m.logger == nil {
-		return
-	}
-	m.logger.Printf("verbose "+format, args...)
-}
-
 func responseRequestID(headers http.Header) string {
 	for _, key := range []string{"X-Request-Id", "X-Request-ID", "X-Aiko-Request-Id"} {
 		if value := strings.TrimSpace(headers.Get(key)); value != "" {
@@ -296,7 +632,9 @@ func responseRequestID(headers http.Header) string {
 	return ""
 }
 
-func maskedProjectKey(projectKey string) string {
+// MaskProjectKey shortens a project key for log output, keeping only enough
+// of it to tell projects apart.
+func MaskProjectKey(projectKey string) string {
 	if len(projectKey) <= 10 {
 		return "***"
 	}
@@ -313,78 +651,109 @@ func resolveLogger(cfg Config) *log.Logger {
 	return log.New(io.Discard, "", 0)
 }
 
-func newMonitor(cfg Config, secret []byte, client *http.Client, logger *log.Logger) *Monitor {
+func newMonitor(cfg Config, exporters []Exporter, logger *sdkLogger) *Monitor {
+	ctx, cancel := context.WithCancel(context.Background())
 	monitor := &Monitor{
-		cfg:     cfg,
-		secret:  secret,
-		client:  client,
-		logger:  logger,
-		events:  make(chan Event, cfg.QueueSize),
-		sem:     make(chan struct{}, cfg.MaxConcurrentSends),
-		closeCh: make(chan struct{}),
-		enabled: true,
-		rnd:     rand.New(rand.NewSource(time.Now().UnixNano())),
+		cfg:      cfg,
+		log:      logger,
+		events:   make(chan Event, cfg.QueueSize),
+		closeCh:  make(chan struct{}),
+		enabled:  true,
+		rnd:      rand.New(rand.NewSource(time.Now().UnixNano())),
+		ctx:      ctx,
+		cancel:   cancel,
+		inFlight: map[uint64][]Event{},
+	}
+	monitor.settings.Store(newLiveSettings(cfg, true))
+	monitor.processors = newProcessorChain(cfg.Processors)
+	monitor.adaptive = newAdaptiveSampler(monitor.queuePressure)
+	for _, exporter := range exporters {
+		monitor.pipelines = append(monitor.pipelines, newExportPipeline(monitor, exporter))
+	}
+
+	monitor.wg.Add(1 + len(monitor.pipelines))
+	for _, p := range monitor.pipelines {
+		go p.run()
 	}
-
-	monitor.wg.Add(1)
 	go monitor.run()
+	go monitor.adaptive.evictLoop(monitor.closeCh)
 	return monitor
 }
 
 func newNoopMonitor(cfg Config) *Monitor {
-	logger := resolveLogger(cfg)
-	return &Monitor{
+	logger := newSDKLogger(cfg)
+	monitor := &Monitor{
 		cfg: Config{
 			ProjectKey:         cfg.ProjectKey,
 			SecretKey:          cfg.SecretKey,
+			SecretProvider:     cfg.SecretProvider,
 			Endpoint:           cfg.Endpoint,
+			Endpoints:          cfg.Endpoints,
 			Enabled:            cfg.Enabled,
 			Verbose:            cfg.Verbose,
 			Actor:              cfg.Actor,
 			MaxConcurrentSends: cfg.MaxConcurrentSends,
 			QueueSize:          cfg.QueueSize,
 			HTTPClient:         cfg.HTTPClient,
-			Logger:             logger,
+			Logger:             cfg.Logger,
+			SlogHandler:        cfg.SlogHandler,
+			OnUndelivered:      cfg.OnUndelivered,
+			OnExportFailed:     cfg.OnExportFailed,
+			Exporters:          cfg.Exporters,
+			Processors:         cfg.Processors,
+			Sampling:           cfg.Sampling,
+			Redaction:          cfg.Redaction,
+			Capture:            cfg.Capture,
 		},
-		client:  cfg.HTTPClient,
-		logger:  logger,
+		log:     logger,
 		closeCh: make(chan struct{}),
 		enabled: false,
 	}
+	monitor.settings.Store(newLiveSettings(monitor.cfg, false))
+	return monitor
 }
 
 func initMonitor(cfg Config) (*Monitor, error) {
-	logger := resolveLogger(cfg)
+	if cfg.SlogHandler == nil {
+		cfg.Logger = resolveLogger(cfg)
+	}
+	logger := newSDKLogger(cfg)
 	enabled := true
 	if cfg.Enabled != nil {
 		enabled = *cfg.Enabled
 	}
 	if !enabled {
-		cfg.Logger = logger
 		cfg.Actor = normalizeActorConfig(cfg.Actor)
-		if cfg.Verbose {
-			logger.Printf("verbose init disabled")
-		}
+		logger.info("init disabled")
 		return newNoopMonitor(cfg), nil
 	}
 
-	endpoint := cfg.Endpoint
-	if endpoint == "" {
-		endpoint = defaultEndpoint
+	endpoints, err := resolveEndpoints(cfg)
+	if err != nil {
+		return nil, err
 	}
 
-	if err := ValidateConfig(cfg.ProjectKey, cfg.SecretKey, endpoint); err != nil {
-		return nil, err
+	useIngest := len(cfg.Exporters) == 0 || cfg.ProjectKey != "" || cfg.SecretKey != "" || cfg.SecretProvider != nil
+	if useIngest {
+		if err := validateIngestConfig(cfg, endpoints); err != nil {
+			return nil, err
+		}
 	}
 	if err := validateActorConfig(cfg.Actor); err != nil {
 		return nil, err
 	}
-	actor := normalizeActorConfig(cfg.Actor)
-
-	secret, err := base64.RawURLEncoding.DecodeString(cfg.SecretKey)
-	if err != nil {
-		return nil, fmt.Errorf("decode secret key: %w", err)
+	if err := validateCaptureConfig(cfg); err != nil {
+		return nil, err
+	}
+	if err := validateProcessors(cfg.Processors); err != nil {
+		return nil, err
 	}
+	for i, exporter := range cfg.Exporters {
+		if exporter == nil {
+			return nil, fmt.Errorf("exporters[%d] must not be nil", i)
+		}
+	}
+	actor := normalizeActorConfig(cfg.Actor)
 
 	queueSize := cfg.QueueSize
 	if queueSize <= 0 {
@@ -396,32 +765,76 @@ func initMonitor(cfg Config) (*Monitor, error) {
 		maxConcurrent = defaultMaxConcurrentSends
 	}
 
-	client := cfg.HTTPClient
-	if client == nil {
-		client = &http.Client{Timeout: defaultHTTPTimeout}
+	client, transportOptions, err := ingestHTTPClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint := ""
+	if len(cfg.Endpoints) == 0 {
+		endpoint = endpoints[0]
 	}
 
 	normalized := Config{
-		ProjectKey:         cfg.ProjectKey,
-		SecretKey:          cfg.SecretKey,
-		Endpoint:           endpoint,
-		Enabled:            cfg.Enabled,
-		Verbose:            cfg.Verbose,
-		Actor:              actor,
-		MaxConcurrentSends: maxConcurrent,
-		QueueSize:          queueSize,
-		HTTPClient:         client,
-		Logger:             logger,
-	}
-
-	monitor := newMonitor(normalized, secret, client, logger)
-	monitor.verbosef(
-		"init sdk=%s endpoint=%s project_key=%s queue_size=%d max_concurrent_sends=%d",
-		VersionHeaderValue(),
-		endpoint,
-		maskedProjectKey(cfg.ProjectKey),
-		queueSize,
-		maxConcurrent,
+		ProjectKey:          cfg.ProjectKey,
+		SecretKey:           cfg.SecretKey,
+		SecretProvider:      cfg.SecretProvider,
+		Endpoint:            endpoint,
+		AllowCustomEndpoint: cfg.AllowCustomEndpoint,
+		Endpoints:           cfg.Endpoints,
+		FailoverThreshold:   cfg.FailoverThreshold,
+		FailbackInterval:    cfg.FailbackInterval,
+		Enabled:             cfg.Enabled,
+		Verbose:             cfg.Verbose,
+		Actor:               actor,
+		MaxConcurrentSends:  maxConcurrent,
+		QueueSize:           queueSize,
+		HTTPClient:          client,
+		Logger:              cfg.Logger,
+		SlogHandler:         cfg.SlogHandler,
+		OnUndelivered:       cfg.OnUndelivered,
+		OnExportFailed:      cfg.OnExportFailed,
+		Exporters:           cfg.Exporters,
+		Processors:          cfg.Processors,
+		Sampling:            cfg.Sampling,
+		Redaction:           cfg.Redaction,
+		Capture:             cfg.Capture,
+	}
+
+	var exporters []Exporter
+	if useIngest {
+		ingest, err := newIngestExporter(normalized, logger)
+		if err != nil {
+			return nil, err
+		}
+		exporters = append(exporters, ingest)
+	}
+	exporters = append(exporters, cfg.Exporters...)
+
+	monitor := newMonitor(normalized, exporters, logger)
+	logger.info(
+		"init",
+		"sdk", VersionHeaderValue(),
+		"endpoint", strings.Join(endpoints, ","),
+		"project_key", MaskProjectKey(cfg.ProjectKey),
+		"queue_size", queueSize,
+		"max_concurrent_sends", maxConcurrent,
+		"exporters", monitor.exporterNames(),
 	)
+	if len(transportOptions) > 0 {
+		var attrs []any
+		for _, option := range transportOptions {
+			key, value, _ := strings.Cut(option, "=")
+			attrs = append(attrs, key, value)
+		}
+		logger.info("init transport", attrs...)
+	}
+	if useIngest {
+		for _, endpoint := range endpoints {
+			if !isAIKOEndpoint(endpoint) {
+				logger.warn("init warning", "custom_endpoint", endpoint, "reason", "events are sent to a non-AIKO ingest endpoint")
+			}
+		}
+	}
 	return monitor, nil
 }
@@ -0,0 +1,223 @@
+package aiko
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	SignatureVersion     = "aiko-v1"
+	DefaultSignatureSkew = 5 * time.Minute
+
+	HeaderSignature          = "X-Signature"
+	HeaderSignatureTimestamp = "X-Signature-Timestamp"
+	HeaderSignatureNonce     = "X-Signature-Nonce"
+	HeaderSignatureKeyID     = "X-Signature-Key-Id"
+	HeaderProjectKey         = "X-Project-Key"
+	HeaderIdempotencyKey     = "Idempotency-Key"
+)
+
+var (
+	ErrSignatureMissing    = errors.New("signature headers are missing")
+	ErrSignatureExpired    = errors.New("signature timestamp is outside the allowed skew")
+	ErrSignatureMismatch   = errors.New("signature does not match")
+	ErrSignatureReplayed   = errors.New("signature nonce was already used")
+	ErrSignatureUnknownKey = errors.New("signature key id is unknown")
+	ErrProjectKeyMismatch  = errors.New("project key does not match")
+
+	// ErrSignatureDuplicate reports a replayed nonce that carries the same
+	// Idempotency-Key as the request that first used it. net/http resends a
+	// request unchanged when a keep-alive connection fails under it, so the
+	// first copy may already have been accepted; servers answer it as a
+	// success without ingesting the event again.
+	ErrSignatureDuplicate = errors.New("request was already received under this idempotency key")
+)
+
+type RequestSignature struct {
+	Signature string
+	Timestamp string
+	Nonce     string
+	KeyID     string
+}
+
+// SignatureCanonicalString returns the string covered by the request HMAC,
+// the following fields joined by "\n":
+//
+//	aiko-v1
+//	<X-Signature-Timestamp, unix seconds>
+//	<X-Signature-Nonce>
+//	<X-Project-Key>
+//	<lowercase hex sha256 of the gzip request body>
+func SignatureCanonicalString(timestamp, nonce, projectKey string, body []byte) string {
+	digest := sha256.Sum256(body)
+	return strings.Join([]string{
+		SignatureVersion,
+		timestamp,
+		nonce,
+		projectKey,
+		hex.EncodeToString(digest[:]),
+	}, "\n")
+}
+
+func SignRequest(secret []byte, keyID, projectKey string, body []byte, now time.Time) RequestSignature {
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	nonce := randomHex(16)
+	return RequestSignature{
+		Signature: Sign(secret, []byte(SignatureCanonicalString(timestamp, nonce, projectKey, body))),
+		Timestamp: timestamp,
+		Nonce:     nonce,
+		KeyID:     keyID,
+	}
+}
+
+func (s RequestSignature) Apply(h http.Header) {
+	h.Set(HeaderSignature, s.Signature)
+	h.Set(HeaderSignatureTimestamp, s.Timestamp)
+	h.Set(HeaderSignatureNonce, s.Nonce)
+	h.Set(HeaderSignatureKeyID, s.KeyID)
+}
+
+func SecretKeyID(secret []byte) string {
+	digest := sha256.Sum256(secret)
+	return "k_" + hex.EncodeToString(digest[:8])
+}
+
+type SignatureVerifier struct {
+	projectKey string
+	secrets    map[string][]byte
+	maxSkew    time.Duration
+
+	mu        sync.Mutex
+	nonces    map[string]seenNonce
+	lastPrune time.Time
+}
+
+type seenNonce struct {
+	at             time.Time
+	idempotencyKey string
+}
+
+func NewSignatureVerifier(projectKey string, maxSkew time.Duration, secretKeys ...string) (*SignatureVerifier, error) {
+	if len(secretKeys) == 0 {
+		return nil, errors.New("at least one secret key is required")
+	}
+	if maxSkew <= 0 {
+		maxSkew = DefaultSignatureSkew
+	}
+	v := &SignatureVerifier{
+		projectKey: projectKey,
+		secrets:    make(map[string][]byte, len(secretKeys)),
+		maxSkew:    maxSkew,
+		nonces:     map[string]seenNonce{},
+	}
+	for _, key := range secretKeys {
+		secret, err := base64.RawURLEncoding.DecodeString(key)
+		if err != nil {
+			return nil, fmt.Errorf("decode secret key: %w", err)
+		}
+		v.secrets[SecretKeyID(secret)] = secret
+	}
+	return v, nil
+}
+
+// AddSecret registers another accepted key, typically the incoming key of a
+// rotation whose ID was set explicitly.
+func (v *SignatureVerifier) AddSecret(s SigningSecret) error {
+	key, err := decodeSigningSecret(s)
+	if err != nil {
+		return err
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.secrets[key.ID] = key.Secret
+	return nil
+}
+
+// Verify checks a request and records its nonce, so the same signature is
+// not accepted twice. Servers that can still fail a request after it
+// verified, for example on a bad payload or a full queue, use Check and call
+// Commit only once they answer it with a success.
+func (v *SignatureVerifier) Verify(h http.Header, body []byte) error {
+	if err := v.Check(h, body); err != nil {
+		return err
+	}
+	v.Commit(h)
+	return nil
+}
+
+// Check verifies a request without recording its nonce. It reports
+// ErrSignatureReplayed or ErrSignatureDuplicate for nonces already committed.
+func (v *SignatureVerifier) Check(h http.Header, body []byte) error {
+	if v.projectKey != "" && h.Get(HeaderProjectKey) != v.projectKey {
+		return ErrProjectKeyMismatch
+	}
+
+	signature := h.Get(HeaderSignature)
+	timestamp := h.Get(HeaderSignatureTimestamp)
+	nonce := h.Get(HeaderSignatureNonce)
+	keyID := h.Get(HeaderSignatureKeyID)
+	if signature == "" || timestamp == "" || nonce == "" || keyID == "" {
+		return ErrSignatureMissing
+	}
+
+	v.mu.Lock()
+	secret, ok := v.secrets[keyID]
+	v.mu.Unlock()
+	if !ok {
+		return ErrSignatureUnknownKey
+	}
+
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrSignatureExpired
+	}
+	now := time.Now()
+	signedAt := time.Unix(seconds, 0)
+	if signedAt.Before(now.Add(-v.maxSkew)) || signedAt.After(now.Add(v.maxSkew)) {
+		return ErrSignatureExpired
+	}
+
+	expected := Sign(secret, []byte(SignatureCanonicalString(timestamp, nonce, h.Get(HeaderProjectKey), body)))
+	if !hmac.Equal([]byte(signature), []byte(expected)) {
+		return ErrSignatureMismatch
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if seen, ok := v.nonces[keyID+":"+nonce]; ok {
+		if key := h.Get(HeaderIdempotencyKey); key != "" && key == seen.idempotencyKey {
+			return ErrSignatureDuplicate
+		}
+		return ErrSignatureReplayed
+	}
+	return nil
+}
+
+// Commit records the nonce of a request that passed Check, so later copies
+// of it are reported as replays or duplicates.
+func (v *SignatureVerifier) Commit(h http.Header) {
+	now := time.Now()
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if now.Sub(v.lastPrune) > time.Second {
+		for key, seen := range v.nonces {
+			if now.Sub(seen.at) > 2*v.maxSkew {
+				delete(v.nonces, key)
+			}
+		}
+		v.lastPrune = now
+	}
+	replayKey := h.Get(HeaderSignatureKeyID) + ":" + h.Get(HeaderSignatureNonce)
+	if _, ok := v.nonces[replayKey]; !ok {
+		v.nonces[replayKey] = seenNonce{at: now, idempotencyKey: h.Get(HeaderIdempotencyKey)}
+	}
+}
@@ -0,0 +1,367 @@
+package aiko
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultCertReloadInterval = time.Minute
+
+// TransportConfig configures the HTTP client used for ingest when
+// Config.HTTPClient is not set.
+type TransportConfig struct {
+	// CAFile is a PEM bundle trusted in addition to the system roots.
+	CAFile string
+
+	// ClientCertFile and ClientKeyFile enable mTLS. The pair is re-read when
+	// either file changes, checked at most every CertReloadInterval.
+	ClientCertFile     string
+	ClientKeyFile      string
+	CertReloadInterval time.Duration
+
+	// ProxyURL routes ingest through an http, https or socks5 proxy. Hosts
+	// matching NoProxy (or the NO_PROXY environment variable when NoProxy is
+	// empty) and loopback hosts connect directly. NoProxy requires ProxyURL;
+	// without ProxyURL the usual HTTPS_PROXY/NO_PROXY environment variables
+	// apply. The TLS handshake with an https proxy trusts CAFile but sends no
+	// client certificate and is not checked against PinnedSPKISHA256; those
+	// apply to the ingest connection only.
+	ProxyURL string
+	NoProxy  string
+
+	// PinnedSPKISHA256 lists base64 SHA-256 hashes of trusted
+	// SubjectPublicKeyInfo blocks, optionally prefixed with "sha256/". At
+	// least one certificate in one of the verified chains must match.
+	PinnedSPKISHA256 []string
+}
+
+func (c TransportConfig) isZero() bool {
+	return c.CAFile == "" && c.ClientCertFile == "" && c.ClientKeyFile == "" &&
+		c.ProxyURL == "" && c.NoProxy == "" && len(c.PinnedSPKISHA256) == 0
+}
+
+// ingestHTTPClient returns cfg.HTTPClient, a client built from cfg.Transport,
+// or the default client, plus the applied transport options.
+func ingestHTTPClient(cfg Config) (*http.Client, []string, error) {
+	if cfg.Transport.isZero() {
+		if cfg.HTTPClient != nil {
+			return cfg.HTTPClient, nil, nil
+		}
+		return &http.Client{Timeout: defaultHTTPTimeout}, nil, nil
+	}
+	if cfg.HTTPClient != nil {
+		return nil, nil, errors.New("httpClient and transport cannot both be set")
+	}
+	return newTransportClient(cfg.Transport)
+}
+
+// NewTransportClient returns the HTTP client the SDK builds from cfg for
+// ingest, for tools that need to connect the same way, such as aiko verify.
+// The client's Transport is always an *http.Transport.
+func NewTransportClient(cfg TransportConfig) (*http.Client, error) {
+	client, _, err := newTransportClient(cfg)
+	return client, err
+}
+
+// newTransportClient builds an HTTP client from cfg and returns the list of
+// applied options for the init log.
+func newTransportClient(cfg TransportConfig) (*http.Client, []string, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	var applied []string
+
+	if cfg.CAFile != "" {
+		raw, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("read transport caFile: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(raw) {
+			return nil, nil, errors.New("transport caFile contains no PEM certificates")
+		}
+		tlsConfig.RootCAs = pool
+		applied = append(applied, "ca_file="+cfg.CAFile)
+	}
+
+	if cfg.ClientCertFile != "" || cfg.ClientKeyFile != "" {
+		if cfg.ClientCertFile == "" || cfg.ClientKeyFile == "" {
+			return nil, nil, errors.New("transport clientCertFile and clientKeyFile must be set together")
+		}
+		cert, err := newReloadingCertificate(cfg.ClientCertFile, cfg.ClientKeyFile, cfg.CertReloadInterval)
+		if err != nil {
+			return nil, nil, err
+		}
+		tlsConfig.GetClientCertificate = cert.get
+		applied = append(applied, "client_cert="+cfg.ClientCertFile)
+	}
+
+	if len(cfg.PinnedSPKISHA256) > 0 {
+		pins, err := decodeSPKIPins(cfg.PinnedSPKISHA256)
+		if err != nil {
+			return nil, nil, err
+		}
+		tlsConfig.VerifyConnection = func(cs tls.ConnectionState) error {
+			return verifySPKIPins(cs, pins)
+		}
+		applied = append(applied, fmt.Sprintf("spki_pins=%d", len(pins)))
+	}
+
+	if cfg.NoProxy != "" && cfg.ProxyURL == "" {
+		return nil, nil, errors.New("transport noProxy requires proxyURL; without it set NO_PROXY in the environment")
+	}
+	if cfg.ProxyURL != "" {
+		proxyURL, err := url.Parse(cfg.ProxyURL)
+		if err != nil {
+			return nil, nil, fmt.Errorf("parse transport proxyURL: %w", err)
+		}
+		switch proxyURL.Scheme {
+		case "http", "https", "socks5":
+		default:
+			return nil, nil, fmt.Errorf("transport proxyURL scheme %q is not supported; use http, https or socks5", proxyURL.Scheme)
+		}
+		if proxyURL.Host == "" {
+			return nil, nil, errors.New("transport proxyURL must include a host")
+		}
+		noProxy := cfg.NoProxy
+		if noProxy == "" {
+			noProxy = firstEnv("NO_PROXY", "no_proxy")
+		}
+		rules := parseNoProxy(noProxy)
+		transport.Proxy = func(req *http.Request) (*url.URL, error) {
+			if rules.bypass(req.URL) {
+				return nil, nil
+			}
+			return proxyURL, nil
+		}
+		if proxyURL.Scheme == "https" {
+			dialProxyTLS(transport, proxyURL, tlsConfig.RootCAs)
+		}
+		applied = append(applied, "proxy="+proxyURL.Redacted())
+		if noProxy != "" {
+			applied = append(applied, "no_proxy="+noProxy)
+		}
+	}
+
+	transport.TLSClientConfig = tlsConfig
+	return &http.Client{Timeout: defaultHTTPTimeout, Transport: transport}, applied, nil
+}
+
+// dialProxyTLS keeps the client certificate and SPKI pins off the handshake
+// with an https proxy. Without a TLS dialer the transport would use
+// TLSClientConfig for the proxy as well; ingest connections, direct or
+// tunnelled through CONNECT, still use TLSClientConfig.
+func dialProxyTLS(transport *http.Transport, proxyURL *url.URL, roots *x509.CertPool) {
+	port := proxyURL.Port()
+	if port == "" {
+		port = "443"
+	}
+	proxyAddr := net.JoinHostPort(strings.ToLower(proxyURL.Hostname()), port)
+	proxyTLS := &tls.Config{MinVersion: tls.VersionTLS12, RootCAs: roots}
+	netDialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	transport.DialTLSContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		config := transport.TLSClientConfig
+		if strings.EqualFold(addr, proxyAddr) {
+			config = proxyTLS
+		}
+		dialer := &tls.Dialer{NetDialer: netDialer, Config: config}
+		return dialer.DialContext(ctx, network, addr)
+	}
+}
+
+type reloadingCertificate struct {
+	certFile string
+	keyFile  string
+	interval time.Duration
+
+	mu        sync.Mutex
+	cert      *tls.Certificate
+	modTimes  [2]time.Time
+	checkedAt time.Time
+}
+
+func newReloadingCertificate(certFile, keyFile string, interval time.Duration) (*reloadingCertificate, error) {
+	if interval <= 0 {
+		interval = defaultCertReloadInterval
+	}
+	c := &reloadingCertificate{certFile: certFile, keyFile: keyFile, interval: interval}
+	if err := c.reloadLocked(time.Now()); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *reloadingCertificate) get(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	now := time.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if now.Sub(c.checkedAt) >= c.interval {
+		// A broken pair keeps the last good certificate until it is fixed.
+		_ = c.reloadLocked(now)
+	}
+	return c.cert, nil
+}
+
+func (c *reloadingCertificate) reloadLocked(now time.Time) error {
+	c.checkedAt = now
+	var modTimes [2]time.Time
+	for i, path := range []string{c.certFile, c.keyFile} {
+		info, err := os.Stat(path)
+		if err != nil {
+			return fmt.Errorf("stat transport client certificate: %w", err)
+		}
+		modTimes[i] = info.ModTime()
+	}
+	if c.cert != nil && modTimes == c.modTimes {
+		return nil
+	}
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return fmt.Errorf("load transport client certificate: %w", err)
+	}
+	c.cert = &cert
+	c.modTimes = modTimes
+	return nil
+}
+
+func decodeSPKIPins(values []string) ([][]byte, error) {
+	pins := make([][]byte, 0, len(values))
+	for i, value := range values {
+		value = strings.TrimPrefix(strings.TrimSpace(value), "sha256/")
+		pin, err := base64.StdEncoding.DecodeString(value)
+		if err != nil || len(pin) != sha256.Size {
+			return nil, fmt.Errorf("transport pinnedSPKISHA256[%d] must be a base64 SHA-256 hash", i)
+		}
+		pins = append(pins, pin)
+	}
+	return pins, nil
+}
+
+func verifySPKIPins(cs tls.ConnectionState, pins [][]byte) error {
+	// a cross-signed server can verify through several chains; the pin may
+	// be on any of them
+	chains := cs.VerifiedChains
+	if len(chains) == 0 {
+		chains = [][]*x509.Certificate{cs.PeerCertificates}
+	}
+	for _, chain := range chains {
+		for _, cert := range chain {
+			digest := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+			for _, pin := range pins {
+				if string(digest[:]) == string(pin) {
+					return nil
+				}
+			}
+		}
+	}
+	return errors.New("aiko: ingest certificate does not match any pinned SPKI hash")
+}
+
+// SPKIHash returns the pin value for cert in the format accepted by
+// TransportConfig.PinnedSPKISHA256.
+func SPKIHash(cert *x509.Certificate) string {
+	digest := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return "sha256/" + base64.StdEncoding.EncodeToString(digest[:])
+}
+
+type noProxyRules struct {
+	all      bool
+	networks []*net.IPNet
+	ips      []net.IP
+	domains  []noProxyDomain
+}
+
+type noProxyDomain struct {
+	name string
+	port string
+}
+
+// parseNoProxy follows the usual NO_PROXY conventions: comma-separated
+// entries, "*" for everything, IPs and CIDR ranges, and domain names that
+// also match their subdomains, each with an optional port.
+func parseNoProxy(value string) noProxyRules {
+	var rules noProxyRules
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		switch {
+		case entry == "":
+			continue
+		case entry == "*":
+			rules.all = true
+			continue
+		}
+		if _, network, err := net.ParseCIDR(entry); err == nil {
+			rules.networks = append(rules.networks, network)
+			continue
+		}
+		host, port := entry, ""
+		if h, p, err := net.SplitHostPort(entry); err == nil {
+			host, port = h, p
+		}
+		if ip := net.ParseIP(strings.Trim(host, "[]")); ip != nil {
+			rules.ips = append(rules.ips, ip)
+			continue
+		}
+		rules.domains = append(rules.domains, noProxyDomain{
+			name: strings.TrimPrefix(strings.TrimPrefix(host, "*"), "."),
+			port: port,
+		})
+	}
+	return rules
+}
+
+func (r noProxyRules) bypass(u *url.URL) bool {
+	host := strings.ToLower(u.Hostname())
+	if r.all || isLoopbackHost(host) {
+		return true
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		for _, network := range r.networks {
+			if network.Contains(ip) {
+				return true
+			}
+		}
+		for _, candidate := range r.ips {
+			if candidate.Equal(ip) {
+				return true
+			}
+		}
+		return false
+	}
+	port := u.Port()
+	if port == "" {
+		port = map[string]string{"http": "80", "https": "443"}[u.Scheme]
+	}
+	for _, domain := range r.domains {
+		if domain.port != "" && domain.port != port {
+			continue
+		}
+		if host == domain.name || strings.HasSuffix(host, "."+domain.name) {
+			return true
+		}
+	}
+	return false
+}
+
+func firstEnv(names ...string) string {
+	for _, name := range names {
+		if value := os.Getenv(name); value != "" {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,202 @@
+package aikotest
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	aiko "github.com/aikocorp/aiko-monitor-go/aiko"
+)
+
+// Matcher checks one property of a captured event and explains a mismatch.
+type Matcher func(aiko.Event) error
+
+// Match runs every matcher against evt and joins their failures.
+func Match(evt aiko.Event, matchers ...Matcher) error {
+	var errs []error
+	for _, m := range matchers {
+		if err := m(evt); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return fmt.Errorf("event %s: %w", describe(evt), errors.Join(errs...))
+}
+
+// AssertEvent fails t when evt does not satisfy every matcher.
+func AssertEvent(t TB, evt aiko.Event, matchers ...Matcher) {
+	t.Helper()
+	if err := Match(evt, matchers...); err != nil {
+		t.Fatalf("aikotest: %v", err)
+	}
+}
+
+func Method(method string) Matcher {
+	return func(evt aiko.Event) error {
+		if !strings.EqualFold(evt.Method, method) {
+			return fmt.Errorf("method: want %s, got %s", method, evt.Method)
+		}
+		return nil
+	}
+}
+
+// Endpoint matches the captured path and query.
+func Endpoint(endpoint string) Matcher {
+	return func(evt aiko.Event) error {
+		if evt.Endpoint != endpoint {
+			return fmt.Errorf("endpoint: want %s, got %s", endpoint, evt.Endpoint)
+		}
+		return nil
+	}
+}
+
+func Status(code int) Matcher {
+	return func(evt aiko.Event) error {
+		if evt.StatusCode != code {
+			return fmt.Errorf("status: want %d, got %d", code, evt.StatusCode)
+		}
+		return nil
+	}
+}
+
+// Actor matches the non-empty fields of want against the captured actor.
+func Actor(want aiko.ActorContext) Matcher {
+	return func(evt aiko.Event) error {
+		if evt.Actor == nil {
+			return errors.New("actor: want an actor, got none")
+		}
+		got := *evt.Actor
+		checks := []struct {
+			name       string
+			want, have string
+		}{
+			{"provider", string(want.Provider), string(got.Provider)},
+			{"id", want.ID, got.ID},
+			{"email", want.Email, got.Email},
+			{"org_id", want.OrgID, got.OrgID},
+		}
+		for _, c := range checks {
+			if c.want != "" && c.want != c.have {
+				return fmt.Errorf("actor.%s: want %s, got %s", c.name, c.want, c.have)
+			}
+		}
+		return nil
+	}
+}
+
+// NoActor matches events captured without an actor.
+func NoActor() Matcher {
+	return func(evt aiko.Event) error {
+		if evt.Actor != nil {
+			return fmt.Errorf("actor: want none, got %+v", *evt.Actor)
+		}
+		return nil
+	}
+}
+
+// RequestHeader matches a captured request header after lowercasing and
+// redaction, so a secret header matches "[REDACTED]".
+func RequestHeader(name, value string) Matcher {
+	return headerMatcher("request", func(evt aiko.Event) map[string]string { return evt.RequestHeaders }, name, value)
+}
+
+func ResponseHeader(name, value string) Matcher {
+	return headerMatcher("response", func(evt aiko.Event) map[string]string { return evt.ResponseHeaders }, name, value)
+}
+
+func headerMatcher(side string, headers func(aiko.Event) map[string]string, name, value string) Matcher {
+	key := strings.ToLower(name)
+	return func(evt aiko.Event) error {
+		got, ok := headers(evt)[key]
+		if !ok {
+			return fmt.Errorf("%s header %s: missing", side, key)
+		}
+		if got != value {
+			return fmt.Errorf("%s header %s: want %q, got %q", side, key, value, got)
+		}
+		return nil
+	}
+}
+
+// RequestBodyPath matches a value inside the decoded request body. Path
+// segments are separated by dots; numeric segments index arrays, as in
+// "items.0.sku".
+func RequestBodyPath(path string, want any) Matcher {
+	return bodyPathMatcher("request", func(evt aiko.Event) any { return evt.RequestBody }, path, want)
+}
+
+func ResponseBodyPath(path string, want any) Matcher {
+	return bodyPathMatcher("response", func(evt aiko.Event) any { return evt.ResponseBody }, path, want)
+}
+
+func bodyPathMatcher(side string, body func(aiko.Event) any, path string, want any) Matcher {
+	return func(evt aiko.Event) error {
+		got, err := lookupPath(body(evt), path)
+		if err != nil {
+			return fmt.Errorf("%s body %s: %w", side, path, err)
+		}
+		if !sameValue(got, want) {
+			return fmt.Errorf("%s body %s: want %v, got %v", side, path, want, got)
+		}
+		return nil
+	}
+}
+
+func lookupPath(value any, path string) (any, error) {
+	if path == "" {
+		return value, nil
+	}
+	for _, segment := range strings.Split(path, ".") {
+		switch node := value.(type) {
+		case map[string]any:
+			next, ok := node[segment]
+			if !ok {
+				return nil, fmt.Errorf("no key %q", segment)
+			}
+			value = next
+		case []any:
+			i, err := strconv.Atoi(segment)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, fmt.Errorf("no index %q", segment)
+			}
+			value = node[i]
+		default:
+			return nil, fmt.Errorf("cannot descend into %T at %q", value, segment)
+		}
+	}
+	return value, nil
+}
+
+// sameValue compares decoded JSON with a Go value, treating all numbers as
+// float64 the way encoding/json decodes them.
+func sameValue(got, want any) bool {
+	if wantNumber, ok := toFloat(want); ok {
+		gotNumber, ok := toFloat(got)
+		return ok && gotNumber == wantNumber
+	}
+	return reflect.DeepEqual(got, want)
+}
+
+func toFloat(v any) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case uint:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	}
+	return 0, false
+}
@@ -0,0 +1,166 @@
+// Package aikotest helps applications assert what the AIKO SDK captures in
+// their own tests, either in memory or against a signature-verifying ingest
+// server.
+package aikotest
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	aiko "github.com/aikocorp/aiko-monitor-go/aiko"
+)
+
+// Recorder is a Monitor whose only exporter keeps events in memory. Events go
+// through the same normalization, client IP handling and redaction as in
+// production, but nothing leaves the process.
+type Recorder struct {
+	monitor *aiko.Monitor
+
+	mu      sync.Mutex
+	events  []aiko.Event
+	changed chan struct{}
+}
+
+// NewRecorder builds a recording monitor from cfg. Keys, endpoints and
+// exporters in cfg are ignored so the recorder never uses the network.
+func NewRecorder(cfg aiko.Config) (*Recorder, error) {
+	r := &Recorder{changed: make(chan struct{})}
+	cfg.ProjectKey = ""
+	cfg.SecretKey = ""
+	cfg.SecretProvider = nil
+	cfg.Endpoint = ""
+	cfg.Endpoints = nil
+	cfg.Exporters = []aiko.Exporter{recordingExporter{r}}
+	monitor, err := aiko.New(cfg)
+	if err != nil {
+		return nil, err
+	}
+	r.monitor = monitor
+	return r, nil
+}
+
+// TB is the subset of testing.TB used by the helpers in this package.
+type TB interface {
+	Helper()
+	Fatalf(format string, args ...any)
+	Cleanup(func())
+}
+
+// NewTestRecorder is NewRecorder for tests: it fails t on error and closes
+// the recorder when the test ends.
+func NewTestRecorder(t TB, cfg aiko.Config) *Recorder {
+	t.Helper()
+	r, err := NewRecorder(cfg)
+	if err != nil {
+		t.Fatalf("aikotest: new recorder: %v", err)
+	}
+	t.Cleanup(func() { _ = r.Close() })
+	return r
+}
+
+func (r *Recorder) Monitor() *aiko.Monitor {
+	return r.monitor
+}
+
+// Events returns every event recorded so far.
+func (r *Recorder) Events() []aiko.Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]aiko.Event(nil), r.events...)
+}
+
+// Reset forgets recorded events.
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = nil
+}
+
+// WaitForEvents blocks until at least n events were recorded and returns the
+// first n.
+func (r *Recorder) WaitForEvents(n int, timeout time.Duration) ([]aiko.Event, error) {
+	events, err := waitFor(&r.mu, &r.changed, timeout, func() ([]aiko.Event, bool) {
+		return r.events, len(r.events) >= n
+	})
+	if err != nil {
+		return events, fmt.Errorf("aikotest: got %d of %d events: %w", len(events), n, err)
+	}
+	return events[:n], nil
+}
+
+// WaitForMatch blocks until an event matching all matchers is recorded.
+func (r *Recorder) WaitForMatch(timeout time.Duration, matchers ...Matcher) (aiko.Event, error) {
+	var found aiko.Event
+	events, err := waitFor(&r.mu, &r.changed, timeout, func() ([]aiko.Event, bool) {
+		for _, evt := range r.events {
+			if Match(evt, matchers...) == nil {
+				found = evt
+				return r.events, true
+			}
+		}
+		return r.events, false
+	})
+	if err != nil {
+		return aiko.Event{}, fmt.Errorf("aikotest: no match among %d events: %w", len(events), err)
+	}
+	return found, nil
+}
+
+// Close shuts the monitor down after delivering queued events.
+func (r *Recorder) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return r.monitor.Shutdown(ctx)
+}
+
+func (r *Recorder) record(events []aiko.Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, events...)
+	close(r.changed)
+	r.changed = make(chan struct{})
+}
+
+type recordingExporter struct {
+	r *Recorder
+}
+
+func (e recordingExporter) Name() string { return "aikotest" }
+
+func (e recordingExporter) Export(_ context.Context, events []aiko.Event) error {
+	e.r.record(events)
+	return nil
+}
+
+func (e recordingExporter) Flush(context.Context) error { return nil }
+
+func (e recordingExporter) Shutdown(context.Context) error { return nil }
+
+// waitFor re-evaluates check every time *changed is closed until it reports
+// done or timeout passes. check runs with mu held.
+func waitFor(mu *sync.Mutex, changed *chan struct{}, timeout time.Duration, check func() ([]aiko.Event, bool)) ([]aiko.Event, error) {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	for {
+		mu.Lock()
+		events, done := check()
+		events = append([]aiko.Event(nil), events...)
+		wait := *changed
+		mu.Unlock()
+		if done {
+			return events, nil
+		}
+		select {
+		case <-wait:
+		case <-deadline.C:
+			return events, fmt.Errorf("timed out after %s", timeout)
+		}
+	}
+}
+
+func describe(evt aiko.Event) string {
+	return strings.TrimSpace(fmt.Sprintf("%s %s -> %d (id=%s)", evt.Method, evt.Endpoint, evt.StatusCode, evt.ID))
+}
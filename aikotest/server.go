@@ -0,0 +1,188 @@
+package aikotest
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	aiko "github.com/aikocorp/aiko-monitor-go/aiko"
+)
+
+// IngestServer is an httptest server that speaks the AIKO ingest protocol:
+// it verifies X-Project-Key and the request signature (401 and 403 on
+// failure), decodes the gzip body and answers 202 with an X-Request-Id.
+type IngestServer struct {
+	verifier   *aiko.SignatureVerifier
+	srv        *httptest.Server
+	socketPath string
+
+	mu        sync.Mutex
+	events    []aiko.Event
+	requests  []*http.Request
+	statuses  []int
+	responses []int
+	changed   chan struct{}
+}
+
+// NewIngestServer starts a server accepting projectKey signed with any of
+// secretKeys.
+func NewIngestServer(projectKey string, secretKeys ...string) (*IngestServer, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	return newIngestServer(listener, projectKey, secretKeys)
+}
+
+// NewUnixIngestServer is NewIngestServer listening on a unix socket at
+// socketPath; Endpoint returns the matching unix:// URL.
+func NewUnixIngestServer(socketPath, projectKey string, secretKeys ...string) (*IngestServer, error) {
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return nil, err
+	}
+	s, err := newIngestServer(listener, projectKey, secretKeys)
+	if err != nil {
+		return nil, err
+	}
+	s.socketPath = socketPath
+	return s, nil
+}
+
+func newIngestServer(listener net.Listener, projectKey string, secretKeys []string) (*IngestServer, error) {
+	verifier, err := aiko.NewSignatureVerifier(projectKey, aiko.DefaultSignatureSkew, secretKeys...)
+	if err != nil {
+		_ = listener.Close()
+		return nil, err
+	}
+	s := &IngestServer{verifier: verifier, changed: make(chan struct{})}
+	s.srv = httptest.NewUnstartedServer(http.HandlerFunc(s.handle))
+	s.srv.Listener = listener
+	s.srv.Start()
+	return s, nil
+}
+
+// NewTestIngestServer is NewIngestServer for tests: it fails t on error and
+// closes the server when the test ends.
+func NewTestIngestServer(t TB, projectKey string, secretKeys ...string) *IngestServer {
+	t.Helper()
+	s, err := NewIngestServer(projectKey, secretKeys...)
+	if err != nil {
+		t.Fatalf("aikotest: new ingest server: %v", err)
+	}
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Endpoint is the ingest URL to put in aiko.Config.Endpoint.
+func (s *IngestServer) Endpoint() string {
+	if s.socketPath != "" {
+		return "unix://" + s.socketPath
+	}
+	return s.srv.URL + "/api/ingest"
+}
+
+func (s *IngestServer) Close() {
+	s.srv.Close()
+}
+
+// AddSecret accepts another signing key, as during a rotation.
+func (s *IngestServer) AddSecret(secret aiko.SigningSecret) error {
+	return s.verifier.AddSecret(secret)
+}
+
+// SetResponses queues status codes returned to the next requests that pass
+// verification, instead of 202.
+func (s *IngestServer) SetResponses(statuses ...int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.responses = append([]int(nil), statuses...)
+}
+
+// Events returns every accepted event.
+func (s *IngestServer) Events() []aiko.Event {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]aiko.Event(nil), s.events...)
+}
+
+// Requests returns every verified request, including those answered with a
+// queued error status. Bodies are already consumed.
+func (s *IngestServer) Requests() []*http.Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*http.Request(nil), s.requests...)
+}
+
+// Statuses returns the status answered to each verified request, in order.
+func (s *IngestServer) Statuses() []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]int(nil), s.statuses...)
+}
+
+// WaitForEvents blocks until at least n events were accepted and returns the
+// first n.
+func (s *IngestServer) WaitForEvents(n int, timeout time.Duration) ([]aiko.Event, error) {
+	events, err := waitFor(&s.mu, &s.changed, timeout, func() ([]aiko.Event, bool) {
+		return s.events, len(s.events) >= n
+	})
+	if err != nil {
+		return events, fmt.Errorf("aikotest: got %d of %d events: %w", len(events), n, err)
+	}
+	return events[:n], nil
+}
+
+func (s *IngestServer) handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.URL.Path != "/api/ingest" {
+		http.NotFound(w, r)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if err := s.verifier.Check(r.Header, body); errors.Is(err, aiko.ErrSignatureDuplicate) {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	} else if err != nil {
+		if errors.Is(err, aiko.ErrProjectKeyMismatch) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	evt, err := aiko.DecodeGzipEvent(body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	evt = evt.WithClientIP(r.Header.Get("X-Client-IP"))
+
+	s.mu.Lock()
+	s.requests = append(s.requests, r.Clone(r.Context()))
+	requestID := fmt.Sprintf("req_%d", len(s.requests))
+	status := http.StatusAccepted
+	if len(s.responses) > 0 {
+		status = s.responses[0]
+		s.responses = s.responses[1:]
+	}
+	s.statuses = append(s.statuses, status)
+	if status >= 200 && status < 300 {
+		s.verifier.Commit(r.Header)
+		s.events = append(s.events, evt)
+		close(s.changed)
+		s.changed = make(chan struct{})
+	}
+	s.mu.Unlock()
+
+	w.Header().Set("X-Request-Id", requestID)
+	w.WriteHeader(status)
+}
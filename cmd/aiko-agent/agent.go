@@ -0,0 +1,341 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	aiko "github.com/aikocorp/aiko-monitor-go/aiko"
+)
+
+const (
+	maxIngestBodyBytes = 10 << 20
+	// queueFullRetryAfter is the Retry-After, in seconds, sent when the
+	// forwarding queue has no room for an event.
+	queueFullRetryAfter = 1
+)
+
+type agent struct {
+	cfg      config
+	logger   *log.Logger
+	verifier *aiko.SignatureVerifier
+	spool    *spool
+	monitor  *aiko.Monitor
+	started  time.Time
+	stats    agentStats
+}
+
+type agentStats struct {
+	received  atomic.Int64
+	rejected  atomic.Int64
+	forwarded atomic.Int64
+	spooled   atomic.Int64
+	dropped   atomic.Int64
+	replayed  atomic.Int64
+}
+
+// forwardExporter wraps the upstream ingest exporter to count deliveries.
+type forwardExporter struct {
+	*aiko.IngestExporter
+	stats *agentStats
+}
+
+func (e forwardExporter) Export(ctx context.Context, events []aiko.Event) error {
+	if err := e.IngestExporter.Export(ctx, events); err != nil {
+		return err
+	}
+	e.stats.forwarded.Add(int64(len(events)))
+	return nil
+}
+
+func newAgent(cfg config, logger *log.Logger) (*agent, error) {
+	verifier, err := aiko.NewSignatureVerifier(cfg.AcceptProjectKey, aiko.DefaultSignatureSkew, cfg.AcceptSecretKeys...)
+	if err != nil {
+		return nil, fmt.Errorf("accept keys: %w", err)
+	}
+	sp, err := openSpool(cfg.SpoolDir, cfg.SpoolMaxBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	upstream := aiko.Config{
+		ProjectKey:          cfg.ProjectKey,
+		SecretKey:           cfg.SecretKey,
+		Endpoints:           cfg.Endpoints,
+		AllowCustomEndpoint: true,
+		Verbose:             cfg.Verbose,
+		Logger:              logger,
+	}
+	if cfg.SecretFile != "" {
+		provider, err := aiko.NewFileSecretProvider(cfg.SecretFile, 0)
+		if err != nil {
+			return nil, err
+		}
+		upstream.SecretProvider = provider
+	}
+	ingest, err := aiko.NewIngestExporter(upstream)
+	if err != nil {
+		return nil, fmt.Errorf("upstream: %w", err)
+	}
+
+	a := &agent{
+		cfg:      cfg,
+		logger:   logger,
+		verifier: verifier,
+		spool:    sp,
+		started:  time.Now(),
+	}
+	a.monitor, err = aiko.New(aiko.Config{
+		Exporters:          []aiko.Exporter{forwardExporter{IngestExporter: ingest, stats: &a.stats}},
+		QueueSize:          cfg.QueueSize,
+		MaxConcurrentSends: cfg.MaxConcurrentSends,
+		Verbose:            cfg.Verbose,
+		Logger:             logger,
+		OnExportFailed: func(_ string, events []aiko.Event, err error) {
+			if !retryable(err) {
+				a.stats.dropped.Add(int64(len(events)))
+				a.logger.Printf("drop %d events rejected upstream: %v", len(events), err)
+				return
+			}
+			a.spoolEvents(events)
+		},
+		OnUndelivered: a.spoolEvents,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// retryable reports whether a failed export may succeed later, so that only
+// those batches are spooled. Anything upstream rejected outright would fail
+// again on every replay.
+func retryable(err error) bool {
+	var statusErr *aiko.StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.Retryable()
+	}
+	return aiko.IsRetryableError(err)
+}
+
+func (a *agent) spoolEvents(events []aiko.Event) {
+	if err := a.spool.write(events); err != nil {
+		a.stats.dropped.Add(int64(len(events)))
+		a.logger.Printf("spool %d events: %v", len(events), err)
+		return
+	}
+	a.stats.spooled.Add(int64(len(events)))
+}
+
+// replay re-queues spooled events until ctx is done.
+func (a *agent) replay(ctx context.Context) {
+	ticker := time.NewTicker(time.Duration(a.cfg.ReplayInterval))
+	defer ticker.Stop()
+	for {
+		if err := a.replayOnce(ctx); err != nil && ctx.Err() == nil {
+			a.logger.Printf("replay spool: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// replayOnce queues spooled events oldest first, waiting for room in the
+// queue. A file is only shrunk or removed once its events were accepted, so
+// nothing is lost when the queue stays full or the agent stops.
+func (a *agent) replayOnce(ctx context.Context) error {
+	files, err := a.spool.list()
+	if err != nil {
+		return err
+	}
+	for _, path := range files {
+		events, err := a.spool.read(path)
+		if err != nil {
+			return err
+		}
+		accepted := 0
+		var queueErr error
+		for _, evt := range events {
+			if queueErr = a.monitor.AddEventContext(ctx, evt); queueErr != nil {
+				break
+			}
+			accepted++
+		}
+		a.stats.replayed.Add(int64(accepted))
+		if accepted > 0 {
+			if err := a.spool.keep(path, accepted); err != nil {
+				return err
+			}
+		}
+		if queueErr != nil {
+			return queueErr
+		}
+	}
+	return nil
+}
+
+func (a *agent) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/ingest", a.handleIngest)
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	})
+	mux.HandleFunc("GET /stats", func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, http.StatusOK, a.snapshot())
+	})
+	return mux
+}
+
+func (a *agent) handleIngest(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxIngestBodyBytes+1))
+	if err != nil || len(body) > maxIngestBodyBytes {
+		a.stats.rejected.Add(1)
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err := a.verifier.Check(r.Header, body); errors.Is(err, aiko.ErrSignatureDuplicate) {
+		// a transport-level resend of a request already queued
+		w.WriteHeader(http.StatusAccepted)
+		return
+	} else if err != nil {
+		a.stats.rejected.Add(1)
+		status := http.StatusForbidden
+		if errors.Is(err, aiko.ErrProjectKeyMismatch) {
+			status = http.StatusUnauthorized
+		}
+		writeJSON(w, status, map[string]string{"error": err.Error()})
+		return
+	}
+	evt, err := aiko.DecodeGzipEvent(body)
+	if err != nil {
+		a.stats.rejected.Add(1)
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid event payload"})
+		return
+	}
+
+	if err := a.monitor.TryAddEvent(evt.WithClientIP(r.Header.Get("X-Client-IP"))); err != nil {
+		a.stats.rejected.Add(1)
+		w.Header().Set("Retry-After", strconv.Itoa(queueFullRetryAfter))
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": err.Error()})
+		return
+	}
+	// the nonce is only spent once the event is queued, so a resend of a
+	// request that failed above is checked again
+	a.verifier.Commit(r.Header)
+	n := a.stats.received.Add(1)
+	w.Header().Set("X-Request-Id", fmt.Sprintf("agent_%d", n))
+	w.WriteHeader(http.StatusAccepted)
+}
+
+type statsSnapshot struct {
+	Received      int64 `json:"received"`
+	Rejected      int64 `json:"rejected"`
+	Forwarded     int64 `json:"forwarded"`
+	Spooled       int64 `json:"spooled"`
+	Dropped       int64 `json:"dropped"`
+	Replayed      int64 `json:"replayed"`
+	SpoolBytes    int64 `json:"spool_bytes"`
+	UptimeSeconds int64 `json:"uptime_seconds"`
+}
+
+func (a *agent) snapshot() statsSnapshot {
+	return statsSnapshot{
+		Received:      a.stats.received.Load(),
+		Rejected:      a.stats.rejected.Load(),
+		Forwarded:     a.stats.forwarded.Load(),
+		Spooled:       a.stats.spooled.Load(),
+		Dropped:       a.stats.dropped.Load(),
+		Replayed:      a.stats.replayed.Load(),
+		SpoolBytes:    a.spool.bytes(),
+		UptimeSeconds: int64(time.Since(a.started).Seconds()),
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// listen opens the configured listeners. A stale unix socket left by a
+// previous run is removed first.
+func (a *agent) listen() ([]net.Listener, error) {
+	var listeners []net.Listener
+	if a.cfg.ListenUnix != "" {
+		if info, err := os.Stat(a.cfg.ListenUnix); err == nil && info.Mode()&os.ModeSocket != 0 {
+			_ = os.Remove(a.cfg.ListenUnix)
+		}
+		l, err := net.Listen("unix", a.cfg.ListenUnix)
+		if err != nil {
+			return nil, fmt.Errorf("listen unix: %w", err)
+		}
+		listeners = append(listeners, l)
+	}
+	if a.cfg.ListenHTTP != "" {
+		l, err := net.Listen("tcp", a.cfg.ListenHTTP)
+		if err != nil {
+			for _, opened := range listeners {
+				_ = opened.Close()
+			}
+			return nil, fmt.Errorf("listen http: %w", err)
+		}
+		listeners = append(listeners, l)
+	}
+	return listeners, nil
+}
+
+// run serves until ctx is done, then drains the forwarding queue, spooling
+// whatever cannot be delivered within shutdownTimeout.
+func (a *agent) run(ctx context.Context, listeners []net.Listener, shutdownTimeout time.Duration) error {
+	server := &http.Server{Handler: a.handler(), ReadHeaderTimeout: 10 * time.Second}
+	errCh := make(chan error, len(listeners))
+	for _, l := range listeners {
+		a.logger.Printf("listening on %s://%s", l.Addr().Network(), l.Addr())
+		go func(l net.Listener) {
+			if err := server.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				errCh <- err
+			}
+		}(l)
+	}
+
+	replayCtx, stopReplay := context.WithCancel(ctx)
+	replayDone := make(chan struct{})
+	go func() {
+		defer close(replayDone)
+		a.replay(replayCtx)
+	}()
+
+	var serveErr error
+	select {
+	case <-ctx.Done():
+	case serveErr = <-errCh:
+	}
+	stopReplay()
+	<-replayDone
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		a.logger.Printf("http shutdown: %v", err)
+	}
+	var shutdownErr *aiko.ShutdownError
+	if err := a.monitor.Shutdown(shutdownCtx); err != nil && !errors.As(err, &shutdownErr) {
+		a.logger.Printf("monitor shutdown: %v", err)
+	}
+	if err := a.spool.close(); err != nil {
+		a.logger.Printf("spool close: %v", err)
+	}
+	return serveErr
+}
@@ -0,0 +1,443 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	aiko "github.com/aikocorp/aiko-monitor-go/aiko"
+	testserver "github.com/aikocorp/aiko-monitor-go/tests/mockserver"
+)
+
+const (
+	testProjectKey = "pk_AAAAAAAAAAAAAAAAAAAAAA"
+	testSecretKey  = "BBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBB"
+)
+
+type runningAgent struct {
+	agent      *agent
+	socketPath string
+	httpAddr   string
+	stop       func()
+}
+
+func startAgent(t *testing.T, upstream string) *runningAgent {
+	t.Helper()
+	a, cfg := newTestAgent(t, upstream)
+	listeners, err := a.listen()
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = a.run(ctx, listeners, 5*time.Second)
+	}()
+	stop := func() {
+		cancel()
+		<-done
+	}
+	t.Cleanup(stop)
+	return &runningAgent{agent: a, socketPath: cfg.ListenUnix, httpAddr: listeners[1].Addr().String(), stop: stop}
+}
+
+func newTestAgent(t *testing.T, upstream string) (*agent, config) {
+	t.Helper()
+	dir, err := os.MkdirTemp("", "aiko-agent")
+	if err != nil {
+		t.Fatalf("temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+
+	cfg, err := loadConfig([]string{
+		"-listen-unix", filepath.Join(dir, "agent.sock"),
+		"-listen-http", "127.0.0.1:0",
+		"-project-key", testProjectKey,
+		"-secret-key", testSecretKey,
+		"-endpoints", upstream,
+		"-spool-dir", filepath.Join(dir, "spool"),
+		"-replay-interval", "100ms",
+	}, func(string) string { return "" }, io.Discard)
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	a, err := newAgent(cfg, log.New(io.Discard, "", 0))
+	if err != nil {
+		t.Fatalf("new agent: %v", err)
+	}
+	return a, cfg
+}
+
+func newAppMonitor(t *testing.T, endpoint string) *aiko.Monitor {
+	t.Helper()
+	monitor, err := aiko.New(aiko.Config{
+		ProjectKey:          testProjectKey,
+		SecretKey:           testSecretKey,
+		Endpoint:            endpoint,
+		AllowCustomEndpoint: true,
+	})
+	if err != nil {
+		t.Fatalf("init app monitor: %v", err)
+	}
+	t.Cleanup(func() { _ = monitor.Shutdown(context.Background()) })
+	return monitor
+}
+
+func fetchStats(t *testing.T, addr string) statsSnapshot {
+	t.Helper()
+	resp, err := http.Get("http://" + addr + "/stats")
+	if err != nil {
+		t.Fatalf("get stats: %v", err)
+	}
+	defer resp.Body.Close()
+	var stats statsSnapshot
+	if err := json.NewDecoder(resp.Body).Decode(&stats); err != nil {
+		t.Fatalf("decode stats: %v", err)
+	}
+	return stats
+}
+
+func TestAgentForwardsEventsFromUnixSocket(t *testing.T) {
+	upstream, err := testserver.StartMockServer(testSecretKey, testProjectKey)
+	if err != nil {
+		t.Fatalf("start upstream: %v", err)
+	}
+	defer upstream.Stop()
+
+	running := startAgent(t, upstream.Endpoint())
+	app := newAppMonitor(t, "unix://"+running.socketPath)
+	app.AddEvent(aiko.Event{
+		URL:            "/orders",
+		Endpoint:       "/orders",
+		Method:         "POST",
+		StatusCode:     201,
+		RequestHeaders: map[string]string{"x-forwarded-for": "203.0.113.7"},
+	})
+
+	evt, err := upstream.WaitForEvent(5 * time.Second)
+	if err != nil {
+		t.Fatalf("wait for forwarded event: %v", err)
+	}
+	if evt.Endpoint != "/orders" {
+		t.Fatalf("expected /orders, got %q", evt.Endpoint)
+	}
+	if got := upstream.LastRequestHeaders().Get("X-Client-IP"); got != "203.0.113.7" {
+		t.Fatalf("expected client IP to survive forwarding, got %q", got)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for fetchStats(t, running.httpAddr).Forwarded != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected forwarded=1, got %+v", fetchStats(t, running.httpAddr))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestAgentSpoolsFailedEventsAndReplaysThem(t *testing.T) {
+	upstream, err := testserver.StartMockServer(testSecretKey, testProjectKey)
+	if err != nil {
+		t.Fatalf("start upstream: %v", err)
+	}
+	defer upstream.Stop()
+	// fail every attempt of the first export so the batch is spooled
+	upstream.SetResponses([]int{http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusServiceUnavailable})
+
+	running := startAgent(t, upstream.Endpoint())
+	app := newAppMonitor(t, "http://"+running.httpAddr+"/api/ingest")
+	app.AddEvent(aiko.Event{URL: "/spooled", Endpoint: "/spooled", Method: "GET", StatusCode: 200})
+
+	evt, err := upstream.WaitForEvent(5 * time.Second)
+	if err != nil {
+		t.Fatalf("wait for replayed event: %v", err)
+	}
+	if evt.Endpoint != "/spooled" {
+		t.Fatalf("expected /spooled, got %q", evt.Endpoint)
+	}
+	stats := fetchStats(t, running.httpAddr)
+	if stats.Spooled != 1 || stats.Replayed < 1 {
+		t.Fatalf("expected event to be spooled and replayed, got %+v", stats)
+	}
+}
+
+func TestAgentDropsEventsUpstreamRejects(t *testing.T) {
+	upstream, err := testserver.StartMockServer(testSecretKey, testProjectKey)
+	if err != nil {
+		t.Fatalf("start upstream: %v", err)
+	}
+	defer upstream.Stop()
+	upstream.SetResponses([]int{http.StatusBadRequest})
+
+	running := startAgent(t, upstream.Endpoint())
+	app := newAppMonitor(t, "http://"+running.httpAddr+"/api/ingest")
+	app.AddEvent(aiko.Event{URL: "/rejected", Endpoint: "/rejected", Method: "GET", StatusCode: 200})
+
+	deadline := time.Now().Add(2 * time.Second)
+	for fetchStats(t, running.httpAddr).Dropped != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected dropped=1, got %+v", fetchStats(t, running.httpAddr))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(300 * time.Millisecond)
+	if stats := fetchStats(t, running.httpAddr); stats.Spooled != 0 || stats.Replayed != 0 {
+		t.Fatalf("expected a rejected event not to be spooled, got %+v", stats)
+	}
+	if attempts := upstream.Attempts(); len(attempts) != 1 {
+		t.Fatalf("expected a single upstream attempt, got %v", attempts)
+	}
+}
+
+func TestAgentKeepsSpoolFilesUntilEventsAreAccepted(t *testing.T) {
+	a, _ := newTestAgent(t, "http://127.0.0.1:1/api/ingest")
+	events := []aiko.Event{
+		{ID: "evt_1", Endpoint: "/a", Method: "GET"},
+		{ID: "evt_2", Endpoint: "/b", Method: "GET"},
+	}
+	if err := a.spool.write(events); err != nil {
+		t.Fatalf("write spool: %v", err)
+	}
+	// a stopped monitor accepts nothing, as a full queue would
+	_ = a.monitor.Shutdown(context.Background())
+
+	if err := a.replayOnce(context.Background()); !errors.Is(err, aiko.ErrMonitorClosed) {
+		t.Fatalf("expected replay to stop on a closed monitor, got %v", err)
+	}
+	files, err := a.spool.list()
+	if err != nil || len(files) != 1 {
+		t.Fatalf("expected the spool file to be kept, got %v (%v)", files, err)
+	}
+	kept, err := a.spool.read(files[0])
+	if err != nil || len(kept) != 2 || kept[0].ID != "evt_1" || kept[1].ID != "evt_2" {
+		t.Fatalf("expected both events to stay spooled, got %+v (%v)", kept, err)
+	}
+	if a.snapshot().Replayed != 0 {
+		t.Fatalf("nothing should count as replayed, got %+v", a.snapshot())
+	}
+}
+
+func TestSpoolKeepDropsAcceptedEvents(t *testing.T) {
+	sp, err := openSpool(t.TempDir(), 0)
+	if err != nil {
+		t.Fatalf("open spool: %v", err)
+	}
+	defer sp.close()
+	events := []aiko.Event{
+		aiko.Event{ID: "evt_1", Endpoint: "/a", Method: "GET"}.WithClientIP("203.0.113.7"),
+		aiko.Event{ID: "evt_2", Endpoint: "/b", Method: "GET"}.WithClientIP("203.0.113.8"),
+	}
+	if err := sp.write(events); err != nil {
+		t.Fatalf("write spool: %v", err)
+	}
+	files, err := sp.list()
+	if err != nil || len(files) != 1 {
+		t.Fatalf("expected one closed spool file, got %v (%v)", files, err)
+	}
+
+	if err := sp.keep(files[0], 1); err != nil {
+		t.Fatalf("keep: %v", err)
+	}
+	kept, err := sp.read(files[0])
+	if err != nil || len(kept) != 1 || kept[0].ID != "evt_2" || kept[0].ClientIP() != "203.0.113.8" {
+		t.Fatalf("expected only evt_2 to stay spooled, got %+v (%v)", kept, err)
+	}
+	if err := sp.keep(files[0], 1); err != nil {
+		t.Fatalf("keep: %v", err)
+	}
+	if files, err := sp.list(); err != nil || len(files) != 0 || sp.bytes() != 0 {
+		t.Fatalf("expected an empty spool, got %v (%v) with %d bytes", files, err, sp.bytes())
+	}
+}
+
+func TestSpoolRecoversFilesLeftByACrash(t *testing.T) {
+	dir := t.TempDir()
+	// an exporter that is never shut down leaves its active .tmp file behind
+	crashed, err := aiko.NewFileExporter(aiko.FileExporterConfig{Dir: dir, Prefix: spoolPrefix})
+	if err != nil {
+		t.Fatalf("new file exporter: %v", err)
+	}
+	if err := crashed.Export(context.Background(), []aiko.Event{{ID: "evt_crash", Endpoint: "/a", Method: "GET"}}); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, ".keep-123"), []byte("partial"), 0o600); err != nil {
+		t.Fatalf("write stale keep file: %v", err)
+	}
+
+	sp, err := openSpool(dir, 0)
+	if err != nil {
+		t.Fatalf("open spool: %v", err)
+	}
+	defer sp.close()
+	files, err := sp.list()
+	if err != nil || len(files) != 1 {
+		t.Fatalf("expected the leftover file to be finalized, got %v (%v)", files, err)
+	}
+	events, err := sp.read(files[0])
+	if err != nil || len(events) != 1 || events[0].ID != "evt_crash" {
+		t.Fatalf("expected the crashed write to be replayable, got %+v (%v)", events, err)
+	}
+	if sp.bytes() == 0 {
+		t.Fatal("expected the recovered file to count toward the spool size")
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if name := entry.Name(); strings.HasSuffix(name, ".tmp") || strings.HasPrefix(name, ".keep-") {
+			t.Fatalf("expected no leftover %s in the spool dir", name)
+		}
+	}
+}
+
+func TestAgentAnswers503WhenEventsCannotBeQueued(t *testing.T) {
+	a, _ := newTestAgent(t, "http://127.0.0.1:1/api/ingest")
+	_ = a.monitor.Shutdown(context.Background())
+	server := httptest.NewServer(a.handler())
+	defer server.Close()
+
+	secrets, err := aiko.NewStaticSecretProvider(aiko.SigningSecret{Secret: testSecretKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := secrets.SigningKey(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := aiko.NewIngestRequest(context.Background(), server.URL+"/api/ingest", testProjectKey, key,
+		aiko.Event{ID: "evt_lost", Endpoint: "/lost", Method: "GET", StatusCode: 200})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("post: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable || resp.Header.Get("Retry-After") == "" {
+		t.Fatalf("expected 503 with Retry-After, got %d %q", resp.StatusCode, resp.Header.Get("Retry-After"))
+	}
+	if stats := a.snapshot(); stats.Received != 0 || stats.Rejected != 1 {
+		t.Fatalf("expected the event to count as rejected, got %+v", stats)
+	}
+
+	// a resend of the same request must not pass as an accepted duplicate
+	resend := req.Clone(context.Background())
+	resend.Body, _ = req.GetBody()
+	resp, err = http.DefaultClient.Do(resend)
+	if err != nil {
+		t.Fatalf("resend: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("expected the resend to be refused too, got %d", resp.StatusCode)
+	}
+}
+
+func TestAgentAcceptsAResentRequestOnce(t *testing.T) {
+	a, _ := newTestAgent(t, "http://127.0.0.1:1/api/ingest")
+	server := httptest.NewServer(a.handler())
+	defer server.Close()
+
+	secrets, err := aiko.NewStaticSecretProvider(aiko.SigningSecret{Secret: testSecretKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := secrets.SigningKey(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := aiko.NewIngestRequest(context.Background(), server.URL+"/api/ingest", testProjectKey, key,
+		aiko.Event{ID: "evt_resent", Endpoint: "/resent", Method: "GET", StatusCode: 200})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// net/http resends the same headers and body when a keep-alive
+	// connection fails after the first copy was written
+	post := func(idempotencyKey string) int {
+		t.Helper()
+		resend := req.Clone(context.Background())
+		resend.Body, _ = req.GetBody()
+		resend.Header.Set(aiko.HeaderIdempotencyKey, idempotencyKey)
+		resp, err := http.DefaultClient.Do(resend)
+		if err != nil {
+			t.Fatalf("post: %v", err)
+		}
+		_ = resp.Body.Close()
+		return resp.StatusCode
+	}
+	for i := 0; i < 2; i++ {
+		if status := post("evt_resent"); status != http.StatusAccepted {
+			t.Fatalf("attempt %d: expected 202, got %d", i+1, status)
+		}
+	}
+	if status := post("evt_other"); status != http.StatusForbidden {
+		t.Fatalf("expected a replay under another key to be rejected, got %d", status)
+	}
+	if stats := a.snapshot(); stats.Received != 1 || stats.Rejected != 1 {
+		t.Fatalf("expected one event received and the replay rejected, got %+v", stats)
+	}
+}
+
+func TestAgentRejectsBadSignatures(t *testing.T) {
+	running := startAgent(t, "http://127.0.0.1:1/api/ingest")
+
+	req, err := http.NewRequest(http.MethodPost, "http://"+running.httpAddr+"/api/ingest", strings.NewReader("{}"))
+	if err != nil {
+		t.Fatalf("new request: %v", err)
+	}
+	req.Header.Set(aiko.HeaderProjectKey, testProjectKey)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("post: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected 403 for unsigned request, got %d", resp.StatusCode)
+	}
+
+	resp, err = http.Get("http://" + running.httpAddr + "/healthz")
+	if err != nil {
+		t.Fatalf("healthz: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected healthz 200, got %d", resp.StatusCode)
+	}
+	if stats := fetchStats(t, running.httpAddr); stats.Rejected != 1 {
+		t.Fatalf("expected rejected=1, got %+v", stats)
+	}
+}
+
+func TestLoadConfigLayersFileEnvAndFlags(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "agent.json")
+	raw := `{"listen_http":"127.0.0.1:7000","spool_dir":"/var/spool/a","secret_key":"` + testSecretKey + `","queue_size":10,"replay_interval":"5s"}`
+	if err := os.WriteFile(path, []byte(raw), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	env := map[string]string{"AIKO_AGENT_SPOOL_DIR": "/var/spool/b", "AIKO_AGENT_QUEUE_SIZE": "20"}
+	cfg, err := loadConfig([]string{"-config", path, "-queue-size", "30"}, func(k string) string { return env[k] }, io.Discard)
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	if cfg.SpoolDir != "/var/spool/b" || cfg.QueueSize != 30 || time.Duration(cfg.ReplayInterval) != 5*time.Second {
+		t.Fatalf("unexpected layering result: %+v", cfg)
+	}
+	if len(cfg.AcceptSecretKeys) != 1 || cfg.AcceptSecretKeys[0] != testSecretKey {
+		t.Fatalf("expected accept keys to default to secret key, got %v", cfg.AcceptSecretKeys)
+	}
+
+	if _, err := loadConfig([]string{"-listen-http", "0.0.0.0:7000", "-secret-key", testSecretKey, "-spool-dir", "/tmp/x"}, func(string) string { return "" }, io.Discard); err == nil {
+		t.Fatal("expected non-loopback listen address to be rejected")
+	}
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultSpoolMaxBytes  = 256 << 20
+	defaultReplayInterval = 30 * time.Second
+)
+
+// config is read from an optional JSON file, then AIKO_AGENT_* environment
+// variables, then command-line flags, each overriding the previous.
+type config struct {
+	ListenUnix string `json:"listen_unix"`
+	ListenHTTP string `json:"listen_http"`
+
+	// Downstream apps sign with these keys. They default to the upstream
+	// project key and secret key.
+	AcceptProjectKey string   `json:"accept_project_key"`
+	AcceptSecretKeys []string `json:"accept_secret_keys"`
+
+	ProjectKey string   `json:"project_key"`
+	SecretKey  string   `json:"secret_key"`
+	SecretFile string   `json:"secret_file"`
+	Endpoints  []string `json:"endpoints"`
+
+	SpoolDir       string   `json:"spool_dir"`
+	SpoolMaxBytes  int64    `json:"spool_max_bytes"`
+	ReplayInterval duration `json:"replay_interval"`
+
+	QueueSize          int  `json:"queue_size"`
+	MaxConcurrentSends int  `json:"max_concurrent_sends"`
+	Verbose            bool `json:"verbose"`
+}
+
+type duration time.Duration
+
+func (d *duration) UnmarshalJSON(raw []byte) error {
+	var text string
+	if err := json.Unmarshal(raw, &text); err != nil {
+		return fmt.Errorf("duration must be a string such as \"30s\": %w", err)
+	}
+	parsed, err := time.ParseDuration(text)
+	if err != nil {
+		return err
+	}
+	*d = duration(parsed)
+	return nil
+}
+
+func loadConfig(args []string, getenv func(string) string, stderr io.Writer) (config, error) {
+	cfg := config{
+		SpoolMaxBytes:  defaultSpoolMaxBytes,
+		ReplayInterval: duration(defaultReplayInterval),
+	}
+
+	fs := flag.NewFlagSet("aiko-agent", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	configFile := fs.String("config", getenv("AIKO_AGENT_CONFIG"), "path to a JSON config file")
+	listenUnix := fs.String("listen-unix", "", "unix socket to accept events on")
+	listenHTTP := fs.String("listen-http", "", "loopback host:port to accept events on")
+	acceptProjectKey := fs.String("accept-project-key", "", "project key local apps sign with")
+	acceptSecretKeys := fs.String("accept-secret-keys", "", "comma-separated secret keys local apps sign with")
+	projectKey := fs.String("project-key", "", "upstream project key")
+	secretKey := fs.String("secret-key", "", "upstream secret key")
+	secretFile := fs.String("secret-file", "", "file holding the upstream secret key(s), reloaded on change")
+	endpoints := fs.String("endpoints", "", "comma-separated upstream ingest endpoints in failover order")
+	spoolDir := fs.String("spool-dir", "", "directory for events that could not be forwarded")
+	spoolMaxBytes := fs.Int64("spool-max-bytes", 0, "maximum spool size in bytes")
+	replayInterval := fs.Duration("replay-interval", 0, "how often spooled events are retried")
+	queueSize := fs.Int("queue-size", 0, "forwarding queue size")
+	maxConcurrent := fs.Int("max-concurrent-sends", 0, "maximum concurrent upstream sends")
+	verbose := fs.Bool("verbose", false, "log every received and forwarded event")
+	if err := fs.Parse(args); err != nil {
+		return config{}, err
+	}
+
+	if *configFile != "" {
+		raw, err := os.ReadFile(*configFile)
+		if err != nil {
+			return config{}, fmt.Errorf("read config: %w", err)
+		}
+		decoder := json.NewDecoder(bytes.NewReader(raw))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&cfg); err != nil {
+			return config{}, fmt.Errorf("parse config %s: %w", *configFile, err)
+		}
+	}
+
+	if err := applyEnv(&cfg, getenv); err != nil {
+		return config{}, err
+	}
+
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	if set["listen-unix"] {
+		cfg.ListenUnix = *listenUnix
+	}
+	if set["listen-http"] {
+		cfg.ListenHTTP = *listenHTTP
+	}
+	if set["accept-project-key"] {
+		cfg.AcceptProjectKey = *acceptProjectKey
+	}
+	if set["accept-secret-keys"] {
+		cfg.AcceptSecretKeys = splitList(*acceptSecretKeys)
+	}
+	if set["project-key"] {
+		cfg.ProjectKey = *projectKey
+	}
+	if set["secret-key"] {
+		cfg.SecretKey = *secretKey
+	}
+	if set["secret-file"] {
+		cfg.SecretFile = *secretFile
+	}
+	if set["endpoints"] {
+		cfg.Endpoints = splitList(*endpoints)
+	}
+	if set["spool-dir"] {
+		cfg.SpoolDir = *spoolDir
+	}
+	if set["spool-max-bytes"] {
+		cfg.SpoolMaxBytes = *spoolMaxBytes
+	}
+	if set["replay-interval"] {
+		cfg.ReplayInterval = duration(*replayInterval)
+	}
+	if set["queue-size"] {
+		cfg.QueueSize = *queueSize
+	}
+	if set["max-concurrent-sends"] {
+		cfg.MaxConcurrentSends = *maxConcurrent
+	}
+	if set["verbose"] {
+		cfg.Verbose = *verbose
+	}
+
+	if cfg.AcceptProjectKey == "" {
+		cfg.AcceptProjectKey = cfg.ProjectKey
+	}
+	if len(cfg.AcceptSecretKeys) == 0 && cfg.SecretKey != "" {
+		cfg.AcceptSecretKeys = []string{cfg.SecretKey}
+	}
+	return cfg, cfg.validate()
+}
+
+func applyEnv(cfg *config, getenv func(string) string) error {
+	strs := map[string]*string{
+		"AIKO_AGENT_LISTEN_UNIX":        &cfg.ListenUnix,
+		"AIKO_AGENT_LISTEN_HTTP":        &cfg.ListenHTTP,
+		"AIKO_AGENT_ACCEPT_PROJECT_KEY": &cfg.AcceptProjectKey,
+		"AIKO_AGENT_PROJECT_KEY":        &cfg.ProjectKey,
+		"AIKO_AGENT_SECRET_KEY":         &cfg.SecretKey,
+		"AIKO_AGENT_SECRET_FILE":        &cfg.SecretFile,
+		"AIKO_AGENT_SPOOL_DIR":          &cfg.SpoolDir,
+	}
+	for name, dst := range strs {
+		if value := getenv(name); value != "" {
+			*dst = value
+		}
+	}
+	if value := getenv("AIKO_AGENT_ACCEPT_SECRET_KEYS"); value != "" {
+		cfg.AcceptSecretKeys = splitList(value)
+	}
+	if value := getenv("AIKO_AGENT_ENDPOINTS"); value != "" {
+		cfg.Endpoints = splitList(value)
+	}
+	ints := map[string]*int{
+		"AIKO_AGENT_QUEUE_SIZE":           &cfg.QueueSize,
+		"AIKO_AGENT_MAX_CONCURRENT_SENDS": &cfg.MaxConcurrentSends,
+	}
+	for name, dst := range ints {
+		if value := getenv(name); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			*dst = parsed
+		}
+	}
+	if value := getenv("AIKO_AGENT_SPOOL_MAX_BYTES"); value != "" {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("AIKO_AGENT_SPOOL_MAX_BYTES: %w", err)
+		}
+		cfg.SpoolMaxBytes = parsed
+	}
+	if value := getenv("AIKO_AGENT_REPLAY_INTERVAL"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("AIKO_AGENT_REPLAY_INTERVAL: %w", err)
+		}
+		cfg.ReplayInterval = duration(parsed)
+	}
+	if value := getenv("AIKO_AGENT_VERBOSE"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("AIKO_AGENT_VERBOSE: %w", err)
+		}
+		cfg.Verbose = parsed
+	}
+	return nil
+}
+
+func (c config) validate() error {
+	if c.ListenUnix == "" && c.ListenHTTP == "" {
+		return errors.New("one of listen-unix or listen-http is required")
+	}
+	if c.ListenHTTP != "" {
+		host, _, err := net.SplitHostPort(c.ListenHTTP)
+		if err != nil {
+			return fmt.Errorf("listen-http: %w", err)
+		}
+		if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+			return fmt.Errorf("listen-http must be a loopback address, got %q", c.ListenHTTP)
+		}
+	}
+	if c.SecretKey != "" && c.SecretFile != "" {
+		return errors.New("secret-key and secret-file cannot both be set")
+	}
+	if len(c.AcceptSecretKeys) == 0 {
+		return errors.New("accept-secret-keys is required unless secret-key is set")
+	}
+	if c.SpoolDir == "" {
+		return errors.New("spool-dir is required")
+	}
+	if c.ReplayInterval <= 0 {
+		return errors.New("replay-interval must be positive")
+	}
+	return nil
+}
+
+func splitList(value string) []string {
+	var out []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
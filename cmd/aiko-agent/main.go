@@ -0,0 +1,45 @@
+// Command aiko-agent accepts signed events from local processes over a unix
+// socket or loopback HTTP and forwards them upstream with its own
+// credentials, spooling to disk whatever cannot be delivered.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+const shutdownTimeout = 10 * time.Second
+
+func main() {
+	cfg, err := loadConfig(os.Args[1:], os.Getenv, os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "aiko-agent: %v\n", err)
+		os.Exit(2)
+	}
+
+	logger := log.New(os.Stderr, "[aiko-agent] ", log.LstdFlags)
+	a, err := newAgent(cfg, logger)
+	if err != nil {
+		logger.Fatalf("init: %v", err)
+	}
+	listeners, err := a.listen()
+	if err != nil {
+		logger.Fatalf("%v", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := a.run(ctx, listeners, shutdownTimeout); err != nil {
+		logger.Fatalf("serve: %v", err)
+	}
+}
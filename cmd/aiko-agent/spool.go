@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	aiko "github.com/aikocorp/aiko-monitor-go/aiko"
+)
+
+const (
+	spoolPrefix = "spool"
+	// spoolKeepPattern names the file a partly replayed spool file is
+	// rewritten to before it replaces the original.
+	spoolKeepPattern = ".keep-*"
+)
+
+// spool keeps events that could not be forwarded in files written by
+// aiko.FileExporter and reads them back with aiko.ReadEventFile. Every write
+// is rotated straight away, so each batch becomes its own closed file; .tmp
+// files a crash left behind are finalized by the exporter when the spool
+// opens.
+type spool struct {
+	dir      string
+	maxBytes int64
+	files    *aiko.FileExporter
+
+	mu sync.Mutex
+}
+
+func openSpool(dir string, maxBytes int64) (*spool, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("create spool dir: %w", err)
+	}
+	stale, err := filepath.Glob(filepath.Join(dir, spoolKeepPattern))
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range stale {
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("remove stale spool file: %w", err)
+		}
+	}
+	files, err := aiko.NewFileExporter(aiko.FileExporterConfig{
+		Dir:    dir,
+		Prefix: spoolPrefix,
+		// any write reaches the limit, so every batch is closed at once
+		MaxFileBytes: 1,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("open spool: %w", err)
+	}
+	return &spool{dir: dir, maxBytes: maxBytes, files: files}, nil
+}
+
+// write stores events, refusing new batches once the spool holds maxBytes.
+func (s *spool) write(events []aiko.Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.maxBytes > 0 {
+		if size := s.sizeLocked(); size >= s.maxBytes {
+			return fmt.Errorf("spool is full (%d bytes)", size)
+		}
+	}
+	if err := s.files.Export(context.Background(), events); err != nil {
+		return fmt.Errorf("write spool file: %w", err)
+	}
+	return nil
+}
+
+// read returns the events stored in one spool file.
+func (s *spool) read(path string) ([]aiko.Event, error) {
+	events, err := aiko.ReadEventFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read spool file: %w", err)
+	}
+	return events, nil
+}
+
+// keep drops the first accepted events from a spool file, or removes it when
+// none are left. The file keeps its name, so its events stay ahead of newer
+// ones.
+func (s *spool) keep(path string, accepted int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read spool file: %w", err)
+	}
+	// spool files are NDJSON, one event per line
+	for i := 0; i < accepted && len(raw) > 0; i++ {
+		end := bytes.IndexByte(raw, '\n')
+		if end < 0 {
+			raw = nil
+			break
+		}
+		raw = raw[end+1:]
+	}
+	if len(raw) == 0 {
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("remove spool file: %w", err)
+		}
+		return nil
+	}
+
+	tmp, err := os.CreateTemp(s.dir, spoolKeepPattern)
+	if err != nil {
+		return fmt.Errorf("write spool file: %w", err)
+	}
+	_, writeErr := tmp.Write(raw)
+	syncErr := tmp.Sync()
+	if err := errors.Join(writeErr, syncErr, tmp.Close()); err != nil {
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("write spool file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("finalize spool file: %w", err)
+	}
+	return nil
+}
+
+// list returns the closed spool files, oldest first.
+func (s *spool) list() ([]string, error) {
+	files, err := s.files.ClosedFiles()
+	if err != nil {
+		return nil, fmt.Errorf("read spool dir: %w", err)
+	}
+	return files, nil
+}
+
+func (s *spool) bytes() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sizeLocked()
+}
+
+func (s *spool) sizeLocked() int64 {
+	files, err := s.files.ClosedFiles()
+	if err != nil {
+		return 0
+	}
+	var size int64
+	for _, path := range files {
+		if info, err := os.Stat(path); err == nil {
+			size += info.Size()
+		}
+	}
+	return size
+}
+
+// close stops the underlying exporter once nothing more will be spooled.
+func (s *spool) close() error {
+	return s.files.Shutdown(context.Background())
+}
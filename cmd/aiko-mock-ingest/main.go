@@ -0,0 +1,145 @@
+// Command aiko-mock-ingest runs a local ingest endpoint that verifies AIKO
+// request signatures, prints received events and can inject faults to
+// exercise retry and spool settings.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	aiko "github.com/aikocorp/aiko-monitor-go/aiko"
+)
+
+func main() {
+	srv, addr, err := parseFlags(os.Args[1:], os.Stdout, os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "aiko-mock-ingest: %v\n", err)
+		os.Exit(2)
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "aiko-mock-ingest: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Fprintf(os.Stderr, "aiko-mock-ingest listening on http://%s/api/ingest\n", listener.Addr())
+
+	httpServer := &http.Server{Handler: srv, ReadHeaderTimeout: 10 * time.Second}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = httpServer.Shutdown(shutdownCtx)
+	}()
+	if err := httpServer.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		fmt.Fprintf(os.Stderr, "aiko-mock-ingest: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func parseFlags(args []string, stdout, stderr io.Writer) (*server, string, error) {
+	fs := flag.NewFlagSet("aiko-mock-ingest", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	addr := fs.String("addr", "127.0.0.1:8787", "loopback host:port to listen on")
+	projectKey := fs.String("project-key", os.Getenv("AIKO_PROJECT_KEY"), "project key clients must send")
+	secretKeys := fs.String("secret-keys", os.Getenv("AIKO_SECRET_KEY"), "comma-separated accepted secret keys")
+	format := fs.String("format", "pretty", "output format: pretty or ndjson")
+	script := fs.String("script", "", "response sequence for correctly signed requests, e.g. 500,500,reset,429,202; afterwards 202")
+	loop := fs.Bool("loop", false, "repeat -script instead of falling back to 202")
+	latency := fs.String("latency", "", "fixed latency (200ms) or random range (50ms-500ms)")
+	retryAfter := fs.String("retry-after", "1", "Retry-After value sent with 429 responses")
+	resetRate := fs.Float64("reset-rate", 0, "probability (0-1) of resetting a connection")
+	drip := fs.Duration("drip", 0, "delay between response body bytes")
+	seed := fs.Int64("seed", time.Now().UnixNano(), "random seed for latency and resets")
+	if err := fs.Parse(args); err != nil {
+		return nil, "", err
+	}
+
+	host, _, err := net.SplitHostPort(*addr)
+	if err != nil {
+		return nil, "", fmt.Errorf("addr: %w", err)
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return nil, "", fmt.Errorf("addr must be a loopback address, got %q", *addr)
+	}
+	if *format != "pretty" && *format != "ndjson" {
+		return nil, "", fmt.Errorf("format must be pretty or ndjson, got %q", *format)
+	}
+	if *resetRate < 0 || *resetRate > 1 {
+		return nil, "", errors.New("reset-rate must be between 0 and 1")
+	}
+
+	var keys []string
+	for _, key := range strings.Split(*secretKeys, ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	verifier, err := aiko.NewSignatureVerifier(*projectKey, aiko.DefaultSignatureSkew, keys...)
+	if err != nil {
+		return nil, "", fmt.Errorf("secret-keys: %w", err)
+	}
+
+	steps, err := parseScript(*script)
+	if err != nil {
+		return nil, "", err
+	}
+	minLatency, maxLatency, err := parseLatency(*latency)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return &server{
+		verifier: verifier,
+		out:      stdout,
+		format:   *format,
+		rnd:      rand.New(rand.NewSource(*seed)),
+		faults: faults{
+			Script:     steps,
+			Loop:       *loop,
+			LatencyMin: minLatency,
+			LatencyMax: maxLatency,
+			RetryAfter: *retryAfter,
+			ResetRate:  *resetRate,
+			DripDelay:  *drip,
+		},
+	}, *addr, nil
+}
+
+func parseLatency(value string) (time.Duration, time.Duration, error) {
+	if value == "" {
+		return 0, 0, nil
+	}
+	lo, hi, isRange := strings.Cut(value, "-")
+	minLatency, err := time.ParseDuration(strings.TrimSpace(lo))
+	if err != nil {
+		return 0, 0, fmt.Errorf("latency: %w", err)
+	}
+	if !isRange {
+		return minLatency, minLatency, nil
+	}
+	maxLatency, err := time.ParseDuration(strings.TrimSpace(hi))
+	if err != nil {
+		return 0, 0, fmt.Errorf("latency: %w", err)
+	}
+	if maxLatency < minLatency {
+		return 0, 0, errors.New("latency range must be low-high")
+	}
+	return minLatency, maxLatency, nil
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	aiko "github.com/aikocorp/aiko-monitor-go/aiko"
+)
+
+// step is one scripted response. Exactly one of status or reset is set.
+type step struct {
+	status int
+	reset  bool
+}
+
+// parseScript parses a comma-separated response sequence such as
+// "500,500,reset,429,202". Each entry is an HTTP status code or "reset".
+func parseScript(value string) ([]step, error) {
+	var steps []step
+	for _, token := range strings.Split(value, ",") {
+		token = strings.TrimSpace(token)
+		switch {
+		case token == "":
+			continue
+		case strings.EqualFold(token, "reset"):
+			steps = append(steps, step{reset: true})
+		default:
+			status, err := strconv.Atoi(token)
+			if err != nil || status < 100 || status > 599 {
+				return nil, fmt.Errorf("invalid script entry %q: want a status code or reset", token)
+			}
+			steps = append(steps, step{status: status})
+		}
+	}
+	return steps, nil
+}
+
+type faults struct {
+	Script     []step
+	Loop       bool
+	LatencyMin time.Duration
+	LatencyMax time.Duration
+	RetryAfter string
+	ResetRate  float64
+	DripDelay  time.Duration
+}
+
+type server struct {
+	verifier *aiko.SignatureVerifier
+	faults   faults
+	out      io.Writer
+	format   string
+
+	mu       sync.Mutex
+	rnd      *rand.Rand
+	next     int
+	requests int
+}
+
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.URL.Path != "/api/ingest" {
+		http.NotFound(w, r)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	requestID := s.requestID()
+	// faults apply only to requests that pass verification, so a script
+	// describes exactly what a correctly signed client sees. The nonce is
+	// spent only on a 2xx answer, so the net/http resend that follows a reset
+	// or a scripted error runs through the script again.
+	if err := s.verifier.Check(r.Header, body); errors.Is(err, aiko.ErrSignatureDuplicate) {
+		s.logf("duplicate request_id=%s", requestID)
+		s.respond(w, http.StatusAccepted, requestID, map[string]string{"request_id": requestID})
+		return
+	} else if err != nil {
+		status := http.StatusForbidden
+		if errors.Is(err, aiko.ErrProjectKeyMismatch) {
+			status = http.StatusUnauthorized
+		}
+		s.logf("rejected request_id=%s error=%q", requestID, err)
+		s.respond(w, status, requestID, map[string]string{"error": err.Error()})
+		return
+	}
+	evt, err := aiko.DecodeGzipEvent(body)
+	if err != nil {
+		s.respond(w, http.StatusBadRequest, requestID, map[string]string{"error": "invalid event payload"})
+		return
+	}
+
+	step, delay := s.plan()
+	if delay > 0 {
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return
+		}
+	}
+	if step.reset {
+		resetConnection(w)
+		return
+	}
+
+	status := step.status
+	if status == 0 {
+		status = http.StatusAccepted
+	}
+	if status >= 200 && status < 300 {
+		s.verifier.Commit(r.Header)
+		s.print(evt.WithClientIP(r.Header.Get("X-Client-IP")))
+	} else {
+		s.logf("fault request_id=%s event_id=%s status=%d", requestID, evt.ID, status)
+	}
+	if status == http.StatusTooManyRequests && s.faults.RetryAfter != "" {
+		w.Header().Set("Retry-After", s.faults.RetryAfter)
+	}
+	s.respond(w, status, requestID, map[string]string{"request_id": requestID})
+}
+
+func (s *server) requestID() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests++
+	return fmt.Sprintf("mock_%d", s.requests)
+}
+
+// plan picks the scripted step and latency for the next verified request.
+func (s *server) plan() (step, time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var next step
+	if n := len(s.faults.Script); n > 0 {
+		if s.next < n {
+			next = s.faults.Script[s.next]
+			s.next++
+			if s.faults.Loop && s.next == n {
+				s.next = 0
+			}
+		}
+	}
+	if !next.reset && s.faults.ResetRate > 0 && s.rnd.Float64() < s.faults.ResetRate {
+		next = step{reset: true}
+	}
+
+	delay := s.faults.LatencyMin
+	if spread := s.faults.LatencyMax - s.faults.LatencyMin; spread > 0 {
+		delay += time.Duration(s.rnd.Int63n(int64(spread)))
+	}
+	return next, delay
+}
+
+func (s *server) respond(w http.ResponseWriter, status int, requestID string, payload any) {
+	raw, _ := json.Marshal(payload)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Request-Id", requestID)
+	if s.faults.DripDelay <= 0 {
+		w.WriteHeader(status)
+		_, _ = w.Write(raw)
+		return
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(raw)))
+	w.WriteHeader(status)
+	flusher, _ := w.(http.Flusher)
+	for _, b := range raw {
+		if _, err := w.Write([]byte{b}); err != nil {
+			return
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		time.Sleep(s.faults.DripDelay)
+	}
+}
+
+// resetConnection closes the client connection with SO_LINGER 0 so the peer
+// sees ECONNRESET instead of a clean EOF.
+func resetConnection(w http.ResponseWriter) {
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	conn, _, err := hijacker.Hijack()
+	if err != nil {
+		return
+	}
+	if tcp, ok := conn.(*net.TCPConn); ok {
+		_ = tcp.SetLinger(0)
+	}
+	_ = conn.Close()
+}
+
+func (s *server) print(evt aiko.Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.format == "ndjson" {
+		_ = json.NewEncoder(s.out).Encode(evt)
+		return
+	}
+	fmt.Fprintf(s.out, "%s %s %s -> %d (%dms) id=%s", evt.Timestamp, evt.Method, evt.Endpoint, evt.StatusCode, evt.DurationMS, evt.ID)
+	if ip := evt.ClientIP(); ip != "" {
+		fmt.Fprintf(s.out, " client_ip=%s", ip)
+	}
+	if evt.Actor != nil && evt.Actor.ID != "" {
+		fmt.Fprintf(s.out, " actor=%s", evt.Actor.ID)
+	}
+	fmt.Fprintln(s.out)
+	pretty, err := json.MarshalIndent(evt, "  ", "  ")
+	if err == nil {
+		fmt.Fprintf(s.out, "  %s\n", pretty)
+	}
+}
+
+func (s *server) logf(format string, args ...any) {
+	if s.format == "ndjson" {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fmt.Fprintf(s.out, format+"\n", args...)
+}
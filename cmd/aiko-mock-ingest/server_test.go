@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	aiko "github.com/aikocorp/aiko-monitor-go/aiko"
+)
+
+const (
+	testProjectKey = "pk_AAAAAAAAAAAAAAAAAAAAAA"
+	testSecretKey  = "BBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBB"
+)
+
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func startMock(t *testing.T, out io.Writer, args ...string) *httptest.Server {
+	t.Helper()
+	args = append([]string{"-project-key", testProjectKey, "-secret-keys", testSecretKey, "-seed", "1"}, args...)
+	srv, _, err := parseFlags(args, out, io.Discard)
+	if err != nil {
+		t.Fatalf("parse flags: %v", err)
+	}
+	ts := httptest.NewServer(srv)
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func signedRequest(t *testing.T, url string) *http.Request {
+	t.Helper()
+	payload, err := aiko.GzipEvent(aiko.Event{ID: "evt_1", URL: "/x", Endpoint: "/x", Method: "GET", StatusCode: 200})
+	if err != nil {
+		t.Fatalf("gzip event: %v", err)
+	}
+	secret, _ := base64.RawURLEncoding.DecodeString(testSecretKey)
+	req, err := http.NewRequest(http.MethodPost, url+"/api/ingest", bytes.NewReader(payload))
+	if err != nil {
+		t.Fatalf("new request: %v", err)
+	}
+	req.Header.Set(aiko.HeaderProjectKey, testProjectKey)
+	aiko.SignRequest(secret, aiko.SecretKeyID(secret), testProjectKey, payload, time.Now()).Apply(req.Header)
+	return req
+}
+
+func TestMockIngestRetriesThroughScriptAndDumpsNDJSON(t *testing.T) {
+	var out lockedBuffer
+	ts := startMock(t, &out, "-format", "ndjson", "-script", "500,503")
+
+	monitor, err := aiko.New(aiko.Config{
+		ProjectKey: testProjectKey,
+		SecretKey:  testSecretKey,
+		Endpoint:   ts.URL + "/api/ingest",
+	})
+	if err != nil {
+		t.Fatalf("init monitor: %v", err)
+	}
+	monitor.AddEvent(aiko.Event{URL: "/scripted", Endpoint: "/scripted", Method: "GET", StatusCode: 200})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := monitor.Shutdown(ctx); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("expected one NDJSON line after two scripted failures, got %q", out.String())
+	}
+	var evt aiko.Event
+	if err := json.Unmarshal([]byte(lines[0]), &evt); err != nil || evt.Endpoint != "/scripted" {
+		t.Fatalf("expected /scripted event, got %q (%v)", lines[0], err)
+	}
+}
+
+func TestMockIngestFaults(t *testing.T) {
+	ts := startMock(t, io.Discard, "-script", "429,reset,202", "-retry-after", "7", "-drip", "1ms")
+
+	resp, err := http.DefaultClient.Do(signedRequest(t, ts.URL))
+	if err != nil {
+		t.Fatalf("first request: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get("Retry-After") != "7" {
+		t.Fatalf("expected 429 with Retry-After 7, got %d %q", resp.StatusCode, resp.Header.Get("Retry-After"))
+	}
+
+	if resp, err := http.DefaultClient.Do(signedRequest(t, ts.URL)); err == nil {
+		_ = resp.Body.Close()
+		t.Fatalf("expected connection reset, got status %d", resp.StatusCode)
+	}
+
+	resp, err = http.DefaultClient.Do(signedRequest(t, ts.URL))
+	if err != nil {
+		t.Fatalf("third request: %v", err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil || resp.StatusCode != http.StatusAccepted || !strings.Contains(string(body), "mock_3") {
+		t.Fatalf("expected dripped 202 body, got %d %q (%v)", resp.StatusCode, body, err)
+	}
+}
+
+func TestMockIngestRejectsBadSignature(t *testing.T) {
+	var out lockedBuffer
+	ts := startMock(t, &out)
+	req := signedRequest(t, ts.URL)
+	req.Header.Set(aiko.HeaderSignature, "00")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d", resp.StatusCode)
+	}
+	if !strings.Contains(out.String(), "rejected") {
+		t.Fatalf("expected rejection to be printed, got %q", out.String())
+	}
+}
+
+func TestMockIngestResetOnAWarmConnectionIsRetried(t *testing.T) {
+	var out lockedBuffer
+	srv, _, err := parseFlags([]string{"-project-key", testProjectKey, "-secret-keys", testSecretKey, "-format", "ndjson", "-script", "202,reset"}, &out, io.Discard)
+	if err != nil {
+		t.Fatalf("parse flags: %v", err)
+	}
+	ts := httptest.NewServer(srv)
+	t.Cleanup(ts.Close)
+
+	monitor, err := aiko.New(aiko.Config{
+		ProjectKey: testProjectKey,
+		SecretKey:  testSecretKey,
+		Endpoint:   ts.URL + "/api/ingest",
+	})
+	if err != nil {
+		t.Fatalf("init monitor: %v", err)
+	}
+	monitor.AddEvent(aiko.Event{URL: "/warm", Endpoint: "/warm", Method: "GET", StatusCode: 200})
+	deadline := time.Now().Add(5 * time.Second)
+	for !strings.Contains(out.String(), "/warm") && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	// the second event goes out on the kept-alive connection and is reset
+	monitor.AddEvent(aiko.Event{URL: "/reset", Endpoint: "/reset", Method: "GET", StatusCode: 200})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := monitor.Shutdown(ctx); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+
+	if !strings.Contains(out.String(), "/reset") {
+		t.Fatalf("expected the reset event to be retried and dumped, got %q", out.String())
+	}
+	srv.mu.Lock()
+	requests := srv.requests
+	srv.mu.Unlock()
+	if requests != 3 {
+		t.Fatalf("expected the reset request to be sent again, got %d requests", requests)
+	}
+}
+
+func TestMockIngestScriptSkipsRejectedRequests(t *testing.T) {
+	ts := startMock(t, io.Discard, "-script", "500,202")
+
+	bad := signedRequest(t, ts.URL)
+	bad.Header.Set(aiko.HeaderSignature, "00")
+	for i, req := range []*http.Request{bad, signedRequest(t, ts.URL), signedRequest(t, ts.URL)} {
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("request %d: %v", i+1, err)
+		}
+		_ = resp.Body.Close()
+		if want := []int{http.StatusForbidden, http.StatusInternalServerError, http.StatusAccepted}[i]; resp.StatusCode != want {
+			t.Fatalf("request %d: expected %d, got %d", i+1, want, resp.StatusCode)
+		}
+	}
+}
+
+func TestParseFlagsValidation(t *testing.T) {
+	cases := [][]string{
+		{"-addr", "0.0.0.0:8787"},
+		{"-script", "500,boom"},
+		{"-latency", "500ms-50ms"},
+		{"-format", "xml"},
+	}
+	for _, args := range cases {
+		args = append(args, "-secret-keys", testSecretKey)
+		if _, _, err := parseFlags(args, io.Discard, io.Discard); err == nil {
+			t.Fatalf("expected %v to be rejected", args)
+		}
+	}
+}
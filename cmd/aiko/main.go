@@ -0,0 +1,40 @@
+// Command aiko is a helper for applications using the AIKO SDK.
+//
+//	aiko verify [flags]
+//
+// checks the configuration, sends a signed test event to the ingest endpoint
+// and explains how a sample token maps onto the configured actor claims.
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+const usage = `usage: aiko <command> [flags]
+
+commands:
+  verify    check configuration, ingest connectivity and actor claims
+`
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return 2
+	}
+	switch args[0] {
+	case "verify":
+		return runVerify(args[1:], stdout, stderr)
+	case "help", "-h", "-help", "--help":
+		fmt.Fprint(stdout, usage)
+		return 0
+	default:
+		fmt.Fprintf(stderr, "aiko: unknown command %q\n\n%s", args[0], usage)
+		return 2
+	}
+}
@@ -0,0 +1,449 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	aiko "github.com/aikocorp/aiko-monitor-go/aiko"
+)
+
+type verifyOptions struct {
+	cfg     aiko.Config
+	sample  string
+	timeout time.Duration
+}
+
+func parseVerifyFlags(args []string, stderr io.Writer) (verifyOptions, error) {
+	// flags default to what NewFromEnv would read, so verify checks the
+	// config the application actually runs with
+	env, err := aiko.ConfigFromEnv()
+	if err != nil {
+		return verifyOptions{}, err
+	}
+	var header, cookie string
+	var extract aiko.ActorTokenExtractConfig
+	if h := env.Actor.Token.Header; h != nil {
+		header, extract = h.Name, h.Extract
+	}
+	if c := env.Actor.Token.Cookie; c != nil {
+		cookie, extract = c.Name, c.Extract
+	}
+
+	fs := flag.NewFlagSet("aiko verify", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	projectKey := fs.String("project-key", env.ProjectKey, "project key (AIKO_PROJECT_KEY)")
+	secretKey := fs.String("secret-key", env.SecretKey, "secret key (AIKO_SECRET_KEY)")
+	endpoint := fs.String("endpoint", env.Endpoint, "ingest endpoint (AIKO_ENDPOINT), defaults to the AIKO cloud")
+	endpoints := fs.String("endpoints", strings.Join(env.Endpoints, ","), "comma-separated ingest endpoints in failover order (AIKO_ENDPOINTS)")
+	allowCustom := fs.Bool("allow-custom-endpoint", env.AllowCustomEndpoint, "accept a self-hosted endpoint (AIKO_ALLOW_CUSTOM_ENDPOINT)")
+	provider := fs.String("actor-provider", string(env.Actor.Provider), "actor provider: jwt or supabase (AIKO_ACTOR_PROVIDER)")
+	fs.StringVar(&header, "actor-header", header, "header carrying the actor token (AIKO_ACTOR_HEADER)")
+	fs.StringVar(&cookie, "actor-cookie", cookie, "cookie carrying the actor token (AIKO_ACTOR_COOKIE)")
+	fs.Func("actor-extract", "token extractor: bearer, raw or json:<path> (AIKO_ACTOR_EXTRACT)", func(value string) error {
+		parsed, err := aiko.ParseActorTokenExtract(strings.TrimSpace(value))
+		if err != nil {
+			return err
+		}
+		extract = parsed
+		return nil
+	})
+	claimID := fs.String("claim-id", env.Actor.Claims.ID, "claim path for the actor id (AIKO_ACTOR_CLAIM_ID)")
+	claimEmail := fs.String("claim-email", env.Actor.Claims.Email, "claim path for the actor email (AIKO_ACTOR_CLAIM_EMAIL)")
+	claimOrgID := fs.String("claim-org-id", env.Actor.Claims.OrgID, "claim path for the actor org id (AIKO_ACTOR_CLAIM_ORG_ID)")
+	caFile := fs.String("ca-file", "", "PEM bundle trusted in addition to the system roots")
+	clientCert := fs.String("client-cert", "", "client certificate for mTLS")
+	clientKey := fs.String("client-key", "", "client key for mTLS")
+	proxyURL := fs.String("proxy-url", "", "http, https or socks5 proxy for the ingest connection")
+	noProxy := fs.String("no-proxy", "", "hosts that bypass -proxy-url, as in NO_PROXY")
+	pins := fs.String("pin-spki", "", "comma-separated sha256/ SPKI pins for the ingest certificate chain")
+	sample := fs.String("sample", "", "sample header or cookie value to resolve the actor from")
+	timeout := fs.Duration("timeout", 10*time.Second, "timeout for the test event")
+	if err := fs.Parse(args); err != nil {
+		return verifyOptions{}, err
+	}
+	if fs.NArg() > 0 {
+		return verifyOptions{}, fmt.Errorf("unexpected arguments %q", fs.Args())
+	}
+	// a flag given on the command line replaces its env counterpart as a
+	// whole, so -endpoint drops AIKO_ENDPOINTS and -actor-cookie drops
+	// AIKO_ACTOR_HEADER instead of failing validation with both set
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	if set["endpoint"] && !set["endpoints"] {
+		*endpoints = ""
+	}
+	if set["endpoints"] && !set["endpoint"] {
+		*endpoint = ""
+	}
+	if set["actor-header"] && !set["actor-cookie"] {
+		cookie = ""
+	}
+	if set["actor-cookie"] && !set["actor-header"] {
+		header = ""
+	}
+
+	actor := aiko.ActorConfig{
+		Provider: aiko.ActorProvider(*provider),
+		Claims:   aiko.ActorClaimsConfig{ID: *claimID, Email: *claimEmail, OrgID: *claimOrgID},
+	}
+	if header != "" {
+		actor.Token.Header = &aiko.ActorHeaderTokenConfig{Name: header, Extract: extract}
+	}
+	if cookie != "" {
+		actor.Token.Cookie = &aiko.ActorCookieTokenConfig{Name: cookie, Extract: extract}
+	}
+
+	return verifyOptions{
+		cfg: aiko.Config{
+			ProjectKey:          strings.TrimSpace(*projectKey),
+			SecretKey:           strings.TrimSpace(*secretKey),
+			Endpoint:            strings.TrimSpace(*endpoint),
+			Endpoints:           splitList(*endpoints),
+			AllowCustomEndpoint: *allowCustom,
+			Actor:               actor,
+			Transport: aiko.TransportConfig{
+				CAFile:           *caFile,
+				ClientCertFile:   *clientCert,
+				ClientKeyFile:    *clientKey,
+				ProxyURL:         *proxyURL,
+				NoProxy:          *noProxy,
+				PinnedSPKISHA256: splitList(*pins),
+			},
+		},
+		sample:  *sample,
+		timeout: *timeout,
+	}, nil
+}
+
+func splitList(value string) []string {
+	var out []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+func runVerify(args []string, stdout, stderr io.Writer) int {
+	opts, err := parseVerifyFlags(args, stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "aiko verify: %v\n", err)
+		return 2
+	}
+
+	r := &report{out: stdout}
+	if checkConfig(r, opts.cfg) {
+		checkIngest(r, opts)
+	}
+	checkActor(r, opts.cfg.Actor, opts.sample)
+	if r.failed {
+		fmt.Fprintln(stdout, "\nverification failed")
+		return 1
+	}
+	fmt.Fprintln(stdout, "\nall checks passed")
+	return 0
+}
+
+type report struct {
+	out    io.Writer
+	failed bool
+}
+
+func (r *report) ok(check, format string, args ...any) {
+	fmt.Fprintf(r.out, "ok    %-8s %s\n", check, fmt.Sprintf(format, args...))
+}
+
+func (r *report) skip(check, format string, args ...any) {
+	fmt.Fprintf(r.out, "skip  %-8s %s\n", check, fmt.Sprintf(format, args...))
+}
+
+func (r *report) fail(check, hint, format string, args ...any) {
+	r.failed = true
+	fmt.Fprintf(r.out, "FAIL  %-8s %s\n", check, fmt.Sprintf(format, args...))
+	if hint != "" {
+		fmt.Fprintf(r.out, "      %-8s hint: %s\n", "", hint)
+	}
+}
+
+func checkConfig(r *report, cfg aiko.Config) bool {
+	// NewIngestExporter runs the same validation as aiko.New, including the
+	// custom endpoint rules, without starting a monitor.
+	if _, err := aiko.NewIngestExporter(cfg); err != nil {
+		r.fail("config", configHint(err), "%v", err)
+		return false
+	}
+	r.ok("config", "project_key=%s endpoint=%s", aiko.MaskProjectKey(cfg.ProjectKey), strings.Join(verifyEndpoints(cfg), ","))
+	return true
+}
+
+// verifyEndpoints lists the endpoints the SDK would send to, in failover
+// order.
+func verifyEndpoints(cfg aiko.Config) []string {
+	switch {
+	case len(cfg.Endpoints) > 0:
+		return cfg.Endpoints
+	case cfg.Endpoint != "":
+		return []string{cfg.Endpoint}
+	}
+	return []string{aiko.DefaultEndpoint}
+}
+
+func configHint(err error) string {
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "projectKey"):
+		return "set -project-key or AIKO_PROJECT_KEY to the project key shown in the AIKO dashboard"
+	case strings.Contains(msg, "secretKey"):
+		return "set -secret-key or AIKO_SECRET_KEY to the project's 43-character secret key"
+	case strings.Contains(msg, "AllowCustomEndpoint"):
+		return "leave -endpoint empty for the AIKO cloud, or pass -allow-custom-endpoint for a self-hosted ingest"
+	case strings.Contains(msg, "endpoint"):
+		return "custom endpoints must be https, loopback http or unix:///absolute/path"
+	}
+	return ""
+}
+
+// timings records the phases of one request. Trace callbacks can run on the
+// dialing goroutine, hence the lock.
+type timings struct {
+	mu                                  sync.Mutex
+	start                               time.Time
+	dnsStart, connectStart, tlsStart    time.Time
+	dns, connect, tls, firstByte, total time.Duration
+}
+
+func (t *timings) trace() *httptrace.ClientTrace {
+	mark := func(at *time.Time) {
+		t.mu.Lock()
+		*at = time.Now()
+		t.mu.Unlock()
+	}
+	since := func(from *time.Time, into *time.Duration) {
+		t.mu.Lock()
+		*into = time.Since(*from)
+		t.mu.Unlock()
+	}
+	return &httptrace.ClientTrace{
+		DNSStart:             func(httptrace.DNSStartInfo) { mark(&t.dnsStart) },
+		DNSDone:              func(httptrace.DNSDoneInfo) { since(&t.dnsStart, &t.dns) },
+		ConnectStart:         func(string, string) { mark(&t.connectStart) },
+		ConnectDone:          func(string, string, error) { since(&t.connectStart, &t.connect) },
+		TLSHandshakeStart:    func() { mark(&t.tlsStart) },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { since(&t.tlsStart, &t.tls) },
+		GotFirstResponseByte: func() { since(&t.start, &t.firstByte) },
+	}
+}
+
+func (t *timings) String() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	parts := []string{}
+	for _, phase := range []struct {
+		name string
+		d    time.Duration
+	}{
+		{"dns", t.dns}, {"connect", t.connect}, {"tls", t.tls}, {"first_byte", t.firstByte}, {"total", t.total},
+	} {
+		if phase.d > 0 {
+			parts = append(parts, fmt.Sprintf("%s=%dms", phase.name, phase.d.Milliseconds()))
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+func checkIngest(r *report, opts verifyOptions) {
+	ctx, cancel := context.WithTimeout(context.Background(), opts.timeout)
+	defer cancel()
+
+	secrets, err := aiko.NewStaticSecretProvider(aiko.SigningSecret{Secret: opts.cfg.SecretKey})
+	if err != nil {
+		r.fail("ingest", "", "%v", err)
+		return
+	}
+	key, err := secrets.SigningKey(ctx)
+	if err != nil {
+		r.fail("ingest", "", "%v", err)
+		return
+	}
+
+	// every endpoint gets its own test event, since failover only helps if
+	// each of them accepts the project
+	for _, endpoint := range verifyEndpoints(opts.cfg) {
+		checkEndpoint(r, opts, key, endpoint)
+	}
+}
+
+func checkEndpoint(r *report, opts verifyOptions, key aiko.SigningKey, endpoint string) {
+	ctx, cancel := context.WithTimeout(context.Background(), opts.timeout)
+	defer cancel()
+
+	target, client, err := verifyClient(endpoint, opts.cfg.Transport, opts.timeout)
+	if err != nil {
+		r.fail("ingest", "", "endpoint=%s %v", endpoint, err)
+		return
+	}
+	now := time.Now().UTC()
+	evt := aiko.Event{
+		ID:              fmt.Sprintf("evt_verify_%d", now.UnixNano()),
+		URL:             "/aiko/verify",
+		Endpoint:        "/aiko/verify",
+		Method:          "GET",
+		StatusCode:      http.StatusOK,
+		RequestHeaders:  map[string]string{"user-agent": "aiko-verify"},
+		ResponseHeaders: map[string]string{},
+		Timestamp:       now.Format(time.RFC3339Nano),
+	}
+
+	t := &timings{}
+	req, err := aiko.NewIngestRequest(httptrace.WithClientTrace(ctx, t.trace()), target, opts.cfg.ProjectKey, key, evt)
+	if err != nil {
+		r.fail("ingest", "", "endpoint=%s build test event: %v", endpoint, err)
+		return
+	}
+	t.start = time.Now()
+	resp, err := client.Do(req)
+	t.total = time.Since(t.start)
+	if err != nil {
+		r.fail("ingest", networkHint(err, endpoint, opts.timeout), "endpoint=%s %v", endpoint, err)
+		return
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	_ = resp.Body.Close()
+
+	requestID := resp.Header.Get("X-Request-Id")
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		r.ok("ingest", "endpoint=%s status=%d request_id=%s %s", endpoint, resp.StatusCode, requestID, t)
+		return
+	}
+	detail := strings.TrimSpace(string(bytes.ToValidUTF8(body, nil)))
+	if detail != "" {
+		detail = " body=" + strconv.Quote(detail)
+	}
+	r.fail("ingest", statusHint(resp.StatusCode), "endpoint=%s status=%d request_id=%s %s%s", endpoint, resp.StatusCode, requestID, t, detail)
+}
+
+// verifyClient returns the URL to post to and a client built by the SDK from
+// the transport config, with keep-alives off so every run measures a cold
+// connection.
+func verifyClient(endpoint string, cfg aiko.TransportConfig, timeout time.Duration) (string, *http.Client, error) {
+	client, err := aiko.NewTransportClient(cfg)
+	if err != nil {
+		return "", nil, err
+	}
+	transport := client.Transport.(*http.Transport)
+	transport.DisableKeepAlives = true
+	if strings.HasPrefix(endpoint, "unix://") {
+		socket := strings.TrimPrefix(endpoint, "unix://")
+		transport.Proxy = nil
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socket)
+		}
+		endpoint = "http://localhost/api/ingest"
+	}
+	client.Timeout = timeout
+	return endpoint, client, nil
+}
+
+func networkHint(err error, endpoint string, timeout time.Duration) string {
+	host := endpoint
+	if u, parseErr := url.Parse(endpoint); parseErr == nil && u.Host != "" {
+		host = u.Host
+	}
+	var (
+		dnsErr       *net.DNSError
+		unknownCA    x509.UnknownAuthorityError
+		hostnameErr  x509.HostnameError
+		invalidCert  x509.CertificateInvalidError
+		recordHeader tls.RecordHeaderError
+		opErr        *net.OpError
+	)
+	switch {
+	case errors.As(err, &dnsErr):
+		return fmt.Sprintf("DNS lookup for %s failed; check the endpoint host name and this machine's resolver", dnsErr.Name)
+	case errors.As(err, &unknownCA), errors.As(err, &hostnameErr), errors.As(err, &invalidCert):
+		return "the server certificate was not trusted; check the system CA bundle, or whether a TLS-intercepting proxy needs its CA installed"
+	case errors.As(err, &recordHeader):
+		return "the server did not answer with TLS; use http:// for a plain-HTTP loopback ingest"
+	case errors.Is(err, context.DeadlineExceeded), isTimeout(err):
+		return fmt.Sprintf("no response within %s; check that outbound HTTPS to %s is allowed, or set HTTPS_PROXY", timeout, host)
+	case errors.As(err, &opErr) && opErr.Op == "dial":
+		return fmt.Sprintf("could not connect to %s; check firewall and egress rules, or that the local ingest is running", host)
+	}
+	return ""
+}
+
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+func statusHint(status int) string {
+	switch {
+	case status == http.StatusUnauthorized:
+		return "the project key was rejected; check -project-key or AIKO_PROJECT_KEY belongs to this project"
+	case status == http.StatusForbidden:
+		return fmt.Sprintf("the signature was rejected; check -secret-key or AIKO_SECRET_KEY is the project's current secret key and the system clock is within %s of UTC", aiko.DefaultSignatureSkew)
+	case status == http.StatusNotFound:
+		return "nothing serves the ingest API at this URL; the endpoint path must be /api/ingest"
+	case status == http.StatusTooManyRequests || status >= 500:
+		return "the ingest is rate limiting or unavailable; the SDK retries these, try again shortly"
+	}
+	return ""
+}
+
+func checkActor(r *report, cfg aiko.ActorConfig, sample string) {
+	if cfg.Provider == "" && cfg.Token.Header == nil && cfg.Token.Cookie == nil && cfg.Claims == (aiko.ActorClaimsConfig{}) {
+		r.skip("actor", "no actor config; events are sent without an actor")
+		return
+	}
+	if err := aiko.ValidateActorConfig(cfg); err != nil {
+		r.fail("actor", "set -actor-provider, one of -actor-header or -actor-cookie, -actor-extract for jwt, -claim-id and -claim-email", "%v", err)
+		return
+	}
+	if sample == "" {
+		explained := aiko.ExplainActor(cfg, "")
+		r.ok("actor", "provider=%s carrier=%s:%s extractor=%s", explained.Provider, explained.Carrier, explained.CarrierName, explained.Extractor)
+		r.skip("claims", "pass -sample with a real %s value to check claim mapping", explained.Carrier)
+		return
+	}
+
+	explained := aiko.ExplainActor(cfg, sample)
+	r.ok("actor", "provider=%s carrier=%s:%s extractor=%s", explained.Provider, explained.Carrier, explained.CarrierName, explained.Extractor)
+	for _, claim := range explained.Claims {
+		if claim.Resolved {
+			r.ok("claims", "%s <- %s = %s", claim.Field, claim.Path, claim.Value)
+		} else {
+			fmt.Fprintf(r.out, "miss  %-8s %s <- %s not found\n", "claims", claim.Field, claim.Path)
+		}
+	}
+	switch explained.Reason {
+	case "":
+	case "missing_token":
+		r.fail("claims", fmt.Sprintf("pass the full %s value; with extractor %s a header looks like \"Bearer eyJ...\"", explained.Carrier, explained.Extractor), "no token found in the sample")
+	case "invalid_jwt":
+		r.fail("claims", "the token must be a JWT (three dot-separated base64url parts with a JSON payload)", "the extracted token is not a JWT")
+	case "claims_unresolved":
+		r.fail("claims", "claims in the token: "+strings.Join(explained.ClaimNames, ", "), "none of the configured claims resolved")
+	default:
+		r.fail("claims", "", "actor not resolved: %s", explained.Reason)
+	}
+}
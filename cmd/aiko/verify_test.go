@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	aiko "github.com/aikocorp/aiko-monitor-go/aiko"
+	"github.com/aikocorp/aiko-monitor-go/aikotest"
+)
+
+const (
+	testProjectKey = "pk_AAAAAAAAAAAAAAAAAAAAAA"
+	testSecretKey  = "BBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBB"
+)
+
+func testJWT(t *testing.T, claims map[string]any) string {
+	t.Helper()
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatalf("marshal jwt claims: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`)) + "." +
+		base64.RawURLEncoding.EncodeToString(payload) + "." +
+		base64.RawURLEncoding.EncodeToString([]byte("signature"))
+}
+
+func verify(t *testing.T, env map[string]string, args ...string) (int, string) {
+	t.Helper()
+	for key, value := range env {
+		t.Setenv(key, value)
+	}
+	var out bytes.Buffer
+	code := run(append([]string{"verify"}, args...), &out, io.Discard)
+	return code, out.String()
+}
+
+func TestVerifySendsSignedEventAndResolvesActor(t *testing.T) {
+	server := aikotest.NewTestIngestServer(t, testProjectKey, testSecretKey)
+	env := map[string]string{
+		"AIKO_PROJECT_KEY": testProjectKey,
+		"AIKO_SECRET_KEY":  testSecretKey,
+		"AIKO_ENDPOINT":    server.Endpoint(),
+	}
+	code, out := verify(t, env,
+		"-actor-provider", "jwt",
+		"-actor-header", "Authorization",
+		"-actor-extract", "bearer",
+		"-claim-id", "sub",
+		"-claim-email", "email",
+		"-claim-org-id", "org.id",
+		"-sample", "Bearer "+testJWT(t, map[string]any{"sub": "user_1", "email": "a@example.com"}),
+	)
+	if code != 0 {
+		t.Fatalf("expected exit 0, got %d:\n%s", code, out)
+	}
+	for _, want := range []string{"status=202 request_id=req_1", "total=", "id <- sub = user_1", "org_id <- org.id not found", "all checks passed"} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("expected %q in output:\n%s", want, out)
+		}
+	}
+	events := server.Events()
+	if len(events) != 1 || events[0].Endpoint != "/aiko/verify" {
+		t.Fatalf("expected the synthetic event to be accepted, got %+v", events)
+	}
+}
+
+func TestVerifyReportsActionableFailures(t *testing.T) {
+	server := aikotest.NewTestIngestServer(t, testProjectKey, "CCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCC")
+	env := map[string]string{
+		"AIKO_PROJECT_KEY": testProjectKey,
+		"AIKO_SECRET_KEY":  testSecretKey,
+		"AIKO_ENDPOINT":    server.Endpoint(),
+	}
+
+	code, out := verify(t, env)
+	if code != 1 || !strings.Contains(out, "status=403") || !strings.Contains(out, "AIKO_SECRET_KEY is the project's current secret key") {
+		t.Fatalf("expected signature failure with a secret key hint, got %d:\n%s", code, out)
+	}
+
+	code, out = verify(t, env, "-endpoint", "https://ingest.example.com/api/ingest")
+	if code != 1 || !strings.Contains(out, "FAIL  config") || !strings.Contains(out, "-allow-custom-endpoint") {
+		t.Fatalf("expected custom endpoint hint, got %d:\n%s", code, out)
+	}
+
+	code, out = verify(t, map[string]string{"AIKO_PROJECT_KEY": testProjectKey, "AIKO_SECRET_KEY": testSecretKey, "AIKO_ENDPOINT": "http://127.0.0.1:1/api/ingest"},
+		"-actor-provider", "jwt", "-actor-cookie", "session", "-actor-extract", "raw",
+		"-claim-id", "user_id", "-claim-email", "mail",
+		"-sample", testJWT(t, map[string]any{"sub": "user_1", "email": "a@example.com"}),
+	)
+	if code != 1 || !strings.Contains(out, "could not connect to 127.0.0.1:1") || !strings.Contains(out, "claims in the token: email, sub") {
+		t.Fatalf("expected connection and claim hints, got %d:\n%s", code, out)
+	}
+
+	if code, _ := verify(t, env, "-actor-extract", "jwt"); code != 2 {
+		t.Fatalf("expected usage error for a bad extractor, got %d", code)
+	}
+}
+
+func TestVerifyMasksTheProjectKeyAndUsesTheSDKTransport(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	t.Cleanup(server.Close)
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(caFile, ca, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	env := map[string]string{
+		"AIKO_PROJECT_KEY":           testProjectKey,
+		"AIKO_SECRET_KEY":            testSecretKey,
+		"AIKO_ENDPOINT":              server.URL + "/api/ingest",
+		"AIKO_ALLOW_CUSTOM_ENDPOINT": "true",
+	}
+
+	code, out := verify(t, env)
+	if code != 1 || !strings.Contains(out, "certificate was not trusted") {
+		t.Fatalf("expected an untrusted certificate without -ca-file, got %d:\n%s", code, out)
+	}
+	if strings.Contains(out, testProjectKey) || !strings.Contains(out, "project_key="+aiko.MaskProjectKey(testProjectKey)) {
+		t.Fatalf("expected the project key to be masked:\n%s", out)
+	}
+
+	code, out = verify(t, env, "-ca-file", caFile)
+	if code != 0 || !strings.Contains(out, "status=202") {
+		t.Fatalf("expected -ca-file to be trusted, got %d:\n%s", code, out)
+	}
+}
+
+func TestVerifyReadsTheEnvironmentLikeNewFromEnv(t *testing.T) {
+	server := aikotest.NewTestIngestServer(t, testProjectKey, testSecretKey)
+	env := map[string]string{
+		"AIKO_PROJECT_KEY":           testProjectKey,
+		"AIKO_SECRET_KEY":            testSecretKey,
+		"AIKO_ENDPOINT":              server.Endpoint(),
+		"AIKO_ALLOW_CUSTOM_ENDPOINT": "1",
+		"AIKO_ACTOR_PROVIDER":        "jwt",
+		"AIKO_ACTOR_HEADER":          "Authorization",
+		"AIKO_ACTOR_EXTRACT":         "BEARER",
+		"AIKO_ACTOR_CLAIM_ID":        "sub",
+		"AIKO_ACTOR_CLAIM_EMAIL":     "email",
+	}
+	code, out := verify(t, env, "-sample", "Bearer "+testJWT(t, map[string]any{"sub": "user_1", "email": "a@example.com"}))
+	if code != 0 || !strings.Contains(out, "extractor=bearer") || !strings.Contains(out, "id <- sub = user_1") {
+		t.Fatalf("expected the env config to be read as the SDK reads it, got %d:\n%s", code, out)
+	}
+
+	var stderr bytes.Buffer
+	t.Setenv("AIKO_ACTOR_EXTRACT", "json:")
+	if code := run([]string{"verify"}, io.Discard, &stderr); code != 2 || !strings.Contains(stderr.String(), "AIKO_ACTOR_EXTRACT") {
+		t.Fatalf("expected an empty json path to be rejected as NewFromEnv does, got %d: %s", code, stderr.String())
+	}
+}
+
+func TestVerifyChecksEveryEndpointAndLetsFlagsReplaceTheEnv(t *testing.T) {
+	primary := aikotest.NewTestIngestServer(t, testProjectKey, testSecretKey)
+	secondary := aikotest.NewTestIngestServer(t, testProjectKey, testSecretKey)
+	env := map[string]string{
+		"AIKO_PROJECT_KEY":  testProjectKey,
+		"AIKO_SECRET_KEY":   testSecretKey,
+		"AIKO_ENDPOINTS":    primary.Endpoint() + "," + secondary.Endpoint(),
+		"AIKO_ACTOR_HEADER": "Authorization",
+	}
+
+	code, out := verify(t, env,
+		"-actor-provider", "jwt",
+		"-actor-cookie", "session",
+		"-actor-extract", "raw",
+		"-claim-id", "sub",
+		"-claim-email", "email",
+	)
+	if code != 0 || !strings.Contains(out, "carrier=cookie:session") {
+		t.Fatalf("expected -actor-cookie to replace AIKO_ACTOR_HEADER, got %d:\n%s", code, out)
+	}
+	for _, server := range []*aikotest.IngestServer{primary, secondary} {
+		if !strings.Contains(out, "endpoint="+server.Endpoint()+" status=202") || len(server.Events()) != 1 {
+			t.Fatalf("expected a test event at %s, got %d:\n%s", server.Endpoint(), len(server.Events()), out)
+		}
+	}
+
+	_, out = verify(t, env, "-endpoint", secondary.Endpoint())
+	if strings.Contains(out, primary.Endpoint()) || len(primary.Events()) != 1 || len(secondary.Events()) != 2 {
+		t.Fatalf("expected -endpoint to replace AIKO_ENDPOINTS:\n%s", out)
+	}
+}
@@ -2,9 +2,10 @@ module github.com/aikocorp/aiko-monitor-go
 
 go 1.25.1
 
+require github.com/valyala/fasthttp v1.67.0
+
 require (
 	github.com/andybalholm/brotli v1.2.0 // indirect
 	github.com/klauspost/compress v1.18.0 // indirect
 	github.com/valyala/bytebufferpool v1.0.0 // indirect
-	github.com/valyala/fasthttp v1.67.0 // indirect
 )
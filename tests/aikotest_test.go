@@ -0,0 +1,92 @@
+package aiko_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	aiko "github.com/aikocorp/aiko-monitor-go/aiko"
+	"github.com/aikocorp/aiko-monitor-go/aikotest"
+)
+
+func TestRecorderCapturesMiddlewareEventsInMemory(t *testing.T) {
+	recorder := aikotest.NewTestRecorder(t, aiko.Config{
+		Actor: aiko.ActorConfig{
+			Provider: aiko.ActorProviderJWT,
+			Token: aiko.ActorTokenConfig{
+				Header: &aiko.ActorHeaderTokenConfig{Name: "Authorization", Extract: aiko.ActorTokenExtractBearer()},
+			},
+			Claims: aiko.ActorClaimsConfig{ID: "sub", Email: "email"},
+		},
+	})
+
+	handler := aiko.NetHTTPMiddleware(recorder.Monitor())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"order":{"id":42,"items":[{"sku":"A-1"}]}}`))
+	}))
+	req := httptest.NewRequest(http.MethodPost, "/orders?src=test", strings.NewReader(`{"qty":2}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+testJWT(t, map[string]any{"sub": "user_1", "email": "a@example.com"}))
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	events, err := recorder.WaitForEvents(1, 2*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aikotest.AssertEvent(t, events[0],
+		aikotest.Method("POST"),
+		aikotest.Endpoint("/orders?src=test"),
+		aikotest.Status(http.StatusCreated),
+		aikotest.Actor(aiko.ActorContext{ID: "user_1", Email: "a@example.com"}),
+		aikotest.RequestHeader("Authorization", "[REDACTED]"),
+		aikotest.RequestBodyPath("qty", 2),
+		aikotest.ResponseBodyPath("order.items.0.sku", "A-1"),
+	)
+
+	if err := aikotest.Match(events[0], aikotest.Status(500), aikotest.ResponseBodyPath("order.missing", 1)); err == nil ||
+		!strings.Contains(err.Error(), "status: want 500") || !strings.Contains(err.Error(), "no key \"missing\"") {
+		t.Fatalf("expected descriptive mismatch, got %v", err)
+	}
+}
+
+func TestRecorderWaitForMatchTimesOut(t *testing.T) {
+	recorder := aikotest.NewTestRecorder(t, aiko.Config{})
+	recorder.Monitor().AddEvent(aiko.Event{URL: "/a", Endpoint: "/a", Method: "GET", StatusCode: 200})
+
+	if _, err := recorder.WaitForMatch(2*time.Second, aikotest.Endpoint("/a")); err != nil {
+		t.Fatalf("expected /a to match: %v", err)
+	}
+	if _, err := recorder.WaitForMatch(50*time.Millisecond, aikotest.Endpoint("/b")); err == nil {
+		t.Fatal("expected timeout waiting for /b")
+	}
+}
+
+func TestIngestServerVerifiesSignatures(t *testing.T) {
+	server := aikotest.NewTestIngestServer(t, testProjectKey, testSecretKey)
+	server.SetResponses(http.StatusServiceUnavailable)
+
+	monitor := newTestMonitor(t, server.Endpoint())
+	monitor.AddEvent(aiko.Event{URL: "/signed", Endpoint: "/signed", Method: "GET", StatusCode: 200})
+	events, err := server.WaitForEvents(1, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shutdownMonitor(t, monitor)
+	aikotest.AssertEvent(t, events[0], aikotest.Endpoint("/signed"))
+	if got := len(server.Requests()); got != 2 {
+		t.Fatalf("expected a retry after the queued 503, got %d requests", got)
+	}
+
+	rejecting := aikotest.NewTestIngestServer(t, testProjectKey, "CCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCC")
+	rejected := newTestMonitor(t, rejecting.Endpoint())
+	rejected.AddEvent(aiko.Event{URL: "/bad", Endpoint: "/bad", Method: "GET", StatusCode: 200})
+	shutdownMonitor(t, rejected)
+	if len(rejecting.Events()) != 0 {
+		t.Fatal("expected events signed with an unknown key to be rejected")
+	}
+}
@@ -0,0 +1,251 @@
+package aiko_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	aiko "github.com/aikocorp/aiko-monitor-go/aiko"
+	"github.com/aikocorp/aiko-monitor-go/aikotest"
+	"github.com/valyala/fasthttp"
+)
+
+func TestBodyPolicyKeepsBodiesOnErrorsSlowRequestsAndRoutes(t *testing.T) {
+	recorder := aikotest.NewTestRecorder(t, aiko.Config{
+		Capture: aiko.CaptureConfig{Bodies: aiko.BodyPolicy{
+			Mode:          aiko.BodyModeOnError,
+			ErrorStatus:   400,
+			SlowThreshold: 30 * time.Millisecond,
+			Routes: []aiko.BodyRoute{
+				{Endpoint: "/checkout/**", Mode: aiko.BodyModeAlways},
+				{Method: "POST", Endpoint: "/search", Mode: aiko.BodyModeOnSlow},
+				{Endpoint: "/files/*", Mode: aiko.BodyModeNever},
+			},
+		}},
+	})
+	var original io.ReadCloser
+	var buffered bool
+	handler := aiko.NetHTTPMiddleware(recorder.Monitor())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		buffered = r.Body != original
+		if body, _ := io.ReadAll(r.Body); string(body) != `{"a":1}` {
+			t.Errorf("handler read %q", body)
+		}
+		switch {
+		case r.URL.Query().Get("slow") != "":
+			time.Sleep(40 * time.Millisecond)
+		case r.URL.Query().Get("fail") != "":
+			w.WriteHeader(http.StatusConflict)
+		}
+		_, _ = w.Write([]byte(`{"ok":true}`))
+	}))
+	serve := func(target string) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(`{"a":1}`))
+		original = req.Body
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	serve("/files/1?fail=1")
+	if buffered {
+		t.Fatal("a route in never mode should not be buffered")
+	}
+	for _, target := range []string{"/orders", "/orders?fail=1", "/checkout/cart", "/search", "/search?slow=1", "/search?fail=1"} {
+		serve(target)
+	}
+	if err := recorder.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]bool{
+		"/files/1?fail=1": false,
+		"/orders":         false,
+		"/orders?fail=1":  true,
+		"/checkout/cart":  true,
+		"/search":         false,
+		"/search?slow=1":  true,
+		"/search?fail=1":  false,
+	}
+	events := recorder.Events()
+	if len(events) != len(want) {
+		t.Fatalf("expected %d events, got %d", len(want), len(events))
+	}
+	for _, evt := range events {
+		hasBodies := evt.RequestBody != nil && evt.ResponseBody != nil
+		if hasBodies != want[evt.Endpoint] || (!hasBodies && (evt.RequestBody != nil || evt.ResponseBody != nil)) {
+			t.Fatalf("%s: request=%v response=%v, want bodies %t", evt.Endpoint, evt.RequestBody, evt.ResponseBody, want[evt.Endpoint])
+		}
+	}
+}
+
+func TestBodyPolicyBoundsBufferedBodies(t *testing.T) {
+	recorder := aikotest.NewTestRecorder(t, aiko.Config{
+		Capture: aiko.CaptureConfig{Bodies: aiko.BodyPolicy{MaxBytes: 16}},
+	})
+	large := strings.Repeat("x", 64)
+	handler := aiko.NetHTTPMiddleware(recorder.Monitor())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		_, _ = w.Write(body)
+	}))
+	for _, body := range []string{large, "small"} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/echo", strings.NewReader(body)))
+		if rec.Body.String() != body {
+			t.Fatalf("handler saw a cut body: %q", rec.Body.String())
+		}
+	}
+
+	fastHandler := aiko.FastHTTPMiddleware(recorder.Monitor(), func(ctx *fasthttp.RequestCtx) {
+		ctx.SetBody(ctx.PostBody())
+	})
+	var ctx fasthttp.RequestCtx
+	ctx.Request.Header.SetMethod(fasthttp.MethodPost)
+	ctx.Request.SetRequestURI("/fast")
+	ctx.Request.SetBodyString(large)
+	fastHandler(&ctx)
+
+	if err := recorder.Close(); err != nil {
+		t.Fatal(err)
+	}
+	events := recorder.Events()
+	if len(events) != 3 {
+		t.Fatalf("expected 3 events, got %d", len(events))
+	}
+	for _, evt := range events {
+		if evt.RequestBody == "small" {
+			if evt.ResponseBody != "small" {
+				t.Fatalf("small response body not kept: %v", evt.ResponseBody)
+			}
+			continue
+		}
+		for _, body := range []any{evt.RequestBody, evt.ResponseBody} {
+			marker, ok := body.(map[string]any)
+			if !ok || marker["truncated"] != true {
+				t.Fatalf("%s: expected truncated marker, got %#v", evt.Endpoint, body)
+			}
+		}
+	}
+}
+
+func TestFastHTTPBodyPolicySkipsSuccessfulRequests(t *testing.T) {
+	recorder := aikotest.NewTestRecorder(t, aiko.Config{
+		Capture: aiko.CaptureConfig{Bodies: aiko.BodyPolicy{Mode: aiko.BodyModeOnError}},
+	})
+	handler := aiko.FastHTTPMiddleware(recorder.Monitor(), func(ctx *fasthttp.RequestCtx) {
+		if string(ctx.Path()) == "/fail" {
+			ctx.SetStatusCode(fasthttp.StatusServiceUnavailable)
+		}
+		ctx.SetBodyString(`{"ok":false}`)
+	})
+	for _, target := range []string{"/ok", "/fail"} {
+		var ctx fasthttp.RequestCtx
+		ctx.Request.Header.SetMethod(fasthttp.MethodPost)
+		ctx.Request.SetRequestURI(target)
+		ctx.Request.SetBodyString(`{"a":1}`)
+		handler(&ctx)
+	}
+	if err := recorder.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for _, evt := range recorder.Events() {
+		hasBodies := evt.RequestBody != nil && evt.ResponseBody != nil
+		if hasBodies != (evt.Endpoint == "/fail") {
+			t.Fatalf("%s: request=%v response=%v", evt.Endpoint, evt.RequestBody, evt.ResponseBody)
+		}
+	}
+}
+
+func TestBodyPolicyMarksLargeServerErrorsTruncated(t *testing.T) {
+	recorder := aikotest.NewTestRecorder(t, aiko.Config{
+		Capture: aiko.CaptureConfig{Bodies: aiko.BodyPolicy{MaxBytes: 16}},
+	})
+	handler := aiko.NetHTTPMiddleware(recorder.Monitor())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+		_, _ = w.Write([]byte(strings.Repeat("x", 64)))
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/upstream", nil))
+	if err := recorder.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	events := recorder.Events()
+	if len(events) != 1 {
+		t.Fatalf("expected 1 event, got %d", len(events))
+	}
+	evt := events[0]
+	marker, ok := evt.ResponseBody.(map[string]any)
+	if !ok || marker["truncated"] != true {
+		t.Fatalf("expected truncated marker, got %#v", evt.ResponseBody)
+	}
+}
+
+func TestFastHTTPCapturesRequestBodyBeforeHandler(t *testing.T) {
+	recorder := aikotest.NewTestRecorder(t, aiko.Config{})
+	handler := aiko.FastHTTPMiddleware(recorder.Monitor(), func(ctx *fasthttp.RequestCtx) {
+		ctx.Request.SetBodyString(`{"replaced":true}`)
+		ctx.Request.ResetBody()
+		ctx.SetBodyString(`{"ok":true}`)
+	})
+	var ctx fasthttp.RequestCtx
+	ctx.Request.Header.SetMethod(fasthttp.MethodPost)
+	ctx.Request.SetRequestURI("/orders")
+	ctx.Request.SetBodyString(`{"a":1}`)
+	handler(&ctx)
+	if err := recorder.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	events := recorder.Events()
+	if len(events) != 1 {
+		t.Fatalf("expected 1 event, got %d", len(events))
+	}
+	evt := events[0]
+	body, ok := evt.RequestBody.(map[string]any)
+	if !ok || body["a"] != float64(1) {
+		t.Fatalf("expected the body the client sent, got %#v", evt.RequestBody)
+	}
+}
+
+func TestBodyPolicyIsValidated(t *testing.T) {
+	for _, tc := range []struct {
+		policy aiko.BodyPolicy
+		want   string
+	}{
+		{aiko.BodyPolicy{Mode: "sometimes"}, `capture.bodies.mode must be always, never, on_error or on_slow, got "sometimes"`},
+		{aiko.BodyPolicy{Mode: aiko.BodyModeOnSlow}, "capture.bodies.slowThreshold must be set for on_slow"},
+		{aiko.BodyPolicy{ErrorStatus: 42}, "capture.bodies.errorStatus must be a status code, got 42"},
+		{aiko.BodyPolicy{MaxBytes: -1}, "capture.bodies.maxBytes must not be negative"},
+		{aiko.BodyPolicy{Routes: []aiko.BodyRoute{{Endpoint: "/a"}}}, "capture.bodies.routes[0].mode must be set"},
+		{aiko.BodyPolicy{Routes: []aiko.BodyRoute{{Endpoint: "/a", Mode: aiko.BodyModeOnSlow}}}, "capture.bodies.routes[0].slowThreshold must be set for on_slow"},
+		{aiko.BodyPolicy{Routes: []aiko.BodyRoute{{Endpoint: "/a/[", Mode: aiko.BodyModeNever}}}, `capture.bodies.routes[0].endpoint "/a/[" is not a valid pattern`},
+	} {
+		_, err := aikotest.NewRecorder(aiko.Config{Capture: aiko.CaptureConfig{Bodies: tc.policy}})
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Fatalf("expected %q, got %v", tc.want, err)
+		}
+	}
+}
+
+func TestConfigFromFileReadsBodyPolicy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "aiko.json")
+	writeConfigFile(t, path, `{"capture": {"bodies": {
+		"mode": "on_error", "error_status": 400, "slow_ms": 1500, "max_bytes": 4096,
+		"routes": [{"method": "POST", "endpoint": "/search", "mode": "on_slow", "slow_ms": 250}]
+	}}}`, 0)
+	cfg, err := aiko.ConfigFromFile(path)
+	if err != nil {
+		t.Fatalf("config from file: %v", err)
+	}
+	bodies := cfg.Capture.Bodies
+	if bodies.Mode != aiko.BodyModeOnError || bodies.ErrorStatus != 400 ||
+		bodies.SlowThreshold != 1500*time.Millisecond || bodies.MaxBytes != 4096 {
+		t.Fatalf("unexpected body policy: %+v", bodies)
+	}
+	if len(bodies.Routes) != 1 || bodies.Routes[0].Mode != aiko.BodyModeOnSlow ||
+		bodies.Routes[0].SlowThreshold != 250*time.Millisecond || bodies.Routes[0].Method != "POST" {
+		t.Fatalf("unexpected body routes: %+v", bodies.Routes)
+	}
+}
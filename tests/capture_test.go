@@ -0,0 +1,153 @@
+package aiko_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	aiko "github.com/aikocorp/aiko-monitor-go/aiko"
+	"github.com/aikocorp/aiko-monitor-go/aikotest"
+	"github.com/valyala/fasthttp"
+)
+
+func TestCaptureFiltersSkipExcludedRequests(t *testing.T) {
+	var resolved []string
+	recorder := aikotest.NewTestRecorder(t, aiko.Config{
+		Actor: aiko.ActorConfig{
+			Provider: aiko.ActorProviderCustom,
+			Resolve: func(ctx aiko.ActorResolveContext) (*aiko.ActorContext, error) {
+				resolved = append(resolved, ctx.HTTPRequest.URL.Path)
+				return nil, nil
+			},
+		},
+		Capture: aiko.CaptureConfig{
+			Include: []aiko.CaptureFilter{{Host: "*.example.com"}},
+			Exclude: []aiko.CaptureFilter{
+				{Path: "/healthz"},
+				{Path: "/static/**"},
+				{Method: "options"},
+				{Host: "admin.example.com", Regex: `/debug/.*`},
+			},
+		},
+	})
+	var original any
+	var buffered bool
+	handler := aiko.NetHTTPMiddleware(recorder.Monitor())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		buffered = r.Body != original
+	}))
+	serve := func(method, target string) bool {
+		t.Helper()
+		req := httptest.NewRequest(method, target, strings.NewReader(`{"a":1}`))
+		original = req.Body
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		return buffered
+	}
+
+	for _, req := range [][2]string{
+		{http.MethodGet, "http://api.example.com/healthz"},
+		{http.MethodGet, "http://api.example.com/static/css/site.css"},
+		{http.MethodOptions, "http://api.example.com/orders"},
+		{http.MethodGet, "http://admin.example.com:8443/debug/vars"},
+		{http.MethodGet, "http://other.test/orders"},
+	} {
+		if serve(req[0], req[1]) {
+			t.Fatalf("excluded request %s %s was buffered", req[0], req[1])
+		}
+	}
+	serve(http.MethodGet, "http://api.example.com/orders?page=2")
+	serve(http.MethodGet, "http://api.example.com/debug/vars")
+	if err := recorder.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, evt := range recorder.Events() {
+		got = append(got, evt.Endpoint)
+	}
+	sort.Strings(got)
+	if strings.Join(got, ",") != "/debug/vars,/orders?page=2" {
+		t.Fatalf("unexpected captured endpoints %v", got)
+	}
+	sort.Strings(resolved)
+	if strings.Join(resolved, ",") != "/debug/vars,/orders" {
+		t.Fatalf("actor resolution should only run for captured requests, got %v", resolved)
+	}
+}
+
+func TestFastHTTPCaptureFilters(t *testing.T) {
+	recorder := aikotest.NewTestRecorder(t, aiko.Config{
+		Capture: aiko.CaptureConfig{Exclude: []aiko.CaptureFilter{{Regex: `^/(metrics|favicon\.ico)$`}}},
+	})
+	handler := aiko.FastHTTPMiddleware(recorder.Monitor(), func(ctx *fasthttp.RequestCtx) {})
+	for _, target := range []string{"/metrics", "/favicon.ico", "/orders"} {
+		var ctx fasthttp.RequestCtx
+		ctx.Request.SetRequestURI(target)
+		handler(&ctx)
+	}
+	if err := recorder.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if events := recorder.Events(); len(events) != 1 || events[0].Endpoint != "/orders" {
+		t.Fatalf("expected only /orders captured, got %+v", events)
+	}
+}
+
+func TestCaptureFilterPathGlobsAndAnchoredRegex(t *testing.T) {
+	recorder := aikotest.NewTestRecorder(t, aiko.Config{
+		Capture: aiko.CaptureConfig{Exclude: []aiko.CaptureFilter{
+			{Path: "/static/*"},
+			{Path: "/assets/**"},
+			{Regex: `/health`},
+		}},
+	})
+	handler := aiko.NetHTTPMiddleware(recorder.Monitor())(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	for _, target := range []string{
+		"/static/app.js",         // excluded: one segment under /static
+		"/static/css/site.css",   // captured: "*" does not cross "/"
+		"/assets/img/logo.png",   // excluded: "/**" covers every depth
+		"/health",                // excluded: the regex matches the whole path
+		"/api/healthcheck-users", // captured: no substring match
+	} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, target, nil))
+	}
+	if err := recorder.Close(); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, evt := range recorder.Events() {
+		got = append(got, evt.Endpoint)
+	}
+	sort.Strings(got)
+	if strings.Join(got, ",") != "/api/healthcheck-users,/static/css/site.css" {
+		t.Fatalf("unexpected captured endpoints %v", got)
+	}
+}
+
+func TestCaptureFiltersAreValidated(t *testing.T) {
+	for _, tc := range []struct {
+		capture aiko.CaptureConfig
+		want    string
+	}{
+		{aiko.CaptureConfig{Exclude: []aiko.CaptureFilter{{}}}, "capture.exclude[0] must set method, host, path or regex"},
+		{aiko.CaptureConfig{Include: []aiko.CaptureFilter{{Path: "/a", Regex: "^/a"}}}, "capture.include[0] cannot set both path and regex"},
+		{aiko.CaptureConfig{Exclude: []aiko.CaptureFilter{{Regex: "("}}}, "capture.exclude[0].regex: error parsing regexp"},
+	} {
+		_, err := aikotest.NewRecorder(aiko.Config{Capture: tc.capture})
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Fatalf("expected %q, got %v", tc.want, err)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "aiko.json")
+	writeConfigFile(t, path, `{"capture": {"exclude": [{"path": "/healthz"}, {"method": "GET", "regex": "/static/.*"}]}}`, 0)
+	cfg, err := aiko.ConfigFromFile(path)
+	if err != nil {
+		t.Fatalf("config from file: %v", err)
+	}
+	if len(cfg.Capture.Exclude) != 2 || cfg.Capture.Exclude[1].Regex != "/static/.*" {
+		t.Fatalf("unexpected capture config: %+v", cfg.Capture)
+	}
+}
@@ -0,0 +1,103 @@
+package aiko_test
+
+import (
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	aiko "github.com/aikocorp/aiko-monitor-go/aiko"
+	"github.com/aikocorp/aiko-monitor-go/aikotest"
+)
+
+func writeConfigFile(t *testing.T, path, content string, version int) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	// distinct mtimes so the watcher notices same-size rewrites
+	mtime := time.Now().Add(time.Duration(version) * time.Second)
+	if err := os.Chtimes(path, mtime, mtime); err != nil {
+		t.Fatalf("chtimes config: %v", err)
+	}
+}
+
+func waitForLog(t *testing.T, logs *lockedBuffer, want string) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !strings.Contains(logs.String(), want) {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %q in logs:\n%s", want, logs.String())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestConfigFromFileIsStrict(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "aiko.json")
+	writeConfigFile(t, path, `{
+		"project_key": "`+validProjectKey+`",
+		"secret_key": "`+validSecretKey+`",
+		"queue_size": 64,
+		"actor": {"provider": "jwt", "header": "Authorization", "extract": "bearer", "claims": {"id": "sub", "email": "email"}},
+		"sampling": {"rate": 0.5},
+		"redaction": {"headers": ["x-api-key"], "body_keys": ["ssn"]}
+	}`, 0)
+	cfg, err := aiko.ConfigFromFile(path)
+	if err != nil {
+		t.Fatalf("config from file: %v", err)
+	}
+	if cfg.ProjectKey != validProjectKey || cfg.QueueSize != 64 || cfg.Sampling.Rate != 0.5 ||
+		cfg.Actor.Token.Header == nil || cfg.Redaction.BodyKeys[0] != "ssn" {
+		t.Fatalf("unexpected config: %+v", cfg)
+	}
+
+	writeConfigFile(t, path, `{"project_key": "`+validProjectKey+`", "sampling": {"rat": 0.5}}`, 1)
+	if _, err := aiko.ConfigFromFile(path); err == nil || !strings.Contains(err.Error(), `unknown field "rat"`) {
+		t.Fatalf("expected unknown field error, got %v", err)
+	}
+	writeConfigFile(t, path, `{"actor": {"extract": "header"}}`, 2)
+	if _, err := aiko.ConfigFromFile(path); err == nil || !strings.Contains(err.Error(), "actor.extract") {
+		t.Fatalf("expected actor.extract error, got %v", err)
+	}
+}
+
+func TestWatchConfigFileAppliesSafeChangesAndRejectsUnsafe(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "aiko.json")
+	writeConfigFile(t, path, `{"project_key": "`+validProjectKey+`", "redaction": {"headers": []}}`, 0)
+
+	var logs lockedBuffer
+	recorder := aikotest.NewTestRecorder(t, aiko.Config{Logger: log.New(&logs, "", 0)})
+	if err := recorder.Monitor().WatchConfigFile(path, 10*time.Millisecond); err != nil {
+		t.Fatalf("watch: %v", err)
+	}
+	handler := aiko.NetHTTPMiddleware(recorder.Monitor())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	send := func() aiko.Event {
+		t.Helper()
+		recorder.Reset()
+		req := httptest.NewRequest(http.MethodGet, "/tenants", nil)
+		req.Header.Set("X-Tenant-Token", "t_123")
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		events, err := recorder.WaitForEvents(1, 2*time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return events[0]
+	}
+	aikotest.AssertEvent(t, send(), aikotest.RequestHeader("x-tenant-token", "t_123"))
+
+	writeConfigFile(t, path, `{"project_key": "`+validProjectKey+`", "redaction": {"headers": ["X-Tenant-Token"]}}`, 1)
+	waitForLog(t, &logs, "aiko config reloaded path="+path+" hash=")
+	aikotest.AssertEvent(t, send(), aikotest.RequestHeader("x-tenant-token", "[REDACTED]"))
+
+	writeConfigFile(t, path, `{"project_key": "pk_BBBBBBBBBBBBBBBBBBBBBB", "redaction": {"headers": []}}`, 2)
+	waitForLog(t, &logs, "project_key cannot change at runtime")
+	aikotest.AssertEvent(t, send(), aikotest.RequestHeader("x-tenant-token", "[REDACTED]"))
+
+	writeConfigFile(t, path, `{"project_key": "`+validProjectKey+`", "sampling": {"rate": 3}}`, 3)
+	waitForLog(t, &logs, "sampling.rate must be between 0 and 1")
+}
@@ -0,0 +1,188 @@
+package aiko_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	aiko "github.com/aikocorp/aiko-monitor-go/aiko"
+	"github.com/aikocorp/aiko-monitor-go/aikotest"
+)
+
+func TestConfigFromEnvReadsDocumentedVariables(t *testing.T) {
+	t.Setenv(aiko.EnvProjectKey, validProjectKey)
+	t.Setenv(aiko.EnvSecretKey, validSecretKey)
+	t.Setenv(aiko.EnvEndpoints, "https://eu.example.com/api/ingest, https://us.example.com/api/ingest")
+	t.Setenv(aiko.EnvAllowCustomEndpoint, "true")
+	t.Setenv(aiko.EnvEnabled, "false")
+	t.Setenv(aiko.EnvVerbose, "1")
+	t.Setenv(aiko.EnvQueueSize, "128")
+	t.Setenv(aiko.EnvMaxConcurrentSends, "2")
+	t.Setenv(aiko.EnvActorProvider, "jwt")
+	t.Setenv(aiko.EnvActorCookie, "session")
+	t.Setenv(aiko.EnvActorExtract, "json:access_token")
+	t.Setenv(aiko.EnvActorClaimID, "sub")
+	t.Setenv(aiko.EnvActorClaimEmail, "email")
+	t.Setenv(aiko.EnvSampleRate, "0.25")
+	t.Setenv(aiko.EnvRedactHeaders, "x-api-key,X-Tenant-Secret")
+	t.Setenv(aiko.EnvRedactBodyKeys, "ssn")
+
+	cfg, err := aiko.ConfigFromEnv()
+	if err != nil {
+		t.Fatalf("config from env: %v", err)
+	}
+	if cfg.ProjectKey != validProjectKey || cfg.SecretKey != validSecretKey || len(cfg.Endpoints) != 2 || !cfg.AllowCustomEndpoint {
+		t.Fatalf("unexpected ingest settings: %+v", cfg)
+	}
+	if cfg.Enabled == nil || *cfg.Enabled || !cfg.Verbose || cfg.QueueSize != 128 || cfg.MaxConcurrentSends != 2 {
+		t.Fatalf("unexpected monitor settings: %+v", cfg)
+	}
+	cookie := cfg.Actor.Token.Cookie
+	if cfg.Actor.Provider != aiko.ActorProviderJWT || cookie == nil || cookie.Name != "session" ||
+		cookie.Extract != aiko.ActorTokenExtractJSON("access_token") || cfg.Actor.Claims.ID != "sub" {
+		t.Fatalf("unexpected actor config: %+v", cfg.Actor)
+	}
+	if cfg.Sampling.Rate != 0.25 || len(cfg.Redaction.Headers) != 2 || cfg.Redaction.BodyKeys[0] != "ssn" {
+		t.Fatalf("unexpected sampling or redaction: %+v %+v", cfg.Sampling, cfg.Redaction)
+	}
+}
+
+func TestConfigFromEnvErrorsNameTheVariable(t *testing.T) {
+	cases := map[string]string{
+		aiko.EnvEnabled:             "maybe",
+		aiko.EnvQueueSize:           "lots",
+		aiko.EnvSampleRate:          "1.5",
+		aiko.EnvActorExtract:        "header",
+		aiko.EnvVerbose:             "yes please",
+		aiko.EnvActorCookie:         "session",
+		aiko.EnvAllowCustomEndpoint: "sure",
+	}
+	for name, value := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv(name, value)
+			if name == aiko.EnvActorCookie {
+				t.Setenv(aiko.EnvActorHeader, "Authorization")
+			}
+			_, err := aiko.ConfigFromEnv()
+			if err == nil || !strings.Contains(err.Error(), name) {
+				t.Fatalf("expected error naming %s, got %v", name, err)
+			}
+		})
+	}
+}
+
+func TestParseActorTokenExtractKeepsTheConfigJSONShape(t *testing.T) {
+	extract, err := aiko.ParseActorTokenExtract("JSON:session.token")
+	if err != nil || extract != aiko.ActorTokenExtractJSON("session.token") {
+		t.Fatalf("expected a json extractor, got %+v (%v)", extract, err)
+	}
+	raw, err := json.Marshal(extract)
+	if err != nil || string(raw) != `{"Type":"json","Path":"session.token"}` {
+		t.Fatalf("expected the extractor to encode as an object, got %s (%v)", raw, err)
+	}
+}
+
+func TestNewFromEnvExplicitConfigOverridesEnvironment(t *testing.T) {
+	server := aikotest.NewTestIngestServer(t, testProjectKey, testSecretKey)
+	t.Setenv(aiko.EnvProjectKey, "pk_not_valid")
+	t.Setenv(aiko.EnvSecretKey, testSecretKey)
+	t.Setenv(aiko.EnvEndpoint, "https://ignored.example.com/api/ingest")
+	t.Setenv(aiko.EnvEnabled, "false")
+
+	enabled := true
+	monitor, err := aiko.NewFromEnv(aiko.Config{
+		ProjectKey: testProjectKey,
+		Endpoint:   server.Endpoint(),
+		Enabled:    &enabled,
+	})
+	if err != nil {
+		t.Fatalf("new from env: %v", err)
+	}
+	if !monitor.Enabled() {
+		t.Fatal("expected explicit Enabled to override AIKO_ENABLED")
+	}
+	monitor.AddEvent(aiko.Event{URL: "/env", Endpoint: "/env", Method: "GET", StatusCode: 200})
+	shutdownMonitor(t, monitor)
+	if _, err := server.WaitForEvents(1, 2*time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv(aiko.EnvQueueSize, "-1")
+	if _, err := aiko.NewFromEnv(aiko.Config{}); err == nil || !strings.Contains(err.Error(), aiko.EnvQueueSize) {
+		t.Fatalf("expected AIKO_QUEUE_SIZE error, got %v", err)
+	}
+}
+
+func TestNewFromEnvExplicitSamplingReplacesEnvironmentSampling(t *testing.T) {
+	t.Setenv(aiko.EnvSampleTargetPerSecond, "10")
+	monitor, err := aiko.NewFromEnv(aiko.Config{
+		Exporters: []aiko.Exporter{&recordingExporter{}},
+		Sampling:  aiko.SamplingConfig{Rate: 0.5},
+	})
+	if err != nil {
+		t.Fatalf("explicit rate with env target: %v", err)
+	}
+	if got := monitor.DynamicConfig().Sampling; got.Rate != 0.5 || got.Adaptive.TargetPerSecond != 0 {
+		t.Fatalf("expected explicit rate to replace env adaptive sampling, got %+v", got)
+	}
+	shutdownMonitor(t, monitor)
+
+	t.Setenv(aiko.EnvSampleTargetPerSecond, "")
+	t.Setenv(aiko.EnvSampleRate, "0.25")
+	monitor, err = aiko.NewFromEnv(aiko.Config{
+		Exporters: []aiko.Exporter{&recordingExporter{}},
+		Sampling:  aiko.SamplingConfig{Adaptive: aiko.AdaptiveSamplingConfig{TargetPerSecond: 5}},
+	})
+	if err != nil {
+		t.Fatalf("explicit adaptive with env rate: %v", err)
+	}
+	if got := monitor.DynamicConfig().Sampling; got.Rate != 0 || got.Adaptive.TargetPerSecond != 5 {
+		t.Fatalf("expected explicit adaptive sampling to replace env rate, got %+v", got)
+	}
+	shutdownMonitor(t, monitor)
+}
+
+func TestRedactionAndSamplingConfig(t *testing.T) {
+	recorder := aikotest.NewTestRecorder(t, aiko.Config{
+		Redaction: aiko.RedactionConfig{Headers: []string{"X-Api-Key"}, BodyKeys: []string{"SSN"}},
+	})
+	handler := aiko.NetHTTPMiddleware(recorder.Monitor())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"person":{"ssn":"123-45-6789","name":"Ada"}}`))
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/people/1", nil)
+	req.Header.Set("X-Api-Key", "k_live_1")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	events, err := recorder.WaitForEvents(1, 2*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aikotest.AssertEvent(t, events[0],
+		aikotest.RequestHeader("x-api-key", "[REDACTED]"),
+		aikotest.ResponseBodyPath("person.ssn", "[REDACTED]"),
+		aikotest.ResponseBodyPath("person.name", "Ada"),
+	)
+
+	sampled := aikotest.NewTestRecorder(t, aiko.Config{Sampling: aiko.SamplingConfig{Rate: 1e-9}})
+	var served int
+	handler = aiko.NetHTTPMiddleware(sampled.Monitor())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		served++
+	}))
+	for i := 0; i < 50; i++ {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	}
+	if err := sampled.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if served != 50 || len(sampled.Events()) != 0 {
+		t.Fatalf("expected all requests served and none captured, got served=%d events=%d", served, len(sampled.Events()))
+	}
+
+	if _, err := aikotest.NewRecorder(aiko.Config{Sampling: aiko.SamplingConfig{Rate: 2}}); err == nil {
+		t.Fatal("expected sampling.rate above 1 to be rejected")
+	}
+}
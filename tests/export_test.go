@@ -0,0 +1,239 @@
+package aiko_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	aiko "github.com/aikocorp/aiko-monitor-go/aiko"
+	testserver "github.com/aikocorp/aiko-monitor-go/tests/mockserver"
+)
+
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+type recordingExporter struct {
+	mu       sync.Mutex
+	events   []aiko.Event
+	calls    int
+	failures []error
+	flushed  bool
+	shutdown bool
+}
+
+func (e *recordingExporter) Export(_ context.Context, events []aiko.Event) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.calls++
+	if len(e.failures) > 0 {
+		err := e.failures[0]
+		e.failures = e.failures[1:]
+		return err
+	}
+	e.events = append(e.events, events...)
+	return nil
+}
+
+func (e *recordingExporter) Flush(context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.flushed = true
+	return nil
+}
+
+func (e *recordingExporter) Shutdown(context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.shutdown = true
+	return nil
+}
+
+type retryableErr struct{}
+
+func (retryableErr) Error() string   { return "try again" }
+func (retryableErr) Retryable() bool { return true }
+
+func TestWriterExporterReceivesRedactedEventsAlongsideIngest(t *testing.T) {
+	server, err := testserver.StartMockServer(testSecretKey, testProjectKey)
+	if err != nil {
+		t.Fatalf("start mock server: %v", err)
+	}
+	defer server.Stop()
+
+	var out lockedBuffer
+	monitor, err := aiko.New(aiko.Config{
+		ProjectKey: testProjectKey,
+		SecretKey:  testSecretKey,
+		Endpoint:   server.Endpoint(),
+		Exporters:  []aiko.Exporter{aiko.NewWriterExporter(&out)},
+	})
+	if err != nil {
+		t.Fatalf("init monitor: %v", err)
+	}
+
+	monitor.AddEvent(aiko.Event{
+		URL:            "/writer",
+		Endpoint:       "/writer",
+		Method:         "post",
+		StatusCode:     201,
+		RequestHeaders: map[string]string{"Authorization": "Bearer secret", "X-Aiko-Peer-Ip": "203.0.113.9"},
+		RequestBody:    map[string]any{"password": "hunter2"},
+	})
+
+	if _, err := server.WaitForEvent(3 * time.Second); err != nil {
+		t.Fatalf("wait for event: %v", err)
+	}
+	shutdownMonitor(t, monitor)
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("expected one NDJSON line, got %q", out.String())
+	}
+	var evt aiko.Event
+	if err := json.Unmarshal([]byte(lines[0]), &evt); err != nil {
+		t.Fatalf("decode line: %v", err)
+	}
+	if evt.Method != "POST" || evt.Endpoint != "/writer" {
+		t.Fatalf("unexpected event: %#v", evt)
+	}
+	if evt.RequestHeaders["authorization"] != "[REDACTED]" {
+		t.Fatalf("expected authorization redacted, got %#v", evt.RequestHeaders)
+	}
+	if _, ok := evt.RequestHeaders["x-aiko-peer-ip"]; ok {
+		t.Fatalf("expected internal peer ip header stripped, got %#v", evt.RequestHeaders)
+	}
+	if evt.RequestBody.(map[string]any)["password"] != "[REDACTED]" {
+		t.Fatalf("expected password redacted, got %#v", evt.RequestBody)
+	}
+}
+
+func TestExportersWithoutKeysSkipIngest(t *testing.T) {
+	recorder := &recordingExporter{}
+	monitor, err := aiko.New(aiko.Config{Exporters: []aiko.Exporter{recorder}})
+	if err != nil {
+		t.Fatalf("init monitor: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		monitor.AddEvent(aiko.Event{URL: "/local", Endpoint: "/local", Method: "GET", StatusCode: 200})
+	}
+	shutdownMonitor(t, monitor)
+
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	if len(recorder.events) != 3 {
+		t.Fatalf("expected 3 exported events, got %d", len(recorder.events))
+	}
+	if !recorder.flushed || !recorder.shutdown {
+		t.Fatal("expected exporter to be flushed and shut down")
+	}
+}
+
+func TestFailingExporterDoesNotBlockOthers(t *testing.T) {
+	server, err := testserver.StartMockServer(testSecretKey, testProjectKey)
+	if err != nil {
+		t.Fatalf("start mock server: %v", err)
+	}
+	defer server.Stop()
+
+	failing := &recordingExporter{failures: []error{errors.New("disk full")}}
+	monitor, err := aiko.New(aiko.Config{
+		ProjectKey: testProjectKey,
+		SecretKey:  testSecretKey,
+		Endpoint:   server.Endpoint(),
+		Exporters:  []aiko.Exporter{failing},
+	})
+	if err != nil {
+		t.Fatalf("init monitor: %v", err)
+	}
+
+	monitor.AddEvent(aiko.Event{URL: "/isolated", Endpoint: "/isolated", Method: "GET", StatusCode: 200})
+	if _, err := server.WaitForEvent(3 * time.Second); err != nil {
+		t.Fatalf("wait for event: %v", err)
+	}
+	shutdownMonitor(t, monitor)
+
+	failing.mu.Lock()
+	defer failing.mu.Unlock()
+	if failing.calls != 1 {
+		t.Fatalf("expected non-retryable failure to be attempted once, got %d", failing.calls)
+	}
+	if len(failing.events) != 0 {
+		t.Fatalf("expected failing exporter to record nothing, got %d", len(failing.events))
+	}
+}
+
+func TestExporterRetriesRetryableErrors(t *testing.T) {
+	recorder := &recordingExporter{failures: []error{retryableErr{}}}
+	monitor, err := aiko.New(aiko.Config{Exporters: []aiko.Exporter{recorder}})
+	if err != nil {
+		t.Fatalf("init monitor: %v", err)
+	}
+
+	monitor.AddEvent(aiko.Event{URL: "/retry", Endpoint: "/retry", Method: "GET", StatusCode: 200})
+	shutdownMonitor(t, monitor)
+
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	if recorder.calls != 2 {
+		t.Fatalf("expected 2 export calls, got %d", recorder.calls)
+	}
+	if len(recorder.events) != 1 {
+		t.Fatalf("expected event delivered after retry, got %d", len(recorder.events))
+	}
+}
+
+func TestSlogExporterEmitsStructuredEvent(t *testing.T) {
+	var out lockedBuffer
+	logger := slog.New(slog.NewJSONHandler(&out, nil))
+	monitor, err := aiko.New(aiko.Config{
+		Exporters: []aiko.Exporter{aiko.NewSlogExporter(logger, slog.LevelInfo)},
+	})
+	if err != nil {
+		t.Fatalf("init monitor: %v", err)
+	}
+
+	monitor.AddEvent(aiko.Event{
+		URL:            "/slog",
+		Endpoint:       "/slog",
+		Method:         "GET",
+		StatusCode:     404,
+		DurationMS:     7,
+		RequestHeaders: map[string]string{"x-forwarded-for": "198.51.100.4"},
+	})
+	shutdownMonitor(t, monitor)
+
+	var record map[string]any
+	if err := json.Unmarshal([]byte(strings.TrimSpace(out.String())), &record); err != nil {
+		t.Fatalf("decode slog record %q: %v", out.String(), err)
+	}
+	if record["msg"] != "aiko event" {
+		t.Fatalf("unexpected message: %#v", record)
+	}
+	if record["endpoint"] != "/slog" || record["status_code"] != float64(404) || record["duration_ms"] != float64(7) {
+		t.Fatalf("unexpected attributes: %#v", record)
+	}
+	if record["client_ip"] != "198.51.100.4" {
+		t.Fatalf("expected client_ip attribute, got %#v", record["client_ip"])
+	}
+}
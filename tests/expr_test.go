@@ -0,0 +1,151 @@
+package aiko_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	aiko "github.com/aikocorp/aiko-monitor-go/aiko"
+	"github.com/aikocorp/aiko-monitor-go/aikotest"
+	"github.com/valyala/fasthttp"
+)
+
+func TestExpressionEvaluatesEventFields(t *testing.T) {
+	evt := aiko.Event{
+		ID:              "evt_1",
+		URL:             "/api/orders/7?page=2",
+		Endpoint:        "/api/orders/7?page=2",
+		Method:          "POST",
+		StatusCode:      503,
+		DurationMS:      2500,
+		Actor:           &aiko.ActorContext{Provider: aiko.ActorProviderJWT, ID: "u_1", OrgID: "acme"},
+		RequestHeaders:  map[string]string{"user-agent": "curl/8.4", "x-tenant": "Acme"},
+		ResponseHeaders: map[string]string{"content-type": "application/json"},
+	}
+	for expr, want := range map[string]bool{
+		`status >= 500 || duration > 2s || actor.org_id == "acme"`: true,
+		`status >= 500 and duration > 3s`:                          false,
+		`duration >= 2500ms && duration < 1m`:                      true,
+		`method in ["PUT", "POST"]`:                                true,
+		`method not in ["PUT", "POST"]`:                            false,
+		`status in [500, 503]`:                                     true,
+		`path matches "/api/**" && !(endpoint matches "/api/*")`:   true,
+		`path == "/api/orders/7"`:                                  true,
+		`request.headers["User-Agent"] matches "curl/*"`:           true,
+		`lower(request.headers["x-tenant"]) == actor.org_id`:       true,
+		`contains(url, "page=") and starts_with(path, "/api")`:     true,
+		`ends_with(response.headers["content-type"], "json")`:      true,
+		`len(trim(request.headers["missing"])) == 0`:               true,
+		`has_actor && actor.email == ""`:                           true,
+		`not has_actor or upper(actor.provider) == "JWT"`:          true,
+		`status < 400 || id != 'evt_1'`:                            false,
+	} {
+		compiled, err := aiko.CompileExpression(expr)
+		if err != nil {
+			t.Fatalf("compile %q: %v", expr, err)
+		}
+		if got := compiled.Match(evt); got != want {
+			t.Fatalf("%q = %t, want %t", expr, got, want)
+		}
+	}
+	if compiled, _ := aiko.CompileExpression(`has_actor || actor.id == ""`); !compiled.Match(aiko.Event{}) {
+		t.Fatal("actor fields should read as empty strings without an actor")
+	}
+}
+
+func TestExpressionCompileErrors(t *testing.T) {
+	for expr, want := range map[string]string{
+		`stauts >= 500`:                   `column 1: unknown field "stauts"; did you mean "status"?`,
+		`status >= "500"`:                 `column 8: cannot compare number with string`,
+		`status`:                          `expression must be a boolean, got number`,
+		`status > 500 &&`:                 `column 16: unexpected end of expression`,
+		`duration > 2d`:                   `column 13: unknown duration unit "d"`,
+		`method in "POST"`:                `in needs a [list] on the right, got string`,
+		`method in [1, 2]`:                `cannot look for a string in a list of number`,
+		`lowr(method) == "get"`:           `unknown function "lowr"; did you mean "lower"?`,
+		`contains(method)`:                `contains takes 2 argument(s), got 1`,
+		`path matches endpoint`:           `matches needs a string on the left and a string literal pattern`,
+		`path matches "/api/["`:           `invalid pattern "/api/["`,
+		`method == "GET" & status == 200`: `column 17: unexpected character "&"`,
+		`request.headers.host == "a"`:     `unknown field "request.headers.host"`,
+		`status == 200 || "x"`:            `"||" needs boolean operands, got string`,
+		`"unterminated == method`:         `column 1: unterminated string`,
+		strings.Repeat("(", 100) + "true": `nested more than 64 levels deep`,
+		`has_actor > false`:               `">" cannot compare boolean values`,
+	} {
+		_, err := aiko.CompileExpression(expr)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("compile %q: expected error containing %q, got %v", expr, want, err)
+		}
+	}
+}
+
+func TestCaptureWhenDropsEventsAndBodiesWhenStripsBodies(t *testing.T) {
+	recorder := aikotest.NewTestRecorder(t, aiko.Config{
+		Capture: aiko.CaptureConfig{
+			When:       `status >= 400 || path matches "/orders/**"`,
+			BodiesWhen: `status >= 500`,
+		},
+	})
+	handler := aiko.NetHTTPMiddleware(recorder.Monitor())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/fail":
+			w.WriteHeader(http.StatusInternalServerError)
+		case "/missing":
+			w.WriteHeader(http.StatusNotFound)
+		}
+		_, _ = w.Write([]byte(`{"ok":false}`))
+	}))
+	for _, target := range []string{"/fail", "/missing", "/orders/1", "/listing"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, target, strings.NewReader(`{"a":1}`)))
+	}
+	if err := recorder.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, evt := range recorder.Events() {
+		got = append(got, evt.Endpoint)
+		hasBodies := evt.RequestBody != nil && evt.ResponseBody != nil
+		if hasBodies != (evt.StatusCode >= 500) {
+			t.Fatalf("unexpected bodies on %s: request=%v response=%v", evt.Endpoint, evt.RequestBody, evt.ResponseBody)
+		}
+	}
+	sort.Strings(got)
+	if strings.Join(got, ",") != "/fail,/missing,/orders/1" {
+		t.Fatalf("unexpected kept endpoints %v", got)
+	}
+
+	fastRecorder := aikotest.NewTestRecorder(t, aiko.Config{
+		Capture: aiko.CaptureConfig{BodiesWhen: `status >= 500 && request.headers["x-debug"] == "1"`},
+	})
+	fastHandler := aiko.FastHTTPMiddleware(fastRecorder.Monitor(), func(ctx *fasthttp.RequestCtx) {
+		ctx.SetStatusCode(fasthttp.StatusBadGateway)
+		ctx.SetBodyString(`{"ok":false}`)
+	})
+	for _, debug := range []string{"1", "0"} {
+		var ctx fasthttp.RequestCtx
+		ctx.Request.Header.SetMethod(fasthttp.MethodPost)
+		ctx.Request.Header.Set("X-Debug", debug)
+		ctx.Request.SetRequestURI("/fast?debug=" + debug)
+		ctx.Request.SetBodyString(`{"a":1}`)
+		fastHandler(&ctx)
+	}
+	if err := fastRecorder.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for _, evt := range fastRecorder.Events() {
+		hasBodies := evt.RequestBody != nil && evt.ResponseBody != nil
+		if hasBodies != (evt.Endpoint == "/fast?debug=1") {
+			t.Fatalf("unexpected bodies on %s: request=%v response=%v", evt.Endpoint, evt.RequestBody, evt.ResponseBody)
+		}
+	}
+
+	_, err := aikotest.NewRecorder(aiko.Config{Capture: aiko.CaptureConfig{BodiesWhen: "duraton > 1s"}})
+	if err == nil || !strings.Contains(err.Error(), `capture.bodiesWhen: column 1: unknown field "duraton"; did you mean "duration"?`) {
+		t.Fatalf("expected bodiesWhen compile error, got %v", err)
+	}
+}
@@ -0,0 +1,145 @@
+package aiko_test
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	aiko "github.com/aikocorp/aiko-monitor-go/aiko"
+	testserver "github.com/aikocorp/aiko-monitor-go/tests/mockserver"
+)
+
+func TestIngestFailsOverAndFailsBack(t *testing.T) {
+	var down atomic.Bool
+	down.Store(true)
+	accepted := make(chan struct{}, 10)
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		if down.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+		accepted <- struct{}{}
+	}))
+	defer primary.Close()
+
+	secondary, err := testserver.StartMockServer(testSecretKey, testProjectKey)
+	if err != nil {
+		t.Fatalf("start mock server: %v", err)
+	}
+	defer secondary.Stop()
+
+	var logs lockedBuffer
+	monitor, err := aiko.New(aiko.Config{
+		ProjectKey:        testProjectKey,
+		SecretKey:         testSecretKey,
+		Endpoints:         []string{primary.URL + "/api/ingest", secondary.Endpoint()},
+		FailoverThreshold: 2,
+		FailbackInterval:  1500 * time.Millisecond,
+		Verbose:           true,
+		Logger:            log.New(&logs, "", 0),
+	})
+	if err != nil {
+		t.Fatalf("init monitor: %v", err)
+	}
+
+	monitor.AddEvent(aiko.Event{URL: "/failover", Endpoint: "/failover", Method: "GET", StatusCode: 200})
+	if _, err := secondary.WaitForEvent(5 * time.Second); err != nil {
+		t.Fatalf("expected secondary to receive event: %v\n%s", err, logs.String())
+	}
+
+	down.Store(false)
+	time.Sleep(1600 * time.Millisecond)
+	monitor.AddEvent(aiko.Event{URL: "/failback", Endpoint: "/failback", Method: "GET", StatusCode: 200})
+	select {
+	case <-accepted:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected primary to receive event after fail-back")
+	}
+	shutdownMonitor(t, monitor)
+
+	output := logs.String()
+	for _, expected := range []string{
+		"ingest endpoint unhealthy endpoint=" + primary.URL,
+		"ingest_endpoint=" + secondary.Endpoint(),
+		"ingest endpoint recovered endpoint=" + primary.URL,
+		"ingest_endpoint=" + primary.URL,
+	} {
+		if !strings.Contains(output, expected) {
+			t.Fatalf("expected logs to contain %q, got %q", expected, output)
+		}
+	}
+}
+
+func TestNewRejectsEndpointWithEndpoints(t *testing.T) {
+	_, err := aiko.New(aiko.Config{
+		ProjectKey: testProjectKey,
+		SecretKey:  testSecretKey,
+		Endpoint:   "http://localhost:8080/api/ingest",
+		Endpoints:  []string{"http://localhost:8081/api/ingest"},
+	})
+	if err == nil {
+		t.Fatal("expected error when endpoint and endpoints are both set")
+	}
+
+	_, err = aiko.New(aiko.Config{
+		ProjectKey: testProjectKey,
+		SecretKey:  testSecretKey,
+		Endpoints:  []string{"http://localhost:8080/api/ingest", "https://example.com/ingest"},
+	})
+	if err == nil || !strings.Contains(err.Error(), "endpoints[1]") {
+		t.Fatalf("expected endpoints[1] validation error, got %v", err)
+	}
+}
+
+func TestRateLimitedEndpointStaysHealthy(t *testing.T) {
+	limited := make(chan struct{}, 10)
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		limited <- struct{}{}
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer primary.Close()
+
+	secondary, err := testserver.StartMockServer(testSecretKey, testProjectKey)
+	if err != nil {
+		t.Fatalf("start mock server: %v", err)
+	}
+	defer secondary.Stop()
+
+	var logs lockedBuffer
+	monitor, err := aiko.New(aiko.Config{
+		ProjectKey:        testProjectKey,
+		SecretKey:         testSecretKey,
+		Endpoints:         []string{primary.URL + "/api/ingest", secondary.Endpoint()},
+		FailoverThreshold: 1,
+		Verbose:           true,
+		Logger:            log.New(&logs, "", 0),
+	})
+	if err != nil {
+		t.Fatalf("init monitor: %v", err)
+	}
+
+	monitor.AddEvent(aiko.Event{URL: "/limited", Endpoint: "/limited", Method: "GET", StatusCode: 200})
+	for i := 0; i < 3; i++ {
+		select {
+		case <-limited:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("expected every attempt to stay on the rate limited endpoint, got %d\n%s", i, logs.String())
+		}
+	}
+	shutdownMonitor(t, monitor)
+
+	if events := secondary.Events(); len(events) != 0 {
+		t.Fatalf("expected no failover on 429, secondary got %d events", len(events))
+	}
+	if strings.Contains(logs.String(), "ingest endpoint unhealthy") {
+		t.Fatalf("expected 429 not to mark the endpoint unhealthy, got %q", logs.String())
+	}
+}
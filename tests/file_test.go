@@ -0,0 +1,287 @@
+package aiko_test
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	aiko "github.com/aikocorp/aiko-monitor-go/aiko"
+)
+
+func fileTestEvent(i int) aiko.Event {
+	url := fmt.Sprintf("/files/%d", i)
+	return aiko.Event{
+		ID:              fmt.Sprintf("evt_%03d", i),
+		URL:             url,
+		Endpoint:        url,
+		Method:          "GET",
+		StatusCode:      200,
+		RequestHeaders:  map[string]string{"authorization": "[REDACTED]"},
+		ResponseHeaders: map[string]string{},
+		Timestamp:       "2026-01-01T00:00:00Z",
+		DurationMS:      int64(i),
+	}
+}
+
+func TestFileExporterWritesGzipEventCompatibleFiles(t *testing.T) {
+	dir := t.TempDir()
+	exporter, err := aiko.NewFileExporter(aiko.FileExporterConfig{Dir: dir, Gzip: true})
+	if err != nil {
+		t.Fatalf("new file exporter: %v", err)
+	}
+
+	events := []aiko.Event{fileTestEvent(1), fileTestEvent(2)}
+	if err := exporter.Export(context.Background(), events); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+
+	if files, _ := exporter.ClosedFiles(); len(files) != 0 {
+		t.Fatalf("expected active file to stay hidden from shippers, got %v", files)
+	}
+	matches, _ := filepath.Glob(filepath.Join(dir, "*.tmp"))
+	if len(matches) != 1 {
+		t.Fatalf("expected one active .tmp file, got %v", matches)
+	}
+
+	if err := exporter.Shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+	files, err := exporter.ClosedFiles()
+	if err != nil || len(files) != 1 {
+		t.Fatalf("expected one closed file, got %v (%v)", files, err)
+	}
+	if !strings.HasSuffix(files[0], ".ndjson.gz") {
+		t.Fatalf("expected .ndjson.gz file, got %s", files[0])
+	}
+
+	raw, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatalf("read file: %v", err)
+	}
+	var expected []byte
+	for _, evt := range events {
+		payload, err := aiko.GzipEvent(evt)
+		if err != nil {
+			t.Fatalf("gzip event: %v", err)
+		}
+		expected = append(expected, payload...)
+	}
+	if !bytes.Equal(raw, expected) {
+		t.Fatal("expected file to be a concatenation of GzipEvent payloads")
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("gzip reader: %v", err)
+	}
+	decoded, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("read gzip: %v", err)
+	}
+	if lines := strings.Split(strings.TrimSpace(string(decoded)), "\n"); len(lines) != 2 {
+		t.Fatalf("expected 2 NDJSON lines, got %d", len(lines))
+	}
+}
+
+func TestFileExporterRotatesBySizeAndEnforcesRetention(t *testing.T) {
+	dir := t.TempDir()
+	exporter, err := aiko.NewFileExporter(aiko.FileExporterConfig{
+		Dir:          dir,
+		Prefix:       "capture",
+		MaxFileBytes: 1,
+		MaxFiles:     3,
+	})
+	if err != nil {
+		t.Fatalf("new file exporter: %v", err)
+	}
+
+	for i := 0; i < 5; i++ {
+		if err := exporter.Export(context.Background(), []aiko.Event{fileTestEvent(i)}); err != nil {
+			t.Fatalf("export %d: %v", i, err)
+		}
+	}
+	if err := exporter.Shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+
+	files, err := exporter.ClosedFiles()
+	if err != nil {
+		t.Fatalf("closed files: %v", err)
+	}
+	if len(files) != 3 {
+		t.Fatalf("expected retention to keep 3 files, got %v", files)
+	}
+
+	var ids []string
+	for _, path := range files {
+		if !strings.HasPrefix(filepath.Base(path), "capture-") || !strings.HasSuffix(path, ".ndjson") {
+			t.Fatalf("unexpected file name %s", path)
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatalf("open: %v", err)
+		}
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			var evt aiko.Event
+			if err := json.Unmarshal(scanner.Bytes(), &evt); err != nil {
+				t.Fatalf("decode line: %v", err)
+			}
+			ids = append(ids, evt.ID)
+		}
+		_ = f.Close()
+	}
+	if strings.Join(ids, ",") != "evt_002,evt_003,evt_004" {
+		t.Fatalf("expected newest events retained in order, got %v", ids)
+	}
+}
+
+func TestNewFileExporterRequiresDir(t *testing.T) {
+	if _, err := aiko.NewFileExporter(aiko.FileExporterConfig{}); err == nil {
+		t.Fatal("expected missing dir error")
+	}
+}
+
+func TestFileExporterKeepsClientIP(t *testing.T) {
+	for _, gz := range []bool{false, true} {
+		dir := t.TempDir()
+		exporter, err := aiko.NewFileExporter(aiko.FileExporterConfig{Dir: dir, Gzip: gz})
+		if err != nil {
+			t.Fatalf("new file exporter: %v", err)
+		}
+		events := []aiko.Event{fileTestEvent(1).WithClientIP("198.51.100.4"), fileTestEvent(2)}
+		if err := exporter.Export(context.Background(), events); err != nil {
+			t.Fatalf("export: %v", err)
+		}
+		if err := exporter.Shutdown(context.Background()); err != nil {
+			t.Fatalf("shutdown: %v", err)
+		}
+		files, err := exporter.ClosedFiles()
+		if err != nil || len(files) != 1 {
+			t.Fatalf("expected one closed file, got %v (%v)", files, err)
+		}
+		read, err := aiko.ReadEventFile(files[0])
+		if err != nil {
+			t.Fatalf("read event file (gzip=%v): %v", gz, err)
+		}
+		if len(read) != 2 || read[0].ID != "evt_001" || read[0].ClientIP() != "198.51.100.4" || read[1].ClientIP() != "" {
+			t.Fatalf("expected client IP to survive the file (gzip=%v), got %+v", gz, read)
+		}
+		if gz {
+			// the member content is still exactly what GzipEvent sends
+			raw, _ := os.ReadFile(files[0])
+			zr, err := gzip.NewReader(bytes.NewReader(raw))
+			if err != nil {
+				t.Fatalf("gzip reader: %v", err)
+			}
+			zr.Multistream(false)
+			got, _ := io.ReadAll(zr)
+			want, _ := json.Marshal(events[0])
+			if string(got) != string(want)+"\n" {
+				t.Fatalf("expected the first member to hold the event JSON, got %s", got)
+			}
+		}
+	}
+}
+
+func TestNewFileExporterFinalizesLeftoverActiveFiles(t *testing.T) {
+	for _, gz := range []bool{false, true} {
+		dir := t.TempDir()
+		var complete []byte
+		for i := 1; i <= 2; i++ {
+			evt := fileTestEvent(i)
+			if gz {
+				payload, err := aiko.GzipEvent(evt)
+				if err != nil {
+					t.Fatalf("gzip event: %v", err)
+				}
+				complete = append(complete, payload...)
+				continue
+			}
+			line, _ := json.Marshal(evt)
+			complete = append(append(complete, line...), '\n')
+		}
+		// a crash cut the last write short
+		torn := append(append([]byte(nil), complete...), complete[:len(complete)/3]...)
+		ext := ".ndjson"
+		if gz {
+			ext = ".ndjson.gz"
+		}
+		crashed := filepath.Join(dir, "aiko-events-20260101T000000.000000000Z-000001"+ext)
+		if err := os.WriteFile(crashed+".tmp", torn, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		empty := filepath.Join(dir, "aiko-events-20260101T000000.000000000Z-000002"+ext)
+		if err := os.WriteFile(empty+".tmp", complete[:5], 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		exporter, err := aiko.NewFileExporter(aiko.FileExporterConfig{Dir: dir, Gzip: gz})
+		if err != nil {
+			t.Fatalf("new file exporter: %v", err)
+		}
+		files, err := exporter.ClosedFiles()
+		if err != nil || len(files) != 1 || files[0] != crashed {
+			t.Fatalf("expected the leftover file to be finalized (gzip=%v), got %v (%v)", gz, files, err)
+		}
+		if matches, _ := filepath.Glob(filepath.Join(dir, "*.tmp")); len(matches) != 0 {
+			t.Fatalf("expected no .tmp files after recovery, got %v", matches)
+		}
+		read, err := aiko.ReadEventFile(crashed)
+		if err != nil || len(read) != 2 {
+			t.Fatalf("expected the two complete events (gzip=%v), got %d (%v)", gz, len(read), err)
+		}
+		if err := exporter.Shutdown(context.Background()); err != nil {
+			t.Fatalf("shutdown: %v", err)
+		}
+	}
+}
+
+func TestFileExporterLeavesFilesOfAnotherPrefixAlone(t *testing.T) {
+	dir := t.TempDir()
+	line, _ := json.Marshal(fileTestEvent(0))
+	line = append(line, '\n')
+	other := filepath.Join(dir, "aiko-events-20260101T000000.000000000Z-000001.ndjson")
+	otherActive := filepath.Join(dir, "aiko-events-20260101T000000.000000000Z-000002.ndjson.tmp")
+	for _, path := range []string{other, otherActive} {
+		if err := os.WriteFile(path, line, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	exporter, err := aiko.NewFileExporter(aiko.FileExporterConfig{
+		Dir:          dir,
+		Prefix:       "aiko",
+		MaxFileBytes: 1,
+		MaxFiles:     1,
+	})
+	if err != nil {
+		t.Fatalf("new file exporter: %v", err)
+	}
+	for i := 1; i <= 2; i++ {
+		if err := exporter.Export(context.Background(), []aiko.Event{fileTestEvent(i)}); err != nil {
+			t.Fatalf("export %d: %v", i, err)
+		}
+	}
+	if err := exporter.Shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+
+	files, err := exporter.ClosedFiles()
+	if err != nil || len(files) != 1 || strings.HasPrefix(filepath.Base(files[0]), "aiko-events-") {
+		t.Fatalf("expected only this exporter's newest file, got %v (%v)", files, err)
+	}
+	for _, path := range []string{other, otherActive} {
+		if _, err := os.Stat(path); err != nil {
+			t.Fatalf("expected %s to be left alone: %v", filepath.Base(path), err)
+		}
+	}
+}
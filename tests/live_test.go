@@ -0,0 +1,131 @@
+package aiko_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	aiko "github.com/aikocorp/aiko-monitor-go/aiko"
+	"github.com/aikocorp/aiko-monitor-go/aikotest"
+)
+
+func TestMonitorUpdatePausesCaptureAndBodies(t *testing.T) {
+	recorder := aikotest.NewTestRecorder(t, aiko.Config{})
+	monitor := recorder.Monitor()
+	var seen []string
+	handler := aiko.NetHTTPMiddleware(monitor)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		seen = append(seen, string(body))
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"ok":true}`))
+	}))
+	post := func(path string) {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, path, strings.NewReader(`{"n":1}`)))
+	}
+
+	if err := monitor.Update(func(cfg *aiko.DynamicConfig) { cfg.Enabled = false }); err != nil {
+		t.Fatalf("pause: %v", err)
+	}
+	if monitor.Enabled() {
+		t.Fatal("expected Enabled to report the pause")
+	}
+	post("/paused")
+	monitor.AddEvent(aiko.Event{URL: "/manual", Endpoint: "/manual", Method: "GET", StatusCode: 200})
+
+	if err := monitor.Update(func(cfg *aiko.DynamicConfig) {
+		cfg.Enabled = true
+		cfg.CaptureBodies = false
+	}); err != nil {
+		t.Fatalf("resume: %v", err)
+	}
+	post("/metadata-only")
+	events, err := recorder.WaitForEvents(1, 2*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aikotest.AssertEvent(t, events[0], aikotest.Endpoint("/metadata-only"), aikotest.Status(http.StatusOK))
+	if events[0].RequestBody != nil || events[0].ResponseBody != nil {
+		t.Fatalf("expected no bodies, got %v / %v", events[0].RequestBody, events[0].ResponseBody)
+	}
+	if len(seen) != 2 || seen[0] != `{"n":1}` || seen[1] != `{"n":1}` {
+		t.Fatalf("expected the handler to read the body in both modes, got %q", seen)
+	}
+	if err := recorder.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(recorder.Events()); got != 1 {
+		t.Fatalf("expected nothing captured while paused, got %d events", got)
+	}
+}
+
+func TestMonitorUpdateValidatesAndPublishesAtomically(t *testing.T) {
+	recorder := aikotest.NewTestRecorder(t, aiko.Config{Sampling: aiko.SamplingConfig{Rate: 0.5}})
+	monitor := recorder.Monitor()
+
+	err := monitor.Update(func(cfg *aiko.DynamicConfig) {
+		cfg.Verbose = true
+		cfg.Sampling.Rate = 4
+	})
+	if err == nil || !strings.Contains(err.Error(), "sampling.rate") {
+		t.Fatalf("expected sampling validation error, got %v", err)
+	}
+	if got := monitor.DynamicConfig(); got.Verbose || got.Sampling.Rate != 0.5 {
+		t.Fatalf("expected a rejected update to change nothing, got %+v", got)
+	}
+
+	handler := aiko.NetHTTPMiddleware(monitor)(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/busy", nil))
+			}
+		}()
+	}
+	for i := 0; i < 50; i++ {
+		headers := []string{"x-a"}
+		if i%2 == 0 {
+			headers = nil
+		}
+		if err := monitor.Update(func(cfg *aiko.DynamicConfig) {
+			cfg.Redaction.Headers = headers
+			cfg.Sampling.Rate = 1
+		}); err != nil {
+			t.Fatalf("update: %v", err)
+		}
+	}
+	wg.Wait()
+
+	if err := aiko.NewNoop().Update(func(cfg *aiko.DynamicConfig) { cfg.Enabled = true }); err == nil {
+		t.Fatal("expected a disabled monitor to refuse Enabled=true")
+	}
+}
+
+func TestMonitorUpdateCannotEditTheLiveActorConfig(t *testing.T) {
+	recorder := aikotest.NewTestRecorder(t, aiko.Config{Actor: aiko.ActorConfig{
+		Provider: aiko.ActorProviderJWT,
+		Token: aiko.ActorTokenConfig{Header: &aiko.ActorHeaderTokenConfig{
+			Name:    "authorization",
+			Extract: aiko.ActorTokenExtractBearer(),
+		}},
+		Claims: aiko.ActorClaimsConfig{ID: "sub", Email: "email"},
+	}})
+	monitor := recorder.Monitor()
+
+	err := monitor.Update(func(cfg *aiko.DynamicConfig) {
+		cfg.Actor.Token.Header.Name = "x-user"
+		cfg.Sampling.Rate = 4
+	})
+	if err == nil {
+		t.Fatal("expected the update to be rejected")
+	}
+	if got := monitor.DynamicConfig().Actor.Token.Header.Name; got != "authorization" {
+		t.Fatalf("expected a rejected update to leave the actor header alone, got %q", got)
+	}
+}
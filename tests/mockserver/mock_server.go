@@ -1,206 +1,85 @@
+// Package mockserver adapts aikotest.IngestServer to the helpers the tests in
+// this repository use.
 package mockserver
 
 import (
-	"bytes"
-	"compress/gzip"
-	"crypto/hmac"
-	"crypto/sha256"
-	"encoding/base64"
-	"encoding/hex"
-	"encoding/json"
 	"fmt"
-	"io"
-	"net"
 	"net/http"
-	"net/http/httptest"
 	"sync"
 	"time"
 
 	aiko "github.com/aikocorp/aiko-monitor-go/aiko"
+	"github.com/aikocorp/aiko-monitor-go/aikotest"
 )
 
 type MockServer struct {
-	projectKey string
-	secret     []byte
+	*aikotest.IngestServer
 
-	srv *httptest.Server
-
-	mu        sync.Mutex
-	events    []aiko.Event
-	attempts  []int
-	responses []int
-	requests  []http.Header
-
-	eventCh chan aiko.Event
+	// mu guards next, the index of the event WaitForEvent returns next.
+	mu   sync.Mutex
+	next int
 }
 
 func StartMockServer(secretKey, projectKey string) (*MockServer, error) {
-	secret, err := base64.RawURLEncoding.DecodeString(secretKey)
-	if err != nil {
-		return nil, fmt.Errorf("decode secret: %w", err)
-	}
-
-	ms := &MockServer{
-		projectKey: projectKey,
-		secret:     secret,
-		eventCh:    make(chan aiko.Event, 100),
-	}
-
-	listener, err := net.Listen("tcp4", "127.0.0.1:0")
+	srv, err := aikotest.NewIngestServer(projectKey, secretKey)
 	if err != nil {
-		return nil, fmt.Errorf("listen tcp4: %w", err)
-	}
-
-	server := httptest.NewUnstartedServer(http.HandlerFunc(ms.handle))
-	server.Listener = listener
-	server.Start()
-
-	ms.srv = server
-	return ms, nil
-}
-
-func (m *MockServer) handle(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		w.WriteHeader(http.StatusMethodNotAllowed)
-		return
-	}
-
-	if r.URL.Path != "/api/ingest" {
-		w.WriteHeader(http.StatusNotFound)
-		return
-	}
-
-	body, err := io.ReadAll(r.Body)
-	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		return
-	}
-	_ = r.Body.Close()
-
-	if r.Header.Get("X-Project-Key") != m.projectKey {
-		w.WriteHeader(http.StatusUnauthorized)
-		return
-	}
-
-	expectedSig := hex.EncodeToString(sign(m.secret, body))
-	if !hmac.Equal([]byte(r.Header.Get("X-Signature")), []byte(expectedSig)) {
-		w.WriteHeader(http.StatusForbidden)
-		return
-	}
-
-	event, err := decodeEvent(body)
-	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		return
-	}
-
-	m.mu.Lock()
-	clone := cloneHeader(r.Header)
-	status := http.StatusOK
-	if len(m.responses) > 0 {
-		status = m.responses[0]
-		m.responses = m.responses[1:]
+		return nil, fmt.Errorf("start ingest server: %w", err)
 	}
-	m.attempts = append(m.attempts, status)
-	requestID := fmt.Sprintf("req_%d", len(m.attempts))
-	m.requests = append(m.requests, clone)
-	if status >= 200 && status < 300 {
-		m.events = append(m.events, event)
-		select {
-		case m.eventCh <- event:
-		default:
-		}
-	}
-	m.mu.Unlock()
-
-	w.Header().Set("X-Request-Id", requestID)
-	w.WriteHeader(status)
+	return &MockServer{IngestServer: srv}, nil
 }
 
-func decodeEvent(body []byte) (evt aiko.Event, err error) {
-	gr, err := gzip.NewReader(bytes.NewReader(body))
+// StartUnixMockServer serves the ingest protocol on a unix socket at
+// socketPath. Endpoint returns the matching unix:// URL.
+func StartUnixMockServer(secretKey, projectKey, socketPath string) (*MockServer, error) {
+	srv, err := aikotest.NewUnixIngestServer(socketPath, projectKey, secretKey)
 	if err != nil {
-		return aiko.Event{}, err
-	}
-	defer func() {
-		if cerr := gr.Close(); err == nil && cerr != nil {
-			err = cerr
-		}
-	}()
-
-	payload, err := io.ReadAll(gr)
-	if err != nil {
-		return aiko.Event{}, err
-	}
-
-	if err = json.Unmarshal(payload, &evt); err != nil {
-		return aiko.Event{}, err
+		return nil, fmt.Errorf("start unix ingest server: %w", err)
 	}
-	return evt, nil
-}
-
-func sign(secret, body []byte) []byte {
-	mac := hmac.New(sha256.New, secret)
-	mac.Write(body)
-	return mac.Sum(nil)
-}
-
-func (m *MockServer) Endpoint() string {
-	return m.srv.URL + "/api/ingest"
+	return &MockServer{IngestServer: srv}, nil
 }
 
 func (m *MockServer) SetResponses(statuses []int) {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-	m.responses = append([]int(nil), statuses...)
+	m.IngestServer.SetResponses(statuses...)
 }
 
-func (m *MockServer) Events() []aiko.Event {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-	out := make([]aiko.Event, len(m.events))
-	copy(out, m.events)
-	return out
+// Attempts returns the status answered to each verified request.
+func (m *MockServer) Attempts() []int {
+	return m.Statuses()
 }
 
-func (m *MockServer) Attempts() []int {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-	out := make([]int, len(m.attempts))
-	copy(out, m.attempts)
+func (m *MockServer) RequestHeaders() []http.Header {
+	requests := m.Requests()
+	out := make([]http.Header, len(requests))
+	for i, r := range requests {
+		out[i] = r.Header.Clone()
+	}
 	return out
 }
 
 func (m *MockServer) LastRequestHeaders() http.Header {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-	if len(m.requests) == 0 {
+	requests := m.Requests()
+	if len(requests) == 0 {
 		return http.Header{}
 	}
-	return cloneHeader(m.requests[len(m.requests)-1])
+	return requests[len(requests)-1].Header.Clone()
 }
 
+// WaitForEvent returns the next accepted event not yet returned by an
+// earlier call.
 func (m *MockServer) WaitForEvent(timeout time.Duration) (aiko.Event, error) {
-	select {
-	case evt := <-m.eventCh:
-		return evt, nil
-	case <-time.After(timeout):
-		return aiko.Event{}, fmt.Errorf("timeout waiting for event")
-	}
-}
-
-func cloneHeader(h http.Header) http.Header {
-	copyHeader := make(http.Header, len(h))
-	for key, values := range h {
-		copyHeader[key] = append([]string(nil), values...)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	events, err := m.WaitForEvents(m.next+1, timeout)
+	if err != nil {
+		return aiko.Event{}, fmt.Errorf("timeout waiting for event: %w", err)
 	}
-	return copyHeader
+	m.next++
+	return events[m.next-1], nil
 }
 
 func (m *MockServer) Stop() {
-	if m == nil || m.srv == nil {
+	if m == nil || m.IngestServer == nil {
 		return
 	}
-	m.srv.Close()
-	close(m.eventCh)
+	m.Close()
 }
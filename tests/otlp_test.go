@@ -0,0 +1,154 @@
+package aiko_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	aiko "github.com/aikocorp/aiko-monitor-go/aiko"
+)
+
+type otlpCollector struct {
+	mu       sync.Mutex
+	requests []map[string]any
+	headers  []http.Header
+	paths    []string
+}
+
+func (c *otlpCollector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	var decoded map[string]any
+	if err := json.Unmarshal(body, &decoded); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	c.mu.Lock()
+	c.requests = append(c.requests, decoded)
+	c.headers = append(c.headers, r.Header.Clone())
+	c.paths = append(c.paths, r.URL.Path)
+	c.mu.Unlock()
+	w.WriteHeader(http.StatusOK)
+}
+
+func otlpAttributes(t *testing.T, raw any) map[string]any {
+	t.Helper()
+	out := map[string]any{}
+	for _, item := range raw.([]any) {
+		kv := item.(map[string]any)
+		value := kv["value"].(map[string]any)
+		for _, v := range value {
+			out[kv["key"].(string)] = v
+		}
+	}
+	return out
+}
+
+func TestOTLPExporterPostsSpansToCollector(t *testing.T) {
+	collector := &otlpCollector{}
+	server := httptest.NewServer(collector)
+	defer server.Close()
+
+	exporter, err := aiko.NewOTLPExporter(aiko.OTLPExporterConfig{
+		Endpoint:    server.URL,
+		ServiceName: "checkout",
+		Headers:     map[string]string{"X-Collector-Token": "abc"},
+	})
+	if err != nil {
+		t.Fatalf("new otlp exporter: %v", err)
+	}
+
+	monitor, err := aiko.New(aiko.Config{Exporters: []aiko.Exporter{exporter}})
+	if err != nil {
+		t.Fatalf("init monitor: %v", err)
+	}
+	monitor.AddEvent(aiko.Event{
+		URL:        "/orders/42?expand=items",
+		Endpoint:   "/orders/42?expand=items",
+		Method:     "POST",
+		StatusCode: 503,
+		DurationMS: 120,
+		Actor:      &aiko.ActorContext{Provider: aiko.ActorProviderJWT, ID: "usr_1", Email: "a@example.com"},
+		RequestHeaders: map[string]string{
+			"traceparent":     "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			"x-forwarded-for": "198.51.100.7",
+			"authorization":   "Bearer secret",
+		},
+		RequestBody:  map[string]any{"password": "hunter2", "sku": "A1"},
+		ResponseBody: map[string]any{"error": "unavailable"},
+	})
+	shutdownMonitor(t, monitor)
+
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+	if len(collector.requests) != 1 {
+		t.Fatalf("expected one OTLP request, got %d", len(collector.requests))
+	}
+	if collector.paths[0] != "/v1/traces" {
+		t.Fatalf("expected default traces path, got %s", collector.paths[0])
+	}
+	if collector.headers[0].Get("X-Collector-Token") != "abc" || collector.headers[0].Get("Content-Type") != "application/json" {
+		t.Fatalf("unexpected headers: %#v", collector.headers[0])
+	}
+
+	resourceSpans := collector.requests[0]["resourceSpans"].([]any)[0].(map[string]any)
+	resource := otlpAttributes(t, resourceSpans["resource"].(map[string]any)["attributes"])
+	if resource["service.name"] != "checkout" {
+		t.Fatalf("expected service.name, got %#v", resource)
+	}
+
+	span := resourceSpans["scopeSpans"].([]any)[0].(map[string]any)["spans"].([]any)[0].(map[string]any)
+	if span["traceId"] != "4bf92f3577b34da6a3ce929d0e0e4736" || span["parentSpanId"] != "00f067aa0ba902b7" {
+		t.Fatalf("expected trace context from traceparent, got %v/%v", span["traceId"], span["parentSpanId"])
+	}
+	if span["name"] != "POST" || span["kind"] != float64(2) {
+		t.Fatalf("unexpected span name/kind: %v %v", span["name"], span["kind"])
+	}
+	if span["status"].(map[string]any)["code"] != float64(2) {
+		t.Fatalf("expected error status for 503, got %#v", span["status"])
+	}
+
+	attrs := otlpAttributes(t, span["attributes"])
+	expected := map[string]any{
+		"http.request.method":       "POST",
+		"url.path":                  "/orders/42",
+		"url.query":                 "expand=items",
+		"http.response.status_code": "503",
+		"client.address":            "198.51.100.7",
+		"enduser.id":                "usr_1",
+		"enduser.email":             "a@example.com",
+	}
+	for key, want := range expected {
+		if attrs[key] != want {
+			t.Fatalf("attribute %s: expected %v, got %v", key, want, attrs[key])
+		}
+	}
+
+	if _, ok := attrs["http.route"]; ok {
+		t.Fatalf("expected no http.route without a route template, got %v", attrs["http.route"])
+	}
+
+	events := span["events"].([]any)
+	if len(events) != 2 {
+		t.Fatalf("expected request/response span events, got %d", len(events))
+	}
+	request := otlpAttributes(t, events[0].(map[string]any)["attributes"])
+	if request["http.request.header.authorization"] != "[REDACTED]" {
+		t.Fatalf("expected redacted authorization header, got %v", request["http.request.header.authorization"])
+	}
+	var body map[string]any
+	if err := json.Unmarshal([]byte(request["aiko.request.body"].(string)), &body); err != nil {
+		t.Fatalf("decode request body attribute: %v", err)
+	}
+	if body["password"] != "[REDACTED]" || body["sku"] != "A1" {
+		t.Fatalf("expected redacted body, got %#v", body)
+	}
+}
+
+func TestNewOTLPExporterRejectsInvalidEndpoint(t *testing.T) {
+	if _, err := aiko.NewOTLPExporter(aiko.OTLPExporterConfig{Endpoint: "collector:4318"}); err == nil {
+		t.Fatal("expected invalid endpoint error")
+	}
+}
@@ -0,0 +1,126 @@
+package aiko_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	aiko "github.com/aikocorp/aiko-monitor-go/aiko"
+	"github.com/aikocorp/aiko-monitor-go/aikotest"
+)
+
+func TestProcessorsMutateReplaceAndDropInOrder(t *testing.T) {
+	recorder := aikotest.NewTestRecorder(t, aiko.Config{
+		Processors: []aiko.EventProcessor{
+			{Name: "drop-admins", Process: func(evt aiko.Event) (aiko.Event, bool) {
+				return evt, !strings.HasPrefix(evt.Endpoint, "/admin")
+			}},
+			{Name: "panics", Process: func(evt aiko.Event) (aiko.Event, bool) {
+				if evt.Endpoint == "/panic" {
+					panic("boom")
+				}
+				return evt, true
+			}},
+			{Name: "tenant", Process: func(evt aiko.Event) (aiko.Event, bool) {
+				evt.RequestHeaders["x-tenant"] = strings.Split(evt.RequestHeaders["host"], ".")[0]
+				return evt, true
+			}},
+			{Name: "scrub", Process: func(evt aiko.Event) (aiko.Event, bool) {
+				if body, ok := evt.RequestBody.(map[string]any); ok {
+					delete(body, "internal_note")
+				}
+				// secrets must still be redacted after processors run
+				evt.RequestHeaders["authorization"] = "Bearer secret"
+				return evt, true
+			}},
+		},
+	})
+	monitor := recorder.Monitor()
+	for _, endpoint := range []string{"/admin/users", "/orders", "/panic"} {
+		monitor.AddEvent(aiko.Event{
+			Endpoint:       endpoint,
+			Method:         "POST",
+			StatusCode:     200,
+			RequestHeaders: map[string]string{"host": "acme.example.com"},
+			RequestBody:    map[string]any{"id": 1, "internal_note": "vip"},
+		})
+	}
+	events, err := recorder.WaitForEvents(2, 2*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, evt := range events {
+		if strings.HasPrefix(evt.Endpoint, "/admin") {
+			t.Fatalf("admin event should be dropped: %+v", evt)
+		}
+		aikotest.AssertEvent(t, evt,
+			aikotest.RequestHeader("x-tenant", "acme"),
+			aikotest.RequestHeader("authorization", "[REDACTED]"),
+		)
+		if _, ok := evt.RequestBody.(map[string]any)["internal_note"]; ok {
+			t.Fatalf("internal_note should be scrubbed: %+v", evt.RequestBody)
+		}
+	}
+
+	stats := monitor.ProcessorStats()
+	if len(stats) != 4 || stats[0].Name != "drop-admins" || stats[0].Processed != 3 || stats[0].Dropped != 1 {
+		t.Fatalf("unexpected drop stats: %+v", stats)
+	}
+	if stats[1].Processed != 2 || stats[1].Panics != 1 || stats[1].Dropped != 0 {
+		t.Fatalf("unexpected panic stats: %+v", stats[1])
+	}
+	if stats[3].Processed != 2 || stats[3].Duration <= 0 {
+		t.Fatalf("unexpected scrub stats: %+v", stats[3])
+	}
+}
+
+func TestPanickingProcessorLeavesInPlaceEditsBehind(t *testing.T) {
+	recorder := aikotest.NewTestRecorder(t, aiko.Config{
+		Processors: []aiko.EventProcessor{
+			{Name: "half-done", Process: func(evt aiko.Event) (aiko.Event, bool) {
+				evt.RequestHeaders["x-stage"] = "half-done"
+				evt.RequestBody.(map[string]any)["items"].([]any)[0] = "changed"
+				evt.Tags["stage"] = "half-done"
+				panic("boom")
+			}},
+		},
+	})
+	recorder.Monitor().AddEvent(aiko.Event{
+		Endpoint:       "/orders",
+		Method:         "POST",
+		StatusCode:     200,
+		RequestHeaders: map[string]string{"host": "acme.example.com"},
+		RequestBody:    map[string]any{"items": []any{"sku-1"}},
+		Tags:           map[string]string{"stage": "handler"},
+	})
+	events, err := recorder.WaitForEvents(1, 2*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	evt := events[0]
+	if _, ok := evt.RequestHeaders["x-stage"]; ok || evt.Tags["stage"] != "handler" {
+		t.Fatalf("expected the event as it was before the processor, got headers %v tags %v", evt.RequestHeaders, evt.Tags)
+	}
+	aikotest.AssertEvent(t, evt, aikotest.RequestBodyPath("items.0", "sku-1"))
+}
+
+func TestProcessorsAreValidated(t *testing.T) {
+	keep := func(evt aiko.Event) (aiko.Event, bool) { return evt, true }
+	for _, tc := range []struct {
+		processors []aiko.EventProcessor
+		want       string
+	}{
+		{[]aiko.EventProcessor{{Process: keep}}, "processors[0].name must not be empty"},
+		{[]aiko.EventProcessor{{Name: "a"}}, "processors[0].process must not be nil"},
+		{[]aiko.EventProcessor{{Name: "a", Process: keep}, {Name: "a", Process: keep}}, `processors[1].name "a" is already used`},
+	} {
+		_, err := aiko.New(aiko.Config{
+			ProjectKey: validProjectKey,
+			SecretKey:  validSecretKey,
+			Processors: tc.processors,
+		})
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Fatalf("expected %q, got %v", tc.want, err)
+		}
+	}
+}
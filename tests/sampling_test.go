@@ -0,0 +1,232 @@
+package aiko_test
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	aiko "github.com/aikocorp/aiko-monitor-go/aiko"
+	"github.com/aikocorp/aiko-monitor-go/aikotest"
+	"github.com/valyala/fasthttp"
+)
+
+func TestSamplingRulesKeepErrorsAndDropHealthChecksEarly(t *testing.T) {
+	yes := true
+	recorder := aikotest.NewTestRecorder(t, aiko.Config{
+		Actor: aiko.ActorConfig{
+			Provider: aiko.ActorProviderCustom,
+			Resolve: func(ctx aiko.ActorResolveContext) (*aiko.ActorContext, error) {
+				if id := ctx.Headers["x-user"]; id != "" {
+					return &aiko.ActorContext{ID: id}, nil
+				}
+				return nil, nil
+			},
+		},
+		Sampling: aiko.SamplingConfig{
+			Rate: 1e-9,
+			Rules: []aiko.SamplingRule{
+				{Method: "get", Endpoint: "/healthz", Rate: 0},
+				{Status: "5xx", Rate: 1},
+				{Endpoint: "/admin/**", Actor: &yes, Rate: 1},
+				{Endpoint: "/orders/*", Status: "404", Rate: 1},
+			},
+		},
+	})
+	var original io.ReadCloser
+	var buffered bool
+	handler := aiko.NetHTTPMiddleware(recorder.Monitor())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// a request dropped before the handler keeps its original body
+		buffered = r.Body != original
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/fail"):
+			w.WriteHeader(http.StatusBadGateway)
+		case strings.HasPrefix(r.URL.Path, "/orders/"):
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	serve := func(method, target, user string) {
+		t.Helper()
+		req := httptest.NewRequest(method, target, strings.NewReader(`{"a":1}`))
+		original = req.Body
+		if user != "" {
+			req.Header.Set("X-User", user)
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	serve(http.MethodGet, "/healthz?verbose=1", "")
+	if buffered {
+		t.Fatal("health check dropped by a rate 0 rule should not be buffered")
+	}
+	serve(http.MethodGet, "/fail", "")
+	if !buffered {
+		t.Fatal("a request a status rule may keep should be buffered")
+	}
+	serve(http.MethodGet, "/admin/users/1", "")
+	serve(http.MethodGet, "/admin/users/1", "u_1")
+	serve(http.MethodGet, "/orders/9", "")
+	serve(http.MethodGet, "/orders/9/items", "")
+	serve(http.MethodGet, "/listing", "")
+	if err := recorder.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, evt := range recorder.Events() {
+		if evt.SampleRate != 1 {
+			t.Fatalf("expected sample_rate 1 on %s, got %v", evt.Endpoint, evt.SampleRate)
+		}
+		got = append(got, evt.Endpoint)
+	}
+	sort.Strings(got)
+	want := []string{"/admin/users/1", "/fail", "/orders/9"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("expected kept endpoints %v, got %v", want, got)
+	}
+}
+
+func TestFastHTTPSamplingRulesRecordSampleRate(t *testing.T) {
+	recorder := aikotest.NewTestRecorder(t, aiko.Config{
+		Sampling: aiko.SamplingConfig{Rules: []aiko.SamplingRule{
+			{Endpoint: "/skip", Rate: 0},
+			{Method: "POST", Rate: 1},
+		}},
+	})
+	handler := aiko.FastHTTPMiddleware(recorder.Monitor(), func(ctx *fasthttp.RequestCtx) {})
+	for _, target := range []string{"/skip", "/orders"} {
+		var ctx fasthttp.RequestCtx
+		ctx.Request.Header.SetMethod(fasthttp.MethodPost)
+		ctx.Request.SetRequestURI(target)
+		handler(&ctx)
+	}
+	events, err := recorder.WaitForEvents(1, 2*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := recorder.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(recorder.Events()) != 1 || events[0].Endpoint != "/orders" || events[0].SampleRate != 1 {
+		t.Fatalf("expected only /orders with sample_rate 1, got %+v", recorder.Events())
+	}
+}
+
+func TestSamplingRulesAreValidated(t *testing.T) {
+	for _, tc := range []struct {
+		rule aiko.SamplingRule
+		want string
+	}{
+		{aiko.SamplingRule{Rate: 1.5}, "sampling.rules[0].rate must be between 0 and 1"},
+		{aiko.SamplingRule{Endpoint: "/api/[", Rate: 1}, `sampling.rules[0].endpoint "/api/[" is not a valid pattern`},
+		{aiko.SamplingRule{Status: "6xx", Rate: 1}, `sampling.rules[0].status must be a status code or a class like 5xx, got "6xx"`},
+	} {
+		_, err := aikotest.NewRecorder(aiko.Config{Sampling: aiko.SamplingConfig{Rules: []aiko.SamplingRule{tc.rule}}})
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Fatalf("expected %q, got %v", tc.want, err)
+		}
+	}
+}
+
+func TestConfigFromFileReadsSamplingRules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "aiko.json")
+	writeConfigFile(t, path, `{"sampling": {"rate": 0.1, "rules": [
+		{"status": "5xx", "rate": 1},
+		{"method": "GET", "endpoint": "/healthz", "actor": false, "rate": 0}
+	]}}`, 0)
+	cfg, err := aiko.ConfigFromFile(path)
+	if err != nil {
+		t.Fatalf("config from file: %v", err)
+	}
+	rules := cfg.Sampling.Rules
+	if len(rules) != 2 || rules[0].Status != "5xx" || rules[0].Rate != 1 ||
+		rules[1].Endpoint != "/healthz" || rules[1].Actor == nil || *rules[1].Actor {
+		t.Fatalf("unexpected sampling rules: %+v", rules)
+	}
+}
+
+func TestAdaptiveSamplingHoldsBusyEndpointsNearTarget(t *testing.T) {
+	recorder := aikotest.NewTestRecorder(t, aiko.Config{
+		Sampling: aiko.SamplingConfig{Adaptive: aiko.AdaptiveSamplingConfig{TargetPerSecond: 5}},
+	})
+	handler := aiko.NetHTTPMiddleware(recorder.Monitor())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("fail") != "" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	for i := 0; i < 500; i++ {
+		target := "/busy?page=1"
+		if i%25 == 0 {
+			target = "/busy?fail=1"
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, target, nil))
+	}
+	for i := 0; i < 3; i++ {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/rare", nil))
+	}
+	if err := recorder.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var busy, errors, rare int
+	for _, evt := range recorder.Events() {
+		switch {
+		case evt.StatusCode >= 500:
+			errors++
+			if evt.SampleRate != 1 {
+				t.Fatalf("errors must be kept at rate 1, got %v", evt.SampleRate)
+			}
+		case evt.Endpoint == "/rare":
+			rare++
+			if evt.SampleRate != 1 {
+				t.Fatalf("rare endpoints must be kept at rate 1, got %v", evt.SampleRate)
+			}
+		default:
+			busy++
+			if evt.SampleRate <= 0 || evt.SampleRate > 1 {
+				t.Fatalf("unexpected busy sample rate %v", evt.SampleRate)
+			}
+		}
+	}
+	if errors != 20 || rare != 3 {
+		t.Fatalf("expected every error and rare event kept, got errors=%d rare=%d", errors, rare)
+	}
+	if busy < 5 || busy > 120 {
+		t.Fatalf("expected busy endpoint throttled near its budget, kept %d of 480", busy)
+	}
+}
+
+func TestAdaptiveSamplingSharesBudgetAcrossIDsInPaths(t *testing.T) {
+	recorder := aikotest.NewTestRecorder(t, aiko.Config{
+		Sampling: aiko.SamplingConfig{Adaptive: aiko.AdaptiveSamplingConfig{TargetPerSecond: 5}},
+	})
+	handler := aiko.NetHTTPMiddleware(recorder.Monitor())(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	for i := 0; i < 300; i++ {
+		target := fmt.Sprintf("/users/%d/orders", i)
+		if i%2 == 0 {
+			target = fmt.Sprintf("/users/%08x-1111-4222-8333-444455556666/orders", i)
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, target, nil))
+	}
+	if err := recorder.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if kept := len(recorder.Events()); kept < 5 || kept > 80 {
+		t.Fatalf("expected /users/{id}/orders throttled as one endpoint, kept %d of 300", kept)
+	}
+}
+
+func TestAdaptiveSamplingRejectsFixedRate(t *testing.T) {
+	_, err := aikotest.NewRecorder(aiko.Config{Sampling: aiko.SamplingConfig{
+		Rate:     0.5,
+		Adaptive: aiko.AdaptiveSamplingConfig{TargetPerSecond: 10},
+	}})
+	if err == nil || !strings.Contains(err.Error(), "sampling.rate and sampling.adaptive cannot both be set") {
+		t.Fatalf("expected rate and adaptive conflict, got %v", err)
+	}
+}
@@ -1,6 +1,9 @@
 package aiko_test
 
 import (
+	"bytes"
+	"log"
+	"strings"
 	"testing"
 
 	aiko "github.com/aikocorp/aiko-monitor-go/aiko"
@@ -66,3 +69,74 @@ func TestValidateConfigRejectsInvalidEndpoint(t *testing.T) {
 		t.Fatalf("expected %q, got %q", expected, err.Error())
 	}
 }
+
+func TestNewRequiresOptInForCustomEndpoint(t *testing.T) {
+	_, err := aiko.New(aiko.Config{
+		ProjectKey: validProjectKey,
+		SecretKey:  validSecretKey,
+		Endpoint:   "https://relay.internal.example/api/ingest",
+	})
+	if err == nil || !strings.Contains(err.Error(), "AllowCustomEndpoint") {
+		t.Fatalf("expected opt-in hint, got %v", err)
+	}
+}
+
+func TestNewValidatesCustomEndpoints(t *testing.T) {
+	accepted := []string{
+		"https://relay.eu.example.com/ingest",
+		"http://127.0.0.2:4318/api/ingest",
+		"http://localhost/ingest",
+		"unix:///var/run/aiko.sock",
+	}
+	for _, endpoint := range accepted {
+		monitor, err := aiko.New(aiko.Config{
+			ProjectKey:          validProjectKey,
+			SecretKey:           validSecretKey,
+			Endpoint:            endpoint,
+			AllowCustomEndpoint: true,
+		})
+		if err != nil {
+			t.Fatalf("endpoint %q should be accepted: %v", endpoint, err)
+		}
+		shutdownMonitor(t, monitor)
+	}
+
+	rejected := map[string]string{
+		"http://relay.example.com/ingest":    "must use https",
+		"ftp://relay.example.com/ingest":     "scheme",
+		"https:///ingest":                    "must include a host",
+		"https://user:pw@relay.example.com/": "credentials",
+		"unix://relative.sock":               "absolute socket path",
+	}
+	for endpoint, fragment := range rejected {
+		_, err := aiko.New(aiko.Config{
+			ProjectKey:          validProjectKey,
+			SecretKey:           validSecretKey,
+			Endpoint:            endpoint,
+			AllowCustomEndpoint: true,
+		})
+		if err == nil || !strings.Contains(err.Error(), fragment) {
+			t.Fatalf("endpoint %q: expected error containing %q, got %v", endpoint, fragment, err)
+		}
+	}
+}
+
+func TestVerboseInitWarnsOnCustomEndpoint(t *testing.T) {
+	var logs bytes.Buffer
+	monitor, err := aiko.New(aiko.Config{
+		ProjectKey:          validProjectKey,
+		SecretKey:           validSecretKey,
+		Endpoint:            "https://relay.eu.example.com/ingest",
+		AllowCustomEndpoint: true,
+		Verbose:             true,
+		Logger:              log.New(&logs, "", 0),
+	})
+	if err != nil {
+		t.Fatalf("init monitor: %v", err)
+	}
+	shutdownMonitor(t, monitor)
+
+	if !strings.Contains(logs.String(), "init warning custom_endpoint=https://relay.eu.example.com/ingest") {
+		t.Fatalf("expected custom endpoint warning, got %q", logs.String())
+	}
+}
@@ -0,0 +1,149 @@
+package aiko_test
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	aiko "github.com/aikocorp/aiko-monitor-go/aiko"
+	"github.com/aikocorp/aiko-monitor-go/aikotest"
+	"github.com/valyala/fasthttp"
+)
+
+func TestHandlersTagSignedEventsAndSkipCapture(t *testing.T) {
+	server := aikotest.NewTestIngestServer(t, testProjectKey, testSecretKey)
+	monitor := newTestMonitor(t, server.Endpoint())
+	handler := aiko.NetHTTPMiddleware(monitor)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		if r.URL.Path == "/synthetic" {
+			aiko.SkipCapture(ctx)
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		aiko.SetTag(ctx, "feature", "checkout")
+		aiko.SetTag(ctx, "token", "t_123")
+		aiko.SetAttribute(ctx, "cart_items", 3)
+		aiko.SetAttribute(ctx, "ratio", 0.25)
+		aiko.SetAttribute(ctx, "new_flow", true)
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/synthetic", nil))
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("SkipCapture changed the response: %d", rec.Code)
+	}
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/checkout", nil))
+	events, err := server.WaitForEvents(1, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shutdownMonitor(t, monitor)
+	if len(server.Events()) != 1 {
+		t.Fatalf("expected the skipped request to send nothing, got %d events", len(server.Events()))
+	}
+
+	evt := events[0]
+	if evt.Endpoint != "/checkout" || evt.Tags["feature"] != "checkout" || evt.Tags["token"] != "[REDACTED]" {
+		t.Fatalf("unexpected tags on %s: %v", evt.Endpoint, evt.Tags)
+	}
+	// attributes arrive JSON-decoded, so numbers are float64
+	if evt.Attributes["cart_items"] != float64(3) || evt.Attributes["ratio"] != 0.25 || evt.Attributes["new_flow"] != true {
+		t.Fatalf("unexpected attributes %v", evt.Attributes)
+	}
+}
+
+func TestFastHTTPHandlersTagEventsThroughRequestCtx(t *testing.T) {
+	recorder := aikotest.NewTestRecorder(t, aiko.Config{})
+	handler := aiko.FastHTTPMiddleware(recorder.Monitor(), func(ctx *fasthttp.RequestCtx) {
+		aiko.SetTag(ctx, "tenant", "acme")
+		aiko.SetAttribute(ctx, "attempt", int64(2))
+		if string(ctx.Path()) == "/skip" {
+			aiko.SkipCapture(ctx)
+		}
+	})
+	for _, target := range []string{"/skip", "/orders"} {
+		var ctx fasthttp.RequestCtx
+		ctx.Request.SetRequestURI(target)
+		handler(&ctx)
+	}
+	if err := recorder.Close(); err != nil {
+		t.Fatal(err)
+	}
+	events := recorder.Events()
+	if len(events) != 1 || events[0].Endpoint != "/orders" {
+		t.Fatalf("expected only /orders, got %+v", events)
+	}
+	if events[0].Tags["tenant"] != "acme" || events[0].Attributes["attempt"] != int64(2) {
+		t.Fatalf("unexpected tags %v and attributes %v", events[0].Tags, events[0].Attributes)
+	}
+
+	// outside a captured request the calls do nothing
+	aiko.SetTag(t.Context(), "feature", "none")
+	aiko.SkipCapture(t.Context())
+}
+
+func TestNonFiniteAttributesAreRecordedAsStrings(t *testing.T) {
+	recorder := aikotest.NewTestRecorder(t, aiko.Config{})
+	handler := aiko.NetHTTPMiddleware(recorder.Monitor())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		aiko.SetAttribute(r.Context(), "nan", math.NaN())
+		aiko.SetAttribute(r.Context(), "inf", math.Inf(1))
+		aiko.SetAttribute(r.Context(), "neg_inf", math.Inf(-1))
+		aiko.SetAttribute(r.Context(), "ratio", 0.5)
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if err := recorder.Close(); err != nil {
+		t.Fatal(err)
+	}
+	events := recorder.Events()
+	if len(events) != 1 {
+		t.Fatalf("expected 1 event, got %d", len(events))
+	}
+	attrs := events[0].Attributes
+	if attrs["nan"] != "NaN" || attrs["inf"] != "+Inf" || attrs["neg_inf"] != "-Inf" || attrs["ratio"] != 0.5 {
+		t.Fatalf("unexpected attributes %v", attrs)
+	}
+	if _, err := json.Marshal(events[0]); err != nil {
+		t.Fatalf("event with non-finite attributes must encode: %v", err)
+	}
+}
+
+func TestScopeIgnoresCallsAfterTheHandlerReturns(t *testing.T) {
+	recorder := aikotest.NewTestRecorder(t, aiko.Config{})
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	handler := aiko.NetHTTPMiddleware(recorder.Monitor())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		aiko.SetTag(ctx, "phase", "handler")
+		// a goroutine that outlives the handler keeps writing to the scope
+		// while the sender redacts and encodes the event
+		go func() {
+			defer close(done)
+			for i := 0; ; i++ {
+				select {
+				case <-stop:
+					aiko.SkipCapture(ctx)
+					return
+				default:
+				}
+				aiko.SetTag(ctx, "phase", "late")
+				aiko.SetAttribute(ctx, "late", i)
+			}
+		}()
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/background", nil))
+	_, err := recorder.WaitForEvents(1, 2*time.Second)
+	close(stop)
+	<-done
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := recorder.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if events := recorder.Events(); len(events) != 1 || events[0].Endpoint != "/background" {
+		t.Fatalf("expected the event to be kept, got %+v", events)
+	}
+}
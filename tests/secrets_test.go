@@ -0,0 +1,136 @@
+package aiko_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	aiko "github.com/aikocorp/aiko-monitor-go/aiko"
+	testserver "github.com/aikocorp/aiko-monitor-go/tests/mockserver"
+)
+
+const rotatedSecretKey = "CCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCC"
+
+func writeSecretFile(t *testing.T, path, content string) {
+	t.Helper()
+	tmp := path + ".new"
+	if err := os.WriteFile(tmp, []byte(content), 0o600); err != nil {
+		t.Fatalf("write secret file: %v", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatalf("rename secret file: %v", err)
+	}
+}
+
+func TestStaticSecretProviderSwitchesAfterNotBefore(t *testing.T) {
+	provider, err := aiko.NewStaticSecretProvider(
+		aiko.SigningSecret{ID: "old", Secret: testSecretKey},
+		aiko.SigningSecret{ID: "new", Secret: rotatedSecretKey, NotBefore: time.Now().Add(time.Hour)},
+	)
+	if err != nil {
+		t.Fatalf("new provider: %v", err)
+	}
+	key, err := provider.SigningKey(context.Background())
+	if err != nil || key.ID != "old" {
+		t.Fatalf("expected old key before rotation, got %q (%v)", key.ID, err)
+	}
+
+	provider, err = aiko.NewStaticSecretProvider(
+		aiko.SigningSecret{ID: "old", Secret: testSecretKey},
+		aiko.SigningSecret{ID: "new", Secret: rotatedSecretKey, NotBefore: time.Now().Add(-time.Minute)},
+	)
+	if err != nil {
+		t.Fatalf("new provider: %v", err)
+	}
+	key, err = provider.SigningKey(context.Background())
+	if err != nil || key.ID != "new" {
+		t.Fatalf("expected new key after not_before, got %q (%v)", key.ID, err)
+	}
+}
+
+func TestFileSecretProviderReloadsWithoutRestart(t *testing.T) {
+	server, err := testserver.StartMockServer(testSecretKey, testProjectKey)
+	if err != nil {
+		t.Fatalf("start mock server: %v", err)
+	}
+	defer server.Stop()
+	if err := server.AddSecret(aiko.SigningSecret{ID: "k2", Secret: rotatedSecretKey}); err != nil {
+		t.Fatalf("add secret: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "aiko.key")
+	writeSecretFile(t, path, testSecretKey+"\n")
+	provider, err := aiko.NewFileSecretProvider(path, time.Millisecond)
+	if err != nil {
+		t.Fatalf("new file provider: %v", err)
+	}
+
+	monitor, err := aiko.New(aiko.Config{
+		ProjectKey:     testProjectKey,
+		SecretProvider: provider,
+		Endpoint:       server.Endpoint(),
+	})
+	if err != nil {
+		t.Fatalf("init monitor: %v", err)
+	}
+	defer shutdownMonitor(t, monitor)
+
+	monitor.AddEvent(aiko.Event{URL: "/before", Endpoint: "/before", Method: "GET", StatusCode: 200})
+	if _, err := server.WaitForEvent(3 * time.Second); err != nil {
+		t.Fatalf("wait for first event: %v", err)
+	}
+	firstKeyID := server.LastRequestHeaders().Get(aiko.HeaderSignatureKeyID)
+
+	writeSecretFile(t, path, fmt.Sprintf(`{"keys":[{"id":"k1","secret":%q},{"id":"k2","secret":%q,"not_before":%q}]}`,
+		testSecretKey, rotatedSecretKey, time.Now().Add(-time.Second).UTC().Format(time.RFC3339)))
+	time.Sleep(5 * time.Millisecond)
+
+	monitor.AddEvent(aiko.Event{URL: "/after", Endpoint: "/after", Method: "GET", StatusCode: 200})
+	if _, err := server.WaitForEvent(3 * time.Second); err != nil {
+		t.Fatalf("wait for second event: %v", err)
+	}
+	if got := server.LastRequestHeaders().Get(aiko.HeaderSignatureKeyID); got != "k2" || got == firstKeyID {
+		t.Fatalf("expected rotated key id k2 after reload (first %q), got %q", firstKeyID, got)
+	}
+}
+
+func TestFileSecretProviderKeepsLastGoodKeyOnParseError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "aiko.key")
+	writeSecretFile(t, path, testSecretKey)
+	provider, err := aiko.NewFileSecretProvider(path, time.Millisecond)
+	if err != nil {
+		t.Fatalf("new file provider: %v", err)
+	}
+	first, err := provider.SigningKey(context.Background())
+	if err != nil {
+		t.Fatalf("signing key: %v", err)
+	}
+
+	writeSecretFile(t, path, "not-a-key")
+	time.Sleep(5 * time.Millisecond)
+	key, err := provider.SigningKey(context.Background())
+	if err != nil || key.ID != first.ID {
+		t.Fatalf("expected last good key %q, got %q (%v)", first.ID, key.ID, err)
+	}
+	if provider.Err() == nil {
+		t.Fatal("expected reload error to be reported")
+	}
+}
+
+func TestNewRejectsSecretKeyWithProvider(t *testing.T) {
+	provider, err := aiko.NewStaticSecretProvider(aiko.SigningSecret{Secret: testSecretKey})
+	if err != nil {
+		t.Fatalf("new provider: %v", err)
+	}
+	_, err = aiko.New(aiko.Config{
+		ProjectKey:     testProjectKey,
+		SecretKey:      testSecretKey,
+		SecretProvider: provider,
+	})
+	if err == nil {
+		t.Fatal("expected error when both secretKey and secretProvider are set")
+	}
+}
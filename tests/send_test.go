@@ -5,11 +5,14 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net"
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"testing"
 	"time"
@@ -344,3 +347,239 @@ type netErr bool
 func (n netErr) Error() string   { return "netErr" }
 func (n netErr) Timeout() bool   { return bool(n) }
 func (n netErr) Temporary() bool { return bool(n) }
+
+func TestShutdownCancelsInFlightSendsAndReportsUndelivered(t *testing.T) {
+	blocked := make(chan struct{})
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case blocked <- struct{}{}:
+		default:
+		}
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	var handed []aiko.Event
+	monitor, err := aiko.New(aiko.Config{
+		ProjectKey: testProjectKey,
+		SecretKey:  testSecretKey,
+		Endpoint:   server.URL + "/api/ingest",
+		OnUndelivered: func(events []aiko.Event) {
+			handed = append(handed, events...)
+		},
+	})
+	if err != nil {
+		t.Fatalf("init monitor: %v", err)
+	}
+
+	monitor.AddEvent(aiko.Event{ID: "evt_inflight", URL: "/slow", Endpoint: "/slow", Method: "GET", StatusCode: 200})
+	select {
+	case <-blocked:
+	case <-time.After(3 * time.Second):
+		t.Fatal("expected send attempt to reach server")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err = monitor.Shutdown(ctx)
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("expected shutdown to cancel in-flight send promptly, took %s", elapsed)
+	}
+
+	var shutdownErr *aiko.ShutdownError
+	if !errors.As(err, &shutdownErr) {
+		t.Fatalf("expected ShutdownError, got %v", err)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected error to wrap deadline exceeded, got %v", err)
+	}
+	if len(shutdownErr.EventIDs) != 1 || shutdownErr.EventIDs[0] != "evt_inflight" {
+		t.Fatalf("expected undelivered evt_inflight, got %v", shutdownErr.EventIDs)
+	}
+	if len(handed) != 1 || handed[0].ID != "evt_inflight" {
+		t.Fatalf("expected undelivered handler to receive event, got %#v", handed)
+	}
+}
+
+func TestShutdownSkipsBackoffAfterDeadline(t *testing.T) {
+	server, err := testserver.StartMockServer(testSecretKey, testProjectKey)
+	if err != nil {
+		t.Fatalf("start mock server: %v", err)
+	}
+	defer server.Stop()
+
+	server.SetResponses([]int{http.StatusInternalServerError, http.StatusInternalServerError, http.StatusInternalServerError})
+
+	monitor := newTestMonitor(t, server.Endpoint())
+	monitor.AddEvent(aiko.Event{ID: "evt_retry", URL: "/retry", Endpoint: "/retry", Method: "POST", StatusCode: 500})
+
+	deadline := time.Now().Add(3 * time.Second)
+	for len(server.Attempts()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err = monitor.Shutdown(ctx)
+
+	var shutdownErr *aiko.ShutdownError
+	if !errors.As(err, &shutdownErr) {
+		t.Fatalf("expected ShutdownError, got %v", err)
+	}
+	if len(shutdownErr.EventIDs) != 1 || shutdownErr.EventIDs[0] != "evt_retry" {
+		t.Fatalf("expected undelivered evt_retry, got %v", shutdownErr.EventIDs)
+	}
+	if attempts := server.Attempts(); len(attempts) != 1 {
+		t.Fatalf("expected remaining retries to be skipped, got %d attempts", len(attempts))
+	}
+}
+
+type contextExporter struct {
+	recordingExporter
+	ctx atomic.Value
+}
+
+func (e *contextExporter) Export(ctx context.Context, events []aiko.Event) error {
+	e.ctx.Store(ctx)
+	return e.recordingExporter.Export(ctx, events)
+}
+
+func TestShutdownReleasesTheMonitorContext(t *testing.T) {
+	exporter := &contextExporter{}
+	monitor, err := aiko.New(aiko.Config{Exporters: []aiko.Exporter{exporter}})
+	if err != nil {
+		t.Fatalf("init monitor: %v", err)
+	}
+	monitor.AddEvent(aiko.Event{URL: "/clean", Endpoint: "/clean", Method: "GET", StatusCode: 200})
+	shutdownMonitor(t, monitor)
+
+	ctx, ok := exporter.ctx.Load().(context.Context)
+	if !ok {
+		t.Fatal("expected the event to be exported")
+	}
+	select {
+	case <-ctx.Done():
+	default:
+		t.Fatal("expected a clean shutdown to cancel the monitor context")
+	}
+}
+
+type blockingExporter struct {
+	recordingExporter
+	started chan struct{}
+	release chan struct{}
+}
+
+func (e *blockingExporter) Export(context.Context, []aiko.Event) error {
+	close(e.started)
+	<-e.release
+	return nil
+}
+
+func TestShutdownDoesNotWaitForAnExporterThatIgnoresTheDeadline(t *testing.T) {
+	exporter := &blockingExporter{started: make(chan struct{}), release: make(chan struct{})}
+	defer close(exporter.release)
+	monitor, err := aiko.New(aiko.Config{Exporters: []aiko.Exporter{exporter}})
+	if err != nil {
+		t.Fatalf("init monitor: %v", err)
+	}
+	monitor.AddEvent(aiko.Event{ID: "evt_stuck", URL: "/stuck", Endpoint: "/stuck", Method: "GET", StatusCode: 200})
+	<-exporter.started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err = monitor.Shutdown(ctx)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("expected Shutdown to return shortly after its deadline, took %s", elapsed)
+	}
+	var shutdownErr *aiko.ShutdownError
+	if !errors.As(err, &shutdownErr) {
+		t.Fatalf("expected ShutdownError, got %v", err)
+	}
+	if len(shutdownErr.EventIDs) != 0 || len(shutdownErr.UnknownEventIDs) != 1 || shutdownErr.UnknownEventIDs[0] != "evt_stuck" {
+		t.Fatalf("expected evt_stuck to be reported as in flight, got %+v", shutdownErr)
+	}
+}
+
+func TestSenderIsResentByNetHTTPWhenAKeepAliveConnectionWasClosed(t *testing.T) {
+	var mu sync.Mutex
+	seen := map[string]bool{}
+	var endpoints []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		evt, err := aiko.DecodeGzipEvent(mustReadAll(t, r.Body))
+		if err != nil {
+			t.Errorf("decode event: %v", err)
+		}
+		if got := r.Header.Get("Idempotency-Key"); got == "" || got != evt.ID {
+			t.Errorf("expected Idempotency-Key %q, got %q", evt.ID, got)
+		}
+		mu.Lock()
+		reused := seen[r.RemoteAddr]
+		seen[r.RemoteAddr] = true
+		if !reused {
+			endpoints = append(endpoints, evt.Endpoint)
+		}
+		mu.Unlock()
+		if reused {
+			// the server dropped the idle connection before this request
+			conn, _, err := w.(http.Hijacker).Hijack()
+			if err == nil {
+				_ = conn.Close()
+			}
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	var failed atomic.Int32
+	monitor, err := aiko.New(aiko.Config{
+		ProjectKey: testProjectKey,
+		SecretKey:  testSecretKey,
+		Endpoint:   strings.Replace(server.URL, "127.0.0.1", "localhost", 1) + "/api/ingest",
+		OnExportFailed: func(string, []aiko.Event, error) {
+			failed.Add(1)
+		},
+	})
+	if err != nil {
+		t.Fatalf("init monitor: %v", err)
+	}
+	monitor.AddEvent(aiko.Event{URL: "/first", Endpoint: "/first", Method: "GET", StatusCode: 200})
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		mu.Lock()
+		n := len(endpoints)
+		mu.Unlock()
+		if n == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("first event not delivered")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	monitor.AddEvent(aiko.Event{URL: "/second", Endpoint: "/second", Method: "GET", StatusCode: 200})
+	shutdownMonitor(t, monitor)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if strings.Join(endpoints, ",") != "/first,/second" || failed.Load() != 0 {
+		t.Fatalf("expected net/http to send /second again on a new connection, got %v with %d failures", endpoints, failed.Load())
+	}
+}
+
+func mustReadAll(t *testing.T, r io.Reader) []byte {
+	t.Helper()
+	raw, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("read body: %v", err)
+	}
+	return raw
+}
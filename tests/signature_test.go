@@ -0,0 +1,159 @@
+package aiko_test
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	aiko "github.com/aikocorp/aiko-monitor-go/aiko"
+	testserver "github.com/aikocorp/aiko-monitor-go/tests/mockserver"
+)
+
+func signedHeaders(t *testing.T, secretKey string, body []byte, at time.Time) http.Header {
+	t.Helper()
+	secret, err := base64.RawURLEncoding.DecodeString(secretKey)
+	if err != nil {
+		t.Fatalf("decode secret: %v", err)
+	}
+	h := http.Header{}
+	h.Set(aiko.HeaderProjectKey, testProjectKey)
+	aiko.SignRequest(secret, aiko.SecretKeyID(secret), testProjectKey, body, at).Apply(h)
+	return h
+}
+
+func TestSignatureCanonicalStringFormat(t *testing.T) {
+	got := aiko.SignatureCanonicalString("1700000000", "abc", "pk_x", []byte("hello"))
+	expected := "aiko-v1\n1700000000\nabc\npk_x\n2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+	if got != expected {
+		t.Fatalf("expected canonical string %q, got %q", expected, got)
+	}
+}
+
+func TestSignatureVerifierAcceptsValidAndRejectsReplay(t *testing.T) {
+	verifier, err := aiko.NewSignatureVerifier(testProjectKey, time.Minute, testSecretKey)
+	if err != nil {
+		t.Fatalf("new verifier: %v", err)
+	}
+	body := []byte("payload")
+	headers := signedHeaders(t, testSecretKey, body, time.Now())
+
+	if err := verifier.Verify(headers, body); err != nil {
+		t.Fatalf("expected valid signature, got %v", err)
+	}
+	if err := verifier.Verify(headers, body); !errors.Is(err, aiko.ErrSignatureReplayed) {
+		t.Fatalf("expected replay rejection, got %v", err)
+	}
+}
+
+func TestSignatureVerifierReportsResendsUnderTheSameIdempotencyKey(t *testing.T) {
+	verifier, err := aiko.NewSignatureVerifier(testProjectKey, time.Minute, testSecretKey)
+	if err != nil {
+		t.Fatalf("new verifier: %v", err)
+	}
+	body := []byte("payload")
+	headers := signedHeaders(t, testSecretKey, body, time.Now())
+	headers.Set(aiko.HeaderIdempotencyKey, "evt_1")
+
+	if err := verifier.Verify(headers, body); err != nil {
+		t.Fatalf("expected valid signature, got %v", err)
+	}
+	if err := verifier.Verify(headers, body); !errors.Is(err, aiko.ErrSignatureDuplicate) {
+		t.Fatalf("expected a duplicate, got %v", err)
+	}
+	headers.Set(aiko.HeaderIdempotencyKey, "evt_2")
+	if err := verifier.Verify(headers, body); !errors.Is(err, aiko.ErrSignatureReplayed) {
+		t.Fatalf("expected a replay under another key to be rejected, got %v", err)
+	}
+}
+
+func TestSignatureVerifierSpendsNoncesOnlyOnCommit(t *testing.T) {
+	verifier, err := aiko.NewSignatureVerifier(testProjectKey, time.Minute, testSecretKey)
+	if err != nil {
+		t.Fatalf("new verifier: %v", err)
+	}
+	body := []byte("payload")
+	headers := signedHeaders(t, testSecretKey, body, time.Now())
+	headers.Set(aiko.HeaderIdempotencyKey, "evt_1")
+
+	for i := 0; i < 2; i++ {
+		if err := verifier.Check(headers, body); err != nil {
+			t.Fatalf("check %d: expected an uncommitted nonce to pass, got %v", i+1, err)
+		}
+	}
+	verifier.Commit(headers)
+	if err := verifier.Check(headers, body); !errors.Is(err, aiko.ErrSignatureDuplicate) {
+		t.Fatalf("expected a duplicate after commit, got %v", err)
+	}
+}
+
+func TestSignatureVerifierRejectsInvalidRequests(t *testing.T) {
+	verifier, err := aiko.NewSignatureVerifier(testProjectKey, time.Minute, testSecretKey)
+	if err != nil {
+		t.Fatalf("new verifier: %v", err)
+	}
+	body := []byte("payload")
+
+	stale := signedHeaders(t, testSecretKey, body, time.Now().Add(-time.Hour))
+	if err := verifier.Verify(stale, body); !errors.Is(err, aiko.ErrSignatureExpired) {
+		t.Fatalf("expected skew rejection, got %v", err)
+	}
+
+	tampered := signedHeaders(t, testSecretKey, body, time.Now())
+	if err := verifier.Verify(tampered, []byte("other")); !errors.Is(err, aiko.ErrSignatureMismatch) {
+		t.Fatalf("expected mismatch, got %v", err)
+	}
+
+	otherKey := signedHeaders(t, "CCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCC", body, time.Now())
+	if err := verifier.Verify(otherKey, body); !errors.Is(err, aiko.ErrSignatureUnknownKey) {
+		t.Fatalf("expected unknown key, got %v", err)
+	}
+
+	wrongProject := signedHeaders(t, testSecretKey, body, time.Now())
+	wrongProject.Set(aiko.HeaderProjectKey, "pk_BBBBBBBBBBBBBBBBBBBBBB")
+	if err := verifier.Verify(wrongProject, body); !errors.Is(err, aiko.ErrProjectKeyMismatch) {
+		t.Fatalf("expected project key mismatch, got %v", err)
+	}
+
+	missing := http.Header{}
+	missing.Set(aiko.HeaderProjectKey, testProjectKey)
+	if err := verifier.Verify(missing, body); !errors.Is(err, aiko.ErrSignatureMissing) {
+		t.Fatalf("expected missing signature, got %v", err)
+	}
+}
+
+func TestSenderSignsEachAttemptFreshly(t *testing.T) {
+	server, err := testserver.StartMockServer(testSecretKey, testProjectKey)
+	if err != nil {
+		t.Fatalf("start mock server: %v", err)
+	}
+	defer server.Stop()
+
+	server.SetResponses([]int{http.StatusServiceUnavailable, http.StatusAccepted})
+
+	monitor := newTestMonitor(t, server.Endpoint())
+	monitor.AddEvent(aiko.Event{URL: "/signed", Endpoint: "/signed", Method: "GET", StatusCode: 200})
+	if _, err := server.WaitForEvent(5 * time.Second); err != nil {
+		t.Fatalf("wait for event: %v", err)
+	}
+	shutdownMonitor(t, monitor)
+
+	requests := server.RequestHeaders()
+	if len(requests) != 2 {
+		t.Fatalf("expected 2 signed attempts, got %d", len(requests))
+	}
+	for _, h := range requests {
+		for _, name := range []string{aiko.HeaderSignature, aiko.HeaderSignatureTimestamp, aiko.HeaderSignatureNonce, aiko.HeaderSignatureKeyID} {
+			if h.Get(name) == "" {
+				t.Fatalf("expected %s header, got %#v", name, h)
+			}
+		}
+	}
+	if requests[0].Get(aiko.HeaderSignatureNonce) == requests[1].Get(aiko.HeaderSignatureNonce) {
+		t.Fatal("expected retries to use a fresh nonce")
+	}
+	if requests[0].Get(aiko.HeaderSignature) == requests[1].Get(aiko.HeaderSignature) {
+		t.Fatal("expected retries to be re-signed")
+	}
+}
@@ -0,0 +1,134 @@
+package aiko_test
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	aiko "github.com/aikocorp/aiko-monitor-go/aiko"
+	testserver "github.com/aikocorp/aiko-monitor-go/tests/mockserver"
+)
+
+func slogRecords(t *testing.T, out *lockedBuffer) []map[string]any {
+	t.Helper()
+	var records []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var record map[string]any
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("decode slog record %q: %v", line, err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func findRecord(records []map[string]any, msg string) map[string]any {
+	for _, record := range records {
+		if record["msg"] == msg {
+			return record
+		}
+	}
+	return nil
+}
+
+func TestSlogHandlerReceivesStructuredVerboseRecords(t *testing.T) {
+	server, err := testserver.StartMockServer(testSecretKey, testProjectKey)
+	if err != nil {
+		t.Fatalf("start mock server: %v", err)
+	}
+	defer server.Stop()
+
+	var out lockedBuffer
+	monitor, err := aiko.New(aiko.Config{
+		ProjectKey:  testProjectKey,
+		SecretKey:   testSecretKey,
+		Endpoint:    server.Endpoint(),
+		Verbose:     true,
+		SlogHandler: slog.NewJSONHandler(&out, &slog.HandlerOptions{Level: slog.LevelDebug}),
+	})
+	if err != nil {
+		t.Fatalf("init monitor: %v", err)
+	}
+	monitor.AddEvent(aiko.Event{URL: "/slog", Endpoint: "/slog", Method: "GET", StatusCode: 200})
+	if _, err := server.WaitForEvent(3 * time.Second); err != nil {
+		t.Fatalf("wait for event: %v", err)
+	}
+	shutdownMonitor(t, monitor)
+
+	records := slogRecords(t, &out)
+	queued := findRecord(records, "queued")
+	if queued == nil || queued["level"] != "DEBUG" || queued["component"] != "aiko" {
+		t.Fatalf("expected debug queued record, got %#v", records)
+	}
+	accepted := findRecord(records, "send accepted")
+	if accepted == nil || accepted["level"] != "DEBUG" {
+		t.Fatalf("expected debug send accepted record, got %#v", records)
+	}
+	if accepted["event_id"] != queued["event_id"] || accepted["status"] != float64(202) {
+		t.Fatalf("unexpected send accepted attributes: %#v", accepted)
+	}
+	if _, ok := accepted["latency_ms"].(float64); !ok {
+		t.Fatalf("expected numeric latency_ms, got %#v", accepted["latency_ms"])
+	}
+	if init := findRecord(records, "init"); init == nil || init["level"] != "INFO" {
+		t.Fatalf("expected info init record, got %#v", records)
+	}
+	if strings.Contains(out.String(), testSecretKey) {
+		t.Fatal("slog records must not include secret key")
+	}
+}
+
+func TestSlogHandlerReceivesWarningsWithoutVerbose(t *testing.T) {
+	var out lockedBuffer
+	exporter := &recordingExporter{failures: []error{retryableErr{}, errors.New("rejected")}}
+	monitor, err := aiko.New(aiko.Config{
+		Exporters:   []aiko.Exporter{exporter},
+		SlogHandler: slog.NewJSONHandler(&out, &slog.HandlerOptions{Level: slog.LevelDebug}),
+	})
+	if err != nil {
+		t.Fatalf("init monitor: %v", err)
+	}
+	monitor.AddEvent(aiko.Event{URL: "/slog", Endpoint: "/slog", Method: "GET", StatusCode: 200})
+	shutdownMonitor(t, monitor)
+
+	records := slogRecords(t, &out)
+	retry := findRecord(records, "export retry")
+	if retry == nil || retry["level"] != "WARN" || retry["attempt"] != float64(1) || retry["error"] != "try again" {
+		t.Fatalf("expected warn export retry record, got %#v", records)
+	}
+	failed := findRecord(records, "export failed")
+	if failed == nil || failed["level"] != "WARN" || failed["attempt"] != float64(2) || failed["error"] != "rejected" {
+		t.Fatalf("expected warn export failed record, got %#v", records)
+	}
+	for _, record := range records {
+		if record["level"] == "DEBUG" || record["level"] == "INFO" {
+			t.Fatalf("verbose records must be dropped without Verbose, got %#v", record)
+		}
+	}
+}
+
+func TestTextLogQuotesAmbiguousValues(t *testing.T) {
+	var out lockedBuffer
+	exporter := &recordingExporter{failures: []error{errors.New("disk full: retry=no\nsee logs")}}
+	monitor, err := aiko.New(aiko.Config{
+		Exporters: []aiko.Exporter{exporter},
+		Logger:    log.New(&out, "", 0),
+	})
+	if err != nil {
+		t.Fatalf("init monitor: %v", err)
+	}
+	monitor.AddEvent(aiko.Event{ID: "evt_plain", URL: "/text", Endpoint: "/text", Method: "GET", StatusCode: 200})
+	shutdownMonitor(t, monitor)
+
+	want := `aiko export failed exporter=*aiko_test.recordingExporter events=1 attempt=1 error="disk full: retry=no\nsee logs"`
+	if !strings.Contains(out.String(), want) {
+		t.Fatalf("expected %q in text log, got %q", want, out.String())
+	}
+}
@@ -0,0 +1,396 @@
+package aiko_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	aiko "github.com/aikocorp/aiko-monitor-go/aiko"
+)
+
+func writeClientCertificate(t *testing.T, dir string) (certFile, keyFile string, cert *x509.Certificate) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "aiko-client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+	cert, err = x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("parse certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("marshal key: %v", err)
+	}
+	certFile = filepath.Join(dir, "client.pem")
+	keyFile = filepath.Join(dir, "client-key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatalf("write cert: %v", err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatalf("write key: %v", err)
+	}
+	return certFile, keyFile, cert
+}
+
+func startTLSIngest(t *testing.T, clientCA *x509.Certificate) (*httptest.Server, chan string, string) {
+	t.Helper()
+	received := make(chan string, 10)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		subject := ""
+		if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+			subject = r.TLS.PeerCertificates[0].Subject.CommonName
+		}
+		received <- subject
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	if clientCA != nil {
+		pool := x509.NewCertPool()
+		pool.AddCert(clientCA)
+		server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: pool}
+	}
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(caFile, caPEM, 0o600); err != nil {
+		t.Fatalf("write ca file: %v", err)
+	}
+	return server, received, caFile
+}
+
+func TestTransportAppliesCAClientCertAndPin(t *testing.T) {
+	certFile, keyFile, clientCert := writeClientCertificate(t, t.TempDir())
+	server, received, caFile := startTLSIngest(t, clientCert)
+
+	var logs lockedBuffer
+	monitor, err := aiko.New(aiko.Config{
+		ProjectKey:          testProjectKey,
+		SecretKey:           testSecretKey,
+		Endpoint:            server.URL + "/api/ingest",
+		AllowCustomEndpoint: true,
+		Transport: aiko.TransportConfig{
+			CAFile:           caFile,
+			ClientCertFile:   certFile,
+			ClientKeyFile:    keyFile,
+			PinnedSPKISHA256: []string{aiko.SPKIHash(server.Certificate())},
+		},
+		Verbose: true,
+		Logger:  log.New(&logs, "", 0),
+	})
+	if err != nil {
+		t.Fatalf("init monitor: %v", err)
+	}
+	defer shutdownMonitor(t, monitor)
+
+	monitor.AddEvent(aiko.Event{URL: "/mtls", Endpoint: "/mtls", Method: "GET", StatusCode: 200})
+	select {
+	case subject := <-received:
+		if subject != "aiko-client" {
+			t.Fatalf("expected client certificate aiko-client, got %q", subject)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected TLS ingest to receive event, logs: %s", logs.String())
+	}
+
+	expected := "init transport ca_file=" + caFile + " client_cert=" + certFile + " spki_pins=1"
+	if !strings.Contains(logs.String(), expected) {
+		t.Fatalf("expected init log %q, got %q", expected, logs.String())
+	}
+}
+
+func TestTransportRejectsPinMismatch(t *testing.T) {
+	server, received, caFile := startTLSIngest(t, nil)
+	_, _, otherCert := writeClientCertificate(t, t.TempDir())
+
+	var logs lockedBuffer
+	monitor, err := aiko.New(aiko.Config{
+		ProjectKey:          testProjectKey,
+		SecretKey:           testSecretKey,
+		Endpoint:            server.URL + "/api/ingest",
+		AllowCustomEndpoint: true,
+		Transport: aiko.TransportConfig{
+			CAFile:           caFile,
+			PinnedSPKISHA256: []string{aiko.SPKIHash(otherCert)},
+		},
+		Verbose: true,
+		Logger:  log.New(&logs, "", 0),
+	})
+	if err != nil {
+		t.Fatalf("init monitor: %v", err)
+	}
+	monitor.AddEvent(aiko.Event{URL: "/pinned", Endpoint: "/pinned", Method: "GET", StatusCode: 200})
+	shutdownMonitor(t, monitor)
+
+	select {
+	case <-received:
+		t.Fatal("expected pinned connection to be refused")
+	default:
+	}
+	if !strings.Contains(logs.String(), "does not match any pinned SPKI hash") {
+		t.Fatalf("expected pin mismatch in logs, got %q", logs.String())
+	}
+}
+
+func TestTransportProxyHonorsNoProxy(t *testing.T) {
+	connects := make(chan string, 10)
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		connects <- r.Method + " " + r.Host
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer proxy.Close()
+
+	newMonitor := func(noProxy string) *aiko.Monitor {
+		monitor, err := aiko.New(aiko.Config{
+			ProjectKey:          testProjectKey,
+			SecretKey:           testSecretKey,
+			Endpoint:            "https://ingest.aiko.test/api/ingest",
+			AllowCustomEndpoint: true,
+			Transport:           aiko.TransportConfig{ProxyURL: proxy.URL, NoProxy: noProxy},
+		})
+		if err != nil {
+			t.Fatalf("init monitor: %v", err)
+		}
+		return monitor
+	}
+
+	monitor := newMonitor("internal.example")
+	monitor.AddEvent(aiko.Event{URL: "/proxied", Endpoint: "/proxied", Method: "GET", StatusCode: 200})
+	select {
+	case got := <-connects:
+		if got != "CONNECT ingest.aiko.test:443" {
+			t.Fatalf("expected CONNECT through proxy, got %q", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected request to go through the proxy")
+	}
+	shutdownMonitor(t, monitor)
+	for len(connects) > 0 {
+		<-connects
+	}
+
+	monitor = newMonitor("localhost,.aiko.test")
+	monitor.AddEvent(aiko.Event{URL: "/direct", Endpoint: "/direct", Method: "GET", StatusCode: 200})
+	shutdownMonitor(t, monitor)
+	select {
+	case got := <-connects:
+		t.Fatalf("expected NO_PROXY host to bypass the proxy, got %q", got)
+	default:
+	}
+}
+
+func TestTransportConflictsWithHTTPClient(t *testing.T) {
+	_, err := aiko.New(aiko.Config{
+		ProjectKey: testProjectKey,
+		SecretKey:  testSecretKey,
+		HTTPClient: &http.Client{},
+		Transport:  aiko.TransportConfig{ProxyURL: "http://proxy.internal:3128"},
+	})
+	if err == nil {
+		t.Fatal("expected error when httpClient and transport are both set")
+	}
+}
+
+// issueCertificate signs a certificate for 127.0.0.1 and *.example.com with
+// parent, or self-signs it when parent is nil.
+func issueCertificate(t *testing.T, name string, isCA bool, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		DNSNames:              []string{"*.example.com"},
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("parse certificate: %v", err)
+	}
+	return cert, key
+}
+
+func writeCAFile(t *testing.T, certs ...*x509.Certificate) string {
+	t.Helper()
+	var bundle []byte
+	for _, cert := range certs {
+		bundle = append(bundle, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})...)
+	}
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caFile, bundle, 0o600); err != nil {
+		t.Fatalf("write ca file: %v", err)
+	}
+	return caFile
+}
+
+func TestTransportPinMatchesAnyVerifiedChain(t *testing.T) {
+	root, rootKey := issueCertificate(t, "aiko-root", true, nil, nil)
+	intermediate, intermediateKey := issueCertificate(t, "aiko-intermediate", true, root, rootKey)
+	leaf, leafKey := issueCertificate(t, "aiko-ingest", false, intermediate, intermediateKey)
+
+	received := make(chan struct{}, 10)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- struct{}{}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{{
+		Certificate: [][]byte{leaf.Raw, intermediate.Raw},
+		PrivateKey:  leafKey,
+	}}}
+	server.StartTLS()
+	defer server.Close()
+
+	// trusting the intermediate as well as the root gives two verified
+	// chains, and the shorter one that ends at the intermediate comes first
+	var logs lockedBuffer
+	monitor, err := aiko.New(aiko.Config{
+		ProjectKey:          testProjectKey,
+		SecretKey:           testSecretKey,
+		Endpoint:            server.URL + "/api/ingest",
+		AllowCustomEndpoint: true,
+		Transport: aiko.TransportConfig{
+			CAFile:           writeCAFile(t, intermediate, root),
+			PinnedSPKISHA256: []string{aiko.SPKIHash(root)},
+		},
+		Verbose: true,
+		Logger:  log.New(&logs, "", 0),
+	})
+	if err != nil {
+		t.Fatalf("init monitor: %v", err)
+	}
+	defer shutdownMonitor(t, monitor)
+
+	monitor.AddEvent(aiko.Event{URL: "/chains", Endpoint: "/chains", Method: "GET", StatusCode: 200})
+	select {
+	case <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected the pin on the root to be accepted, logs: %s", logs.String())
+	}
+}
+
+func TestTransportKeepsClientCertAndPinsOffTheHTTPSProxy(t *testing.T) {
+	certFile, keyFile, clientCert := writeClientCertificate(t, t.TempDir())
+	origin, received, _ := startTLSIngest(t, clientCert)
+
+	proxyCert, proxyKey := issueCertificate(t, "aiko-proxy", true, nil, nil)
+	proxyClientCerts := make(chan int, 10)
+	proxy := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodConnect {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		proxyClientCerts <- len(r.TLS.PeerCertificates)
+		upstream, err := net.Dial("tcp", origin.Listener.Addr().String())
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		conn, buf, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			_ = upstream.Close()
+			return
+		}
+		_, _ = conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+		go func() {
+			_, _ = io.Copy(upstream, buf)
+			_ = upstream.Close()
+		}()
+		_, _ = io.Copy(conn, upstream)
+		_ = conn.Close()
+	}))
+	proxy.TLS = &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{proxyCert.Raw}, PrivateKey: proxyKey}},
+		ClientAuth:   tls.RequestClientCert,
+	}
+	proxy.StartTLS()
+	defer proxy.Close()
+
+	var logs lockedBuffer
+	monitor, err := aiko.New(aiko.Config{
+		ProjectKey:          testProjectKey,
+		SecretKey:           testSecretKey,
+		Endpoint:            "https://ingest.example.com/api/ingest",
+		AllowCustomEndpoint: true,
+		Transport: aiko.TransportConfig{
+			CAFile:           writeCAFile(t, origin.Certificate(), proxyCert),
+			ClientCertFile:   certFile,
+			ClientKeyFile:    keyFile,
+			ProxyURL:         proxy.URL,
+			PinnedSPKISHA256: []string{aiko.SPKIHash(origin.Certificate())},
+		},
+		Verbose: true,
+		Logger:  log.New(&logs, "", 0),
+	})
+	if err != nil {
+		t.Fatalf("init monitor: %v", err)
+	}
+	defer shutdownMonitor(t, monitor)
+
+	monitor.AddEvent(aiko.Event{URL: "/proxied", Endpoint: "/proxied", Method: "GET", StatusCode: 200})
+	select {
+	case subject := <-received:
+		if subject != "aiko-client" {
+			t.Fatalf("expected the ingest to see client certificate aiko-client, got %q", subject)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected the event to reach the ingest through the proxy, logs: %s", logs.String())
+	}
+	if n := <-proxyClientCerts; n != 0 {
+		t.Fatalf("expected no client certificate on the proxy handshake, got %d", n)
+	}
+}
+
+func TestTransportNoProxyRequiresProxyURL(t *testing.T) {
+	_, err := aiko.New(aiko.Config{
+		ProjectKey: testProjectKey,
+		SecretKey:  testSecretKey,
+		Transport:  aiko.TransportConfig{NoProxy: "internal.example"},
+	})
+	if err == nil || !strings.Contains(err.Error(), "noProxy requires proxyURL") {
+		t.Fatalf("expected noProxy without proxyURL to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,66 @@
+package aiko_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	aiko "github.com/aikocorp/aiko-monitor-go/aiko"
+	testserver "github.com/aikocorp/aiko-monitor-go/tests/mockserver"
+)
+
+func unixSocketPath(t *testing.T) string {
+	t.Helper()
+	// Socket paths are limited to ~100 bytes, so avoid the long t.TempDir.
+	dir, err := os.MkdirTemp("", "aiko")
+	if err != nil {
+		t.Fatalf("temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	return filepath.Join(dir, "ingest.sock")
+}
+
+func TestUnixSocketDeliveryReconnectsAfterAgentRestart(t *testing.T) {
+	socketPath := unixSocketPath(t)
+	server, err := testserver.StartUnixMockServer(testSecretKey, testProjectKey, socketPath)
+	if err != nil {
+		t.Fatalf("start unix mock server: %v", err)
+	}
+
+	monitor, err := aiko.New(aiko.Config{
+		ProjectKey:          testProjectKey,
+		SecretKey:           testSecretKey,
+		Endpoint:            server.Endpoint(),
+		AllowCustomEndpoint: true,
+	})
+	if err != nil {
+		t.Fatalf("init monitor: %v", err)
+	}
+	defer shutdownMonitor(t, monitor)
+
+	monitor.AddEvent(aiko.Event{URL: "/first", Endpoint: "/first", Method: "GET", StatusCode: 200})
+	evt, err := server.WaitForEvent(3 * time.Second)
+	if err != nil {
+		t.Fatalf("wait for first event: %v", err)
+	}
+	if evt.Endpoint != "/first" {
+		t.Fatalf("expected /first over the socket, got %q", evt.Endpoint)
+	}
+	server.Stop()
+
+	restarted, err := testserver.StartUnixMockServer(testSecretKey, testProjectKey, socketPath)
+	if err != nil {
+		t.Fatalf("restart unix mock server: %v", err)
+	}
+	defer restarted.Stop()
+
+	monitor.AddEvent(aiko.Event{URL: "/second", Endpoint: "/second", Method: "GET", StatusCode: 200})
+	evt, err = restarted.WaitForEvent(5 * time.Second)
+	if err != nil {
+		t.Fatalf("wait for event after restart: %v", err)
+	}
+	if evt.Endpoint != "/second" {
+		t.Fatalf("expected /second after reconnect, got %q", evt.Endpoint)
+	}
+}